@@ -0,0 +1,175 @@
+// Command phantomd is an HTTP service which renders pages and evaluates
+// scripts using a pool of PhantomJS processes.
+//
+// Usage:
+//
+//	phantomd [flags]
+//
+// Endpoints:
+//
+//	POST /render    Renders a URL or HTML to PNG, JPEG or PDF.
+//	POST /evaluate  Evaluates a JavaScript function in a page.
+//	GET  /healthz   Reports the number of running and queued requests.
+//
+// Requests are JSON objects. For example:
+//
+//	{
+//		"url": "https://example.com",
+//		"viewport": {"width": 1280, "height": 800},
+//		"settings": {"userAgent": "phantomd", "resourceTimeout": 5000},
+//		"render": {"format": "pdf"},
+//		"paperSize": {"format": "A4", "margin": {"top": "1cm", "bottom": "1cm"}},
+//		"timeout": 10000
+//	}
+//
+// Requests are rejected with 503 when the queue is full and fail with 504 if
+// they do not complete within their timeout.
+//
+// Only http and https URLs are loaded by default. Other schemes, such as
+// "file", must be listed with -allow-schemes. The scheme is checked for the
+// request's url and baseURL only, not for resources the page loads. Settings
+// which disable webSecurityEnabled or enable localToRemoteUrlAccessEnabled are
+// rejected unless -allow-unsafe-settings is set, as they would let a page read
+// local files.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/kere/phantomjs"
+)
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	m := NewMain()
+	if err := m.Run(ctx, os.Args[1:]...); err == flag.ErrHelp {
+		os.Exit(2)
+	} else if err != nil {
+		fmt.Fprintln(m.Stderr, "phantomd:", err)
+		os.Exit(1)
+	}
+}
+
+// Main represents the program.
+type Main struct {
+	Addr string
+
+	// Process pool settings.
+	Processes int
+	Port      int
+	BinPath   string
+
+	// Request limits.
+	Workers    int
+	QueueSize  int
+	Timeout    time.Duration
+	MaxTimeout time.Duration
+
+	// Additional URL schemes and whether requests may relax web security.
+	AllowSchemes        []string
+	AllowUnsafeSettings bool
+
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
+// NewMain returns a new instance of Main with default settings.
+func NewMain() *Main {
+	return &Main{
+		Addr:       ":8080",
+		Processes:  phantomjs.DefaultProcessPoolSize,
+		Port:       phantomjs.DefaultPort,
+		BinPath:    phantomjs.DefaultBinPath,
+		Workers:    DefaultWorkers,
+		QueueSize:  DefaultQueueSize,
+		Timeout:    DefaultTimeout,
+		MaxTimeout: DefaultMaxTimeout,
+		Stdout:     os.Stdout,
+		Stderr:     os.Stderr,
+	}
+}
+
+// Run parses the flags, starts the pool and serves requests until ctx is done.
+func (m *Main) Run(ctx context.Context, args ...string) error {
+	if err := m.ParseFlags(args); err != nil {
+		return err
+	}
+
+	pool := phantomjs.NewProcessPool(m.Processes)
+	pool.BasePort = m.Port
+	pool.BinPath = m.BinPath
+	if err := pool.Open(); err != nil {
+		return fmt.Errorf("cannot start phantomjs: %s", err)
+	}
+	defer pool.Close()
+
+	s := NewServer(pool)
+	s.Workers = m.Workers
+	s.QueueSize = m.QueueSize
+	s.Timeout = m.Timeout
+	s.MaxTimeout = m.MaxTimeout
+	s.AllowSchemes = m.AllowSchemes
+	s.AllowUnsafeSettings = m.AllowUnsafeSettings
+
+	srv := &http.Server{Addr: m.Addr, Handler: s}
+	errc := make(chan error, 1)
+	go func() { errc <- srv.ListenAndServe() }()
+	fmt.Fprintf(m.Stdout, "phantomd listening on %s\n", m.Addr)
+
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+	}
+
+	// Allow running requests to complete before stopping the pool.
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), m.MaxTimeout)
+	defer cancel()
+	return srv.Shutdown(shutdownCtx)
+}
+
+// ParseFlags parses the command line flags.
+func (m *Main) ParseFlags(args []string) error {
+	fs := flag.NewFlagSet("phantomd", flag.ContinueOnError)
+	fs.SetOutput(m.Stderr)
+	fs.StringVar(&m.Addr, "addr", m.Addr, "HTTP bind address")
+	fs.IntVar(&m.Processes, "processes", m.Processes, "number of phantomjs processes")
+	fs.IntVar(&m.Port, "port", m.Port, "port of the first phantomjs process")
+	fs.StringVar(&m.BinPath, "phantomjs", m.BinPath, "path to the phantomjs binary")
+	fs.IntVar(&m.Workers, "workers", m.Workers, "maximum number of concurrent requests")
+	fs.IntVar(&m.QueueSize, "queue", m.QueueSize, "maximum number of waiting requests")
+	fs.DurationVar(&m.Timeout, "timeout", m.Timeout, "default request timeout")
+	fs.DurationVar(&m.MaxTimeout, "max-timeout", m.MaxTimeout, "maximum request timeout")
+	schemes := fs.String("allow-schemes", strings.Join(m.AllowSchemes, ","), `comma-separated URL schemes allowed in addition to http and https, such as "file"`)
+	fs.BoolVar(&m.AllowUnsafeSettings, "allow-unsafe-settings", m.AllowUnsafeSettings, "allow requests to disable web security settings")
+	if err := fs.Parse(args); err != nil {
+		return err
+	} else if fs.NArg() > 0 {
+		return fmt.Errorf("unexpected arguments: %v", fs.Args())
+	}
+
+	m.AllowSchemes = nil
+	for _, scheme := range strings.Split(*schemes, ",") {
+		if scheme = strings.TrimSpace(scheme); scheme != "" {
+			m.AllowSchemes = append(m.AllowSchemes, scheme)
+		}
+	}
+
+	if m.Workers < 1 {
+		return fmt.Errorf("-workers must be at least 1")
+	} else if m.QueueSize < 0 {
+		return fmt.Errorf("-queue cannot be negative")
+	}
+	return nil
+}
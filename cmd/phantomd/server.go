@@ -0,0 +1,556 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/kere/phantomjs"
+)
+
+// Default server settings.
+const (
+	DefaultWorkers    = 4
+	DefaultQueueSize  = 16
+	DefaultTimeout    = 30 * time.Second
+	DefaultMaxTimeout = 2 * time.Minute
+	DefaultMaxBody    = 10 << 20
+)
+
+// Server errors.
+var (
+	ErrOverloaded      = errors.New("server overloaded")
+	ErrTimeout         = errors.New("request timed out")
+	ErrMissingSource   = errors.New("url or html required")
+	ErrAmbiguousSource = errors.New("url and html cannot both be set")
+	ErrMissingScript   = errors.New("script required")
+	ErrSchemeDenied    = errors.New("url scheme not allowed")
+	ErrUnsafeSettings  = errors.New("settings cannot disable web security")
+)
+
+// PageCreator creates web pages. It is implemented by *phantomjs.Process and
+// *phantomjs.ProcessPool.
+type PageCreator interface {
+	CreateWebPage() (*phantomjs.WebPage, error)
+}
+
+// Server is an HTTP server which renders pages and evaluates scripts.
+//
+// At most Workers requests run at once and at most QueueSize requests wait
+// for a worker. Requests beyond that are rejected with 503 so callers can
+// back off. Each request must complete within its timeout, including time
+// spent in the queue, or it fails with 504.
+//
+// Only http and https URLs may be loaded and requests cannot relax the page's
+// web security settings unless allowed by AllowSchemes and AllowUnsafeSettings.
+type Server struct {
+	Pages PageCreator
+
+	// Number of concurrent requests and maximum number of waiting requests.
+	Workers   int
+	QueueSize int
+
+	// Default and maximum timeout of each request.
+	Timeout    time.Duration
+	MaxTimeout time.Duration
+
+	// Maximum size of a request body, in bytes.
+	MaxBody int64
+
+	// URL schemes which may be loaded in addition to http and https, such
+	// as "file". Other schemes can expose files on the server.
+	//
+	// Only the request's URL and BaseURL are checked. Resources, redirects
+	// and navigation within the page are not, so reading local files from a
+	// remote page relies on web security, which requests cannot relax unless
+	// AllowUnsafeSettings is set.
+	AllowSchemes []string
+
+	// If true, requests may disable webSecurityEnabled or enable
+	// localToRemoteUrlAccessEnabled.
+	AllowUnsafeSettings bool
+
+	once    sync.Once
+	mux     *http.ServeMux
+	queue   chan struct{} // waiting & running requests
+	workers chan struct{} // running requests
+	running int64
+}
+
+// NewServer returns a new instance of Server with default settings.
+// Settings must be changed before the server handles its first request.
+func NewServer(pages PageCreator) *Server {
+	s := &Server{
+		Pages:      pages,
+		Workers:    DefaultWorkers,
+		QueueSize:  DefaultQueueSize,
+		Timeout:    DefaultTimeout,
+		MaxTimeout: DefaultMaxTimeout,
+		MaxBody:    DefaultMaxBody,
+	}
+
+	s.mux = http.NewServeMux()
+	s.mux.HandleFunc("/render", s.handleRender)
+	s.mux.HandleFunc("/evaluate", s.handleEvaluate)
+	s.mux.HandleFunc("/healthz", s.handleHealthz)
+	return s
+}
+
+// ServeHTTP dispatches requests to their handlers.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.once.Do(func() {
+		s.queue = make(chan struct{}, s.Workers+s.QueueSize)
+		s.workers = make(chan struct{}, s.Workers)
+	})
+	s.mux.ServeHTTP(w, r)
+}
+
+// PageRequest represents the page options shared by all requests.
+type PageRequest struct {
+	// Page to load. Either URL or HTML must be set. Relative references in
+	// HTML are resolved against BaseURL, if set.
+	URL     string `json:"url"`
+	HTML    string `json:"html"`
+	BaseURL string `json:"baseURL"`
+
+	// Viewport size, in pixels.
+	Viewport *struct {
+		Width  int `json:"width"`
+		Height int `json:"height"`
+	} `json:"viewport"`
+
+	// Page settings applied before loading. Unset fields keep their defaults.
+	Settings json.RawMessage `json:"settings"`
+
+	// Headers sent with each request made by the page.
+	Headers map[string]string `json:"headers"`
+
+	// If set, waits for an element matching the selector after loading.
+	WaitFor string `json:"waitFor"`
+
+	// Time to wait after loading, in milliseconds.
+	Delay int `json:"delay"`
+
+	// Request timeout, in milliseconds. Capped at the server's maximum.
+	Timeout int `json:"timeout"`
+
+	// If true, URLs are opened with all resources, including stylesheets
+	// and images. Set by handlers which render the page.
+	loadAll bool
+}
+
+// RenderRequest represents the body of a render request.
+type RenderRequest struct {
+	PageRequest
+
+	// Image format and padding. Format is "png", "jpeg" or "pdf".
+	Render phantomjs.RenderOptions `json:"render"`
+
+	// JPEG quality, 1-100. Uses the PhantomJS default if zero.
+	Quality int `json:"quality"`
+
+	// If set, renders only the first element matching the selector.
+	Selector string `json:"selector"`
+
+	// If true, renders the entire document instead of the viewport.
+	FullPage bool `json:"fullPage"`
+
+	// Size, margins, header & footer of PDF output.
+	PaperSize *phantomjs.PaperSize `json:"paperSize"`
+}
+
+// EvaluateRequest represents the body of an evaluate request.
+type EvaluateRequest struct {
+	PageRequest
+
+	// JavaScript function evaluated in the page. Args are passed to the
+	// function in order.
+	Script string        `json:"script"`
+	Args   []interface{} `json:"args"`
+}
+
+// handleRender renders a page and writes the image or PDF.
+func (s *Server) handleRender(w http.ResponseWriter, r *http.Request) {
+	var req RenderRequest
+	if !s.decode(w, r, &req) {
+		return
+	}
+
+	format := strings.ToLower(req.Render.Format)
+	switch format {
+	case "":
+		format = "png"
+	case "jpg":
+		format = "jpeg"
+	case "png", "jpeg", "pdf":
+	default:
+		s.writeError(w, http.StatusBadRequest, fmt.Errorf("unsupported format: %q", req.Render.Format))
+		return
+	}
+	if format == "pdf" && req.Selector != "" {
+		s.writeError(w, http.StatusBadRequest, errors.New("selector cannot be used with pdf output"))
+		return
+	}
+	req.Render.Format = format
+	req.loadAll = true
+
+	var data []byte
+	if !s.do(w, r, &req.PageRequest, func(ctx context.Context, page *phantomjs.WebPage) (err error) {
+		data, err = render(page, &req)
+		return err
+	}) {
+		return
+	}
+
+	w.Header().Set("Content-Type", contentTypes[format])
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.Write(data)
+}
+
+// contentTypes maps render formats to their media types.
+var contentTypes = map[string]string{
+	"png":  "image/png",
+	"jpeg": "image/jpeg",
+	"pdf":  "application/pdf",
+}
+
+// render applies the render options to a loaded page and returns the output.
+func render(page *phantomjs.WebPage, req *RenderRequest) ([]byte, error) {
+	if req.PaperSize != nil {
+		if err := page.SetPaperSize(*req.PaperSize); err != nil {
+			return nil, err
+		}
+	}
+	if req.Selector != "" {
+		return page.ScreenshotElement(req.Selector, req.Render)
+	}
+
+	// Clip images to the viewport unless rendering the full page.
+	if req.Render.Format != "pdf" && !req.FullPage {
+		w, h, err := page.ViewportSize()
+		if err != nil {
+			return nil, err
+		} else if err := page.SetClipRect(phantomjs.Rect{Width: w, Height: h}); err != nil {
+			return nil, err
+		}
+	}
+
+	// Render to a file only when required by the format or quality.
+	if req.Render.Format == "pdf" || req.Quality > 0 {
+		return page.RenderBytes(req.Render.Format, req.Quality)
+	}
+	s, err := page.RenderBase64(req.Render.Format)
+	if err != nil {
+		return nil, err
+	}
+	return base64.StdEncoding.DecodeString(s)
+}
+
+// handleEvaluate evaluates a script in a page and writes the result as JSON.
+func (s *Server) handleEvaluate(w http.ResponseWriter, r *http.Request) {
+	var req EvaluateRequest
+	if !s.decode(w, r, &req) {
+		return
+	} else if strings.TrimSpace(req.Script) == "" {
+		s.writeError(w, http.StatusBadRequest, ErrMissingScript)
+		return
+	}
+
+	args, err := json.Marshal(req.Args)
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, err)
+		return
+	} else if req.Args == nil {
+		args = []byte("[]")
+	}
+	script := fmt.Sprintf("function() { return (%s).apply(null, %s); }", req.Script, args)
+
+	var result interface{}
+	if !s.do(w, r, &req.PageRequest, func(ctx context.Context, page *phantomjs.WebPage) (err error) {
+		result, err = page.Evaluate(script)
+		return err
+	}) {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"result": result})
+}
+
+// handleHealthz reports the number of running and queued requests.
+func (s *Server) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" && r.Method != "HEAD" {
+		w.Header().Set("Allow", "GET, HEAD")
+		s.writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+
+	running := atomic.LoadInt64(&s.running)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":  "ok",
+		"running": running,
+		"queued":  int64(len(s.queue)) - running,
+	})
+}
+
+// decode reads a JSON request body into v. Writes an error response and
+// returns false if the request is invalid.
+func (s *Server) decode(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if r.Method != "POST" {
+		w.Header().Set("Allow", "POST")
+		s.writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return false
+	}
+
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, s.MaxBody))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		s.writeError(w, http.StatusBadRequest, fmt.Errorf("invalid request: %s", err))
+		return false
+	}
+	return true
+}
+
+// do waits for a worker, loads a new page and calls fn with it. Writes an
+// error response and returns false on failure.
+//
+// PhantomJS calls cannot be cancelled so a timed out request keeps its
+// worker until its calls complete. This keeps the number of pages bounded
+// even when requests time out.
+func (s *Server) do(w http.ResponseWriter, r *http.Request, req *PageRequest, fn func(context.Context, *phantomjs.WebPage) error) bool {
+	if req.URL == "" && req.HTML == "" {
+		s.writeError(w, http.StatusBadRequest, ErrMissingSource)
+		return false
+	} else if req.URL != "" && req.HTML != "" {
+		s.writeError(w, http.StatusBadRequest, ErrAmbiguousSource)
+		return false
+	} else if err := s.validate(req); err != nil {
+		s.writeError(w, http.StatusBadRequest, err)
+		return false
+	}
+
+	timeout := s.Timeout
+	if req.Timeout > 0 {
+		timeout = time.Duration(req.Timeout) * time.Millisecond
+	}
+	if s.MaxTimeout > 0 && timeout > s.MaxTimeout {
+		timeout = s.MaxTimeout
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	defer cancel()
+
+	// Reject the request if the queue is full.
+	select {
+	case s.queue <- struct{}{}:
+	default:
+		w.Header().Set("Retry-After", "1")
+		s.writeError(w, http.StatusServiceUnavailable, ErrOverloaded)
+		return false
+	}
+
+	// Wait for a worker.
+	select {
+	case s.workers <- struct{}{}:
+	case <-ctx.Done():
+		<-s.queue
+		s.writeContextError(w, ctx)
+		return false
+	}
+	atomic.AddInt64(&s.running, 1)
+
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			atomic.AddInt64(&s.running, -1)
+			<-s.workers
+			<-s.queue
+		}()
+		done <- s.run(ctx, req, fn)
+	}()
+
+	select {
+	case err := <-done:
+		if err == context.DeadlineExceeded || err == context.Canceled {
+			s.writeContextError(w, ctx)
+			return false
+		} else if err != nil {
+			s.writeError(w, http.StatusBadGateway, err)
+			return false
+		}
+		return true
+	case <-ctx.Done():
+		s.writeContextError(w, ctx)
+		return false
+	}
+}
+
+// validate returns an error if the request loads a URL with a disallowed
+// scheme or has invalid or unsafe settings.
+func (s *Server) validate(req *PageRequest) error {
+	for _, rawurl := range []string{req.URL, req.BaseURL} {
+		if rawurl == "" {
+			continue
+		}
+		u, err := url.Parse(rawurl)
+		if err != nil {
+			return fmt.Errorf("invalid url: %s", err)
+		} else if !s.schemeAllowed(u.Scheme) {
+			return ErrSchemeDenied
+		}
+	}
+
+	if len(req.Settings) > 0 {
+		v := pageSettings{WebPageSettings: phantomjs.WebPageSettings{WebSecurityEnabled: true}}
+		if err := decodeSettings(req.Settings, &v); err != nil {
+			return err
+		} else if !s.AllowUnsafeSettings && (!v.WebSecurityEnabled || v.LocalToRemoteURLAccessEnabled) {
+			return ErrUnsafeSettings
+		}
+	}
+	return nil
+}
+
+// schemeAllowed returns true if URLs with scheme may be loaded.
+func (s *Server) schemeAllowed(scheme string) bool {
+	if strings.EqualFold(scheme, "http") || strings.EqualFold(scheme, "https") {
+		return true
+	}
+	for _, allowed := range s.AllowSchemes {
+		if strings.EqualFold(scheme, allowed) {
+			return true
+		}
+	}
+	return false
+}
+
+// run creates and loads a page, calls fn and closes the page.
+func (s *Server) run(ctx context.Context, req *PageRequest, fn func(context.Context, *phantomjs.WebPage) error) error {
+	page, err := s.Pages.CreateWebPage()
+	if err != nil {
+		return err
+	}
+	defer page.Close()
+
+	if err := load(ctx, page, req); err != nil {
+		return err
+	} else if err := ctx.Err(); err != nil {
+		return err
+	}
+	return fn(ctx, page)
+}
+
+// load configures the page and loads its content.
+func load(ctx context.Context, page *phantomjs.WebPage, req *PageRequest) error {
+	if req.Viewport != nil {
+		if err := page.SetViewportSize(req.Viewport.Width, req.Viewport.Height); err != nil {
+			return err
+		}
+	}
+	if len(req.Settings) > 0 {
+		if err := applySettings(page, req.Settings); err != nil {
+			return err
+		}
+	}
+	if len(req.Headers) > 0 {
+		header := make(http.Header)
+		for k, v := range req.Headers {
+			header.Set(k, v)
+		}
+		if err := page.SetCustomHeaders(header); err != nil {
+			return err
+		}
+	}
+
+	if req.URL != "" {
+		open := page.Open
+		if req.loadAll {
+			open = page.OpenAll
+		}
+		if err := open(req.URL); err != nil {
+			return fmt.Errorf("cannot open %s: %w", req.URL, err)
+		}
+	} else if req.BaseURL != "" {
+		if err := page.SetContentAndURL(req.HTML, req.BaseURL); err != nil {
+			return err
+		}
+	} else if err := page.SetContent(req.HTML); err != nil {
+		return err
+	}
+
+	if req.WaitFor != "" {
+		if err := page.WaitForSelector(ctx, req.WaitFor); err != nil {
+			return err
+		}
+	}
+	if req.Delay > 0 {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Duration(req.Delay) * time.Millisecond):
+		}
+	}
+	return nil
+}
+
+// applySettings merges settings from the request into the page's current
+// settings. ResourceTimeout is given in milliseconds.
+func applySettings(page *phantomjs.WebPage, data json.RawMessage) error {
+	current, err := page.Settings()
+	if err != nil {
+		return err
+	}
+
+	v := pageSettings{
+		WebPageSettings: current,
+		ResourceTimeout: int(current.ResourceTimeout / time.Millisecond),
+	}
+	if err := decodeSettings(data, &v); err != nil {
+		return err
+	}
+	v.WebPageSettings.ResourceTimeout = time.Duration(v.ResourceTimeout) * time.Millisecond
+	return page.SetSettings(v.WebPageSettings)
+}
+
+// pageSettings represents the settings in a request.
+type pageSettings struct {
+	phantomjs.WebPageSettings
+	ResourceTimeout int `json:"resourceTimeout"` // shadows the embedded field
+}
+
+// decodeSettings decodes request settings into v. Unknown fields are
+// rejected, as they are in the rest of the request.
+func decodeSettings(data json.RawMessage, v *pageSettings) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return fmt.Errorf("invalid settings: %s", err)
+	}
+	return nil
+}
+
+// writeContextError writes the response for a timed out or cancelled request.
+func (s *Server) writeContextError(w http.ResponseWriter, ctx context.Context) {
+	if ctx.Err() == context.DeadlineExceeded {
+		s.writeError(w, http.StatusGatewayTimeout, ErrTimeout)
+		return
+	}
+	s.writeError(w, http.StatusServiceUnavailable, ctx.Err())
+}
+
+// writeError writes an error as a JSON response.
+func (s *Server) writeError(w http.ResponseWriter, status int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kere/phantomjs"
+	"github.com/kere/phantomjs/phantomjsfake"
+)
+
+// Ensure a URL can be rendered to an image.
+func TestServer_Render(t *testing.T) {
+	s, fake := MustNewServer(t)
+	fake.HandleOpen("http://example.com/", phantomjsfake.Document{Content: "<html></html>"})
+	fake.HandleRender("png", base64.StdEncoding.EncodeToString([]byte("PNG")))
+
+	w := Do(s, "POST", "/render", `{"url":"http://example.com/","viewport":{"width":320,"height":240},"settings":{"userAgent":"phantomd","resourceTimeout":500}}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("unexpected status: %d %s", w.Code, w.Body)
+	} else if ct := w.Header().Get("Content-Type"); ct != "image/png" {
+		t.Fatalf("unexpected content type: %s", ct)
+	} else if w.Body.String() != "PNG" {
+		t.Fatalf("unexpected body: %q", w.Body)
+	}
+
+	// Verify the page was opened with all resources, configured and clipped
+	// to the viewport.
+	if calls := fake.CallsTo("/webpage/Open"); len(calls) != 1 || calls[0].Body["all"] != true {
+		t.Fatalf("unexpected open calls: %v", calls)
+	} else if calls := fake.CallsTo("/webpage/SetClipRect"); len(calls) != 1 {
+		t.Fatalf("unexpected clip rect calls: %d", len(calls))
+	}
+	calls := fake.CallsTo("/webpage/SetSettings")
+	if len(calls) != 1 {
+		t.Fatalf("unexpected settings calls: %d", len(calls))
+	} else if settings := calls[0].Body["settings"].(map[string]interface{}); settings["userAgent"] != "phantomd" || settings["resourceTimeout"] != float64(500) {
+		t.Fatalf("unexpected settings: %v", settings)
+	}
+
+	// Pages should be closed after each request.
+	if pages := fake.Pages(); len(pages) != 0 {
+		t.Fatalf("unexpected open pages: %d", len(pages))
+	}
+}
+
+// Ensure a page which cannot be opened returns a 502.
+func TestServer_Render_OpenError(t *testing.T) {
+	s, _ := MustNewServer(t)
+	if w := Do(s, "POST", "/render", `{"url":"http://example.com/missing"}`); w.Code != http.StatusBadGateway {
+		t.Fatalf("unexpected status: %d %s", w.Code, w.Body)
+	} else if !strings.Contains(w.Body.String(), "cannot open http://example.com/missing: ") {
+		t.Fatalf("unexpected body: %s", w.Body)
+	}
+}
+
+// Ensure invalid requests return a 400.
+func TestServer_Render_BadRequest(t *testing.T) {
+	s, _ := MustNewServer(t)
+	for _, body := range []string{
+		`{}`,
+		`{"url":"http://example.com","html":"<p>"}`,
+		`{"url":"http://example.com","render":{"format":"gif"}}`,
+		`{"url":"http://example.com","render":{"format":"pdf"},"selector":"#main"}`,
+		`{"url":"http://example.com","unknown":true}`,
+		`not json`,
+	} {
+		if w := Do(s, "POST", "/render", body); w.Code != http.StatusBadRequest {
+			t.Errorf("unexpected status for %s: %d", body, w.Code)
+		}
+	}
+	if w := Do(s, "GET", "/render", ""); w.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("unexpected status: %d", w.Code)
+	}
+}
+
+// Ensure URLs with schemes other than http and https are only loaded when
+// allowed.
+func TestServer_Render_Scheme(t *testing.T) {
+	s, fake := MustNewServer(t)
+	fake.HandleOpen("file:///etc/passwd", phantomjsfake.Document{Content: "<html></html>"})
+	for _, body := range []string{
+		`{"url":"file:///etc/passwd"}`,
+		`{"html":"<p>","baseURL":"file:///etc/"}`,
+		`{"url":"javascript:alert(1)"}`,
+	} {
+		if w := Do(s, "POST", "/render", body); w.Code != http.StatusBadRequest {
+			t.Errorf("unexpected status for %s: %d", body, w.Code)
+		}
+	}
+	if calls := fake.CallsTo("/webpage/Create"); len(calls) != 0 {
+		t.Fatalf("unexpected page creates: %d", len(calls))
+	}
+
+	s.AllowSchemes = []string{"file"}
+	if w := Do(s, "POST", "/render", `{"url":"file:///etc/passwd"}`); w.Code != http.StatusOK {
+		t.Fatalf("unexpected status: %d %s", w.Code, w.Body)
+	}
+}
+
+// Ensure settings cannot relax web security unless allowed and unknown
+// settings are rejected.
+func TestServer_Render_Settings(t *testing.T) {
+	s, fake := MustNewServer(t)
+	fake.HandleOpen("http://example.com/", phantomjsfake.Document{Content: "<html></html>"})
+	for _, body := range []string{
+		`{"url":"http://example.com/","settings":{"webSecurityEnabled":false}}`,
+		`{"url":"http://example.com/","settings":{"localToRemoteUrlAccessEnabled":true}}`,
+		`{"url":"http://example.com/","settings":{"unknown":true}}`,
+	} {
+		if w := Do(s, "POST", "/render", body); w.Code != http.StatusBadRequest {
+			t.Errorf("unexpected status for %s: %d", body, w.Code)
+		}
+	}
+
+	s.AllowUnsafeSettings = true
+	if w := Do(s, "POST", "/render", `{"url":"http://example.com/","settings":{"webSecurityEnabled":false}}`); w.Code != http.StatusOK {
+		t.Fatalf("unexpected status: %d %s", w.Code, w.Body)
+	} else if w := Do(s, "POST", "/render", `{"url":"http://example.com/","settings":{"unknown":true}}`); w.Code != http.StatusBadRequest {
+		t.Fatalf("unexpected status: %d", w.Code)
+	}
+}
+
+// Ensure a script can be evaluated with arguments.
+func TestServer_Evaluate(t *testing.T) {
+	s, fake := MustNewServer(t)
+	fake.EvaluateFunc = func(page *phantomjsfake.Page, script string) (interface{}, error) {
+		if page.Content != "<p>hi</p>" {
+			t.Fatalf("unexpected content: %s", page.Content)
+		} else if !strings.Contains(script, "(function(a, b) { return a + b; }).apply(null, [1,2])") {
+			t.Fatalf("unexpected script: %s", script)
+		}
+		return 3, nil
+	}
+
+	w := Do(s, "POST", "/evaluate", `{"html":"<p>hi</p>","script":"function(a, b) { return a + b; }","args":[1,2]}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("unexpected status: %d %s", w.Code, w.Body)
+	} else if strings.TrimSpace(w.Body.String()) != `{"result":3}` {
+		t.Fatalf("unexpected body: %s", w.Body)
+	}
+}
+
+// Ensure evaluation waits for the selector and opens the page without
+// stylesheets & images.
+func TestServer_Evaluate_WaitFor(t *testing.T) {
+	s, fake := MustNewServer(t)
+	fake.HandleOpen("http://example.com/", phantomjsfake.Document{Content: "<html></html>"})
+
+	var n int
+	fake.EvaluateFunc = func(page *phantomjsfake.Page, script string) (interface{}, error) {
+		if strings.Contains(script, "querySelector(selector)") {
+			if !strings.Contains(script, `"a[title=\"\u003cx\u003e\"]"`) {
+				t.Fatalf("unexpected script: %s", script)
+			}
+			n++
+			return n > 1, nil
+		}
+		return "ok", nil
+	}
+
+	w := Do(s, "POST", "/evaluate", `{"url":"http://example.com/","waitFor":"a[title=\"<x>\"]","script":"function() {}"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("unexpected status: %d %s", w.Code, w.Body)
+	} else if n != 2 {
+		t.Fatalf("unexpected selector checks: %d", n)
+	} else if calls := fake.CallsTo("/webpage/Open"); len(calls) != 1 || calls[0].Body["all"] != nil {
+		t.Fatalf("unexpected open calls: %v", calls)
+	}
+}
+
+// Ensure requests are rejected when the queue is full.
+func TestServer_Overloaded(t *testing.T) {
+	s, fake := MustNewServer(t)
+	s.Workers, s.QueueSize = 1, 0
+
+	started, release := make(chan struct{}), make(chan struct{})
+	fake.EvaluateFunc = func(page *phantomjsfake.Page, script string) (interface{}, error) {
+		close(started)
+		<-release
+		return nil, nil
+	}
+
+	done := make(chan int)
+	go func() { done <- Do(s, "POST", "/evaluate", `{"html":"<p>","script":"function() {}"}`).Code }()
+	<-started
+
+	if w := Do(s, "POST", "/evaluate", `{"html":"<p>","script":"function() {}"}`); w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("unexpected status: %d", w.Code)
+	} else if w.Header().Get("Retry-After") == "" {
+		t.Fatal("expected Retry-After header")
+	}
+
+	close(release)
+	if code := <-done; code != http.StatusOK {
+		t.Fatalf("unexpected status: %d", code)
+	}
+}
+
+// Ensure requests which exceed their timeout return a 504.
+func TestServer_Timeout(t *testing.T) {
+	s, fake := MustNewServer(t)
+
+	release := make(chan struct{})
+	defer close(release)
+	fake.EvaluateFunc = func(page *phantomjsfake.Page, script string) (interface{}, error) {
+		<-release
+		return nil, nil
+	}
+
+	start := time.Now()
+	if w := Do(s, "POST", "/evaluate", `{"html":"<p>","script":"function() {}","timeout":50}`); w.Code != http.StatusGatewayTimeout {
+		t.Fatalf("unexpected status: %d %s", w.Code, w.Body)
+	} else if d := time.Since(start); d > 5*time.Second {
+		t.Fatalf("timeout not enforced: %s", d)
+	}
+}
+
+// Ensure the health check reports request counts.
+func TestServer_Healthz(t *testing.T) {
+	s, _ := MustNewServer(t)
+	w := Do(s, "GET", "/healthz", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("unexpected status: %d", w.Code)
+	}
+	var v map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &v); err != nil {
+		t.Fatal(err)
+	} else if v["status"] != "ok" || v["running"] != float64(0) || v["queued"] != float64(0) {
+		t.Fatalf("unexpected body: %v", v)
+	}
+}
+
+// MustNewServer returns a server backed by a fake process.
+func MustNewServer(tb testing.TB) (*Server, *phantomjsfake.Handler) {
+	fake := phantomjsfake.NewHandler()
+	srv := httptest.NewServer(fake)
+	tb.Cleanup(srv.Close)
+
+	p := phantomjs.NewProcess()
+	p.BaseURL = srv.URL
+	return NewServer(p), fake
+}
+
+// Do executes a request against s and returns the recorded response.
+func Do(s *Server, method, path, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest(method, path, strings.NewReader(body)))
+	return w
+}
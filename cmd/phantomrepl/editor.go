@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// ErrInterrupt is returned by ReadLine when the user presses Ctrl-C.
+var ErrInterrupt = errors.New("interrupt")
+
+// MaxHistory is the maximum number of lines kept in the history.
+const MaxHistory = 1000
+
+// LineEditor reads lines from a terminal with basic editing and history.
+// If the input is not a terminal, or raw mode is unsupported on the platform,
+// lines are read without editing.
+type LineEditor struct {
+	in  *os.File
+	r   *bufio.Reader
+	out io.Writer
+
+	history []string
+}
+
+// NewLineEditor returns a new instance of LineEditor.
+func NewLineEditor(in *os.File, out io.Writer) *LineEditor {
+	return &LineEditor{in: in, r: bufio.NewReader(in), out: out}
+}
+
+// History returns the lines added to the history, oldest first.
+func (e *LineEditor) History() []string {
+	return e.history
+}
+
+// AddHistory appends a line to the history. Blank lines and lines repeating
+// the previous line are ignored.
+func (e *LineEditor) AddHistory(line string) {
+	if strings.TrimSpace(line) == "" {
+		return
+	} else if n := len(e.history); n > 0 && e.history[n-1] == line {
+		return
+	}
+	e.history = append(e.history, line)
+	if len(e.history) > MaxHistory {
+		e.history = e.history[len(e.history)-MaxHistory:]
+	}
+}
+
+// ReadLine writes the prompt and returns the next line without its newline.
+// Returns io.EOF when the input ends or the user presses Ctrl-D on an empty
+// line.
+func (e *LineEditor) ReadLine(prompt string) (string, error) {
+	restore, err := makeRaw(e.in)
+	if err != nil {
+		return e.readPlain(prompt)
+	}
+	defer restore()
+	return e.edit(prompt)
+}
+
+// readPlain reads a line without editing.
+func (e *LineEditor) readPlain(prompt string) (string, error) {
+	fmt.Fprint(e.out, prompt)
+	line, err := e.r.ReadString('\n')
+	if err == io.EOF && line != "" {
+		err = nil
+	}
+	return strings.TrimRight(line, "\r\n"), err
+}
+
+// edit reads a line from a terminal in raw mode, handling editing keys.
+func (e *LineEditor) edit(prompt string) (string, error) {
+	var buf []rune
+	pos := 0
+
+	// Index into the history while browsing. The line being edited is kept
+	// so it can be restored when moving past the newest entry.
+	hpos, saved := len(e.history), ""
+
+	redraw := func() {
+		fmt.Fprintf(e.out, "\r%s%s\x1b[K", prompt, string(buf))
+		if n := len(buf) - pos; n > 0 {
+			fmt.Fprintf(e.out, "\x1b[%dD", n)
+		}
+	}
+	recall := func(i int) {
+		if i < 0 || i > len(e.history) {
+			return
+		} else if hpos == len(e.history) {
+			saved = string(buf)
+		}
+		hpos = i
+		if hpos == len(e.history) {
+			buf = []rune(saved)
+		} else {
+			buf = []rune(e.history[hpos])
+		}
+		pos = len(buf)
+	}
+
+	fmt.Fprint(e.out, prompt)
+	for {
+		ch, _, err := e.r.ReadRune()
+		if err != nil {
+			return "", err
+		}
+
+		switch ch {
+		case '\r', '\n':
+			fmt.Fprint(e.out, "\r\n")
+			return string(buf), nil
+		case 3: // Ctrl-C
+			fmt.Fprint(e.out, "^C\r\n")
+			return "", ErrInterrupt
+		case 4: // Ctrl-D
+			if len(buf) == 0 {
+				fmt.Fprint(e.out, "\r\n")
+				return "", io.EOF
+			} else if pos < len(buf) {
+				buf = append(buf[:pos], buf[pos+1:]...)
+			}
+		case 127, 8: // Backspace
+			if pos > 0 {
+				buf = append(buf[:pos-1], buf[pos:]...)
+				pos--
+			}
+		case 1: // Ctrl-A
+			pos = 0
+		case 5: // Ctrl-E
+			pos = len(buf)
+		case 2: // Ctrl-B
+			if pos > 0 {
+				pos--
+			}
+		case 6: // Ctrl-F
+			if pos < len(buf) {
+				pos++
+			}
+		case 11: // Ctrl-K
+			buf = buf[:pos]
+		case 21: // Ctrl-U
+			buf, pos = buf[pos:], 0
+		case 16: // Ctrl-P
+			recall(hpos - 1)
+		case 14: // Ctrl-N
+			recall(hpos + 1)
+		case 27: // Escape sequence
+			seq := e.readEscape()
+			switch seq {
+			case "[A":
+				recall(hpos - 1)
+			case "[B":
+				recall(hpos + 1)
+			case "[C":
+				if pos < len(buf) {
+					pos++
+				}
+			case "[D":
+				if pos > 0 {
+					pos--
+				}
+			case "[H", "[1~", "OH":
+				pos = 0
+			case "[F", "[4~", "OF":
+				pos = len(buf)
+			case "[3~":
+				if pos < len(buf) {
+					buf = append(buf[:pos], buf[pos+1:]...)
+				}
+			}
+		default:
+			if ch < 32 {
+				continue
+			}
+			buf = append(buf[:pos], append([]rune{ch}, buf[pos:]...)...)
+			pos++
+		}
+		redraw()
+	}
+}
+
+// readEscape reads the remainder of an escape sequence, such as "[A" for the
+// up arrow.
+func (e *LineEditor) readEscape() string {
+	var seq []byte
+	for len(seq) < 8 {
+		b, err := e.r.ReadByte()
+		if err != nil {
+			break
+		}
+		seq = append(seq, b)
+
+		// Sequences end with a letter or "~" after the "[" or "O" prefix.
+		if len(seq) > 1 && (b == '~' || (b >= 'A' && b <= 'Z') || (b >= 'a' && b <= 'z')) {
+			break
+		} else if len(seq) == 1 && b != '[' && b != 'O' {
+			break
+		}
+	}
+	return string(seq)
+}
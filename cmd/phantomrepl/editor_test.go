@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+// Ensure editing keys modify the line.
+func TestLineEditor_Edit(t *testing.T) {
+	for _, tt := range []struct {
+		input string
+		exp   string
+	}{
+		{"abc\r", "abc"},
+		{"abc\x7f\x7fd\r", "ad"},
+		{"bc\x01a\r", "abc"},
+		{"ac\x1b[Db\r", "abc"},
+		{"abc\x1b[D\x1b[D\x0b\r", "a"},
+		{"abc\x1b[D\x15\r", "c"},
+		{"ab\x1b[D\x1b[3~\r", "a"},
+		{"héllo\x7f\r", "héll"},
+	} {
+		if line, err := NewTestLineEditor(tt.input).edit("> "); err != nil {
+			t.Errorf("%q: %s", tt.input, err)
+		} else if line != tt.exp {
+			t.Errorf("%q: unexpected line: %q", tt.input, line)
+		}
+	}
+}
+
+// Ensure history can be browsed with the arrow keys.
+func TestLineEditor_Edit_History(t *testing.T) {
+	e := NewTestLineEditor("\x1b[A\x1b[A\r" + "par\x1b[A\x1b[B\r")
+	e.AddHistory("first")
+	e.AddHistory("second")
+	e.AddHistory("second")
+
+	if line, _ := e.edit("> "); line != "first" {
+		t.Fatalf("unexpected line: %q", line)
+	} else if line, _ := e.edit("> "); line != "par" {
+		t.Fatalf("unexpected line: %q", line)
+	} else if h := e.History(); len(h) != 2 {
+		t.Fatalf("unexpected history: %q", h)
+	}
+}
+
+// Ensure Ctrl-C interrupts and Ctrl-D on an empty line ends input.
+func TestLineEditor_Edit_Control(t *testing.T) {
+	if _, err := NewTestLineEditor("abc\x03").edit("> "); err != ErrInterrupt {
+		t.Fatalf("unexpected error: %v", err)
+	} else if _, err := NewTestLineEditor("\x04").edit("> "); err != io.EOF {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+// NewTestLineEditor returns an editor reading keys from input.
+func NewTestLineEditor(input string) *LineEditor {
+	e := NewLineEditor(nil, &bytes.Buffer{})
+	e.r.Reset(strings.NewReader(input))
+	return e
+}
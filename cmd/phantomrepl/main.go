@@ -0,0 +1,151 @@
+// Command phantomrepl opens a web page and executes commands against it
+// interactively.
+//
+// Usage:
+//
+//	phantomrepl [flags] [URL]
+//
+// Built-in commands include "open <url>", "eval <js>", "title", "content",
+// "cookies", "frame <name>", "click <selector>", "shot <file>" and
+// "settings". Any other command calls the WebPage method of the same name
+// with space separated arguments, such as "SetViewportSize 1024 768".
+// Structs, maps and slices are given as JSON. Type "help" for a full list.
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/kere/phantomjs"
+)
+
+func main() {
+	m := NewMain()
+	if err := m.Run(context.Background(), os.Args[1:]...); err == flag.ErrHelp {
+		os.Exit(2)
+	} else if err != nil {
+		fmt.Fprintln(m.Stderr, "phantomrepl:", err)
+		os.Exit(1)
+	}
+}
+
+// Main represents the program.
+type Main struct {
+	Port        int
+	BinPath     string
+	HistoryPath string
+
+	Stdin  *os.File
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
+// NewMain returns a new instance of Main with default settings.
+func NewMain() *Main {
+	m := &Main{
+		Port:    phantomjs.DefaultPort,
+		BinPath: phantomjs.DefaultBinPath,
+		Stdin:   os.Stdin,
+		Stdout:  os.Stdout,
+		Stderr:  os.Stderr,
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		m.HistoryPath = filepath.Join(home, ".phantomrepl_history")
+	}
+	return m
+}
+
+// Run starts a process, opens a page and executes commands until the input
+// ends or the user quits.
+func (m *Main) Run(ctx context.Context, args ...string) error {
+	fs := flag.NewFlagSet("phantomrepl", flag.ContinueOnError)
+	fs.SetOutput(m.Stderr)
+	fs.IntVar(&m.Port, "port", m.Port, "port of the phantomjs process")
+	fs.StringVar(&m.BinPath, "phantomjs", m.BinPath, "path to the phantomjs binary")
+	fs.StringVar(&m.HistoryPath, "history", m.HistoryPath, "history file; disabled if blank")
+	if err := fs.Parse(args); err != nil {
+		return err
+	} else if fs.NArg() > 1 {
+		return fmt.Errorf("unexpected arguments: %v", fs.Args()[1:])
+	}
+
+	p := phantomjs.NewProcess()
+	p.Port = m.Port
+	p.BinPath = m.BinPath
+	if err := p.Open(); err != nil {
+		return fmt.Errorf("cannot start phantomjs: %s", err)
+	}
+	defer p.Close()
+
+	page, err := p.CreateWebPage()
+	if err != nil {
+		return err
+	}
+	defer page.Close()
+
+	r := &REPL{Page: page, Stdout: m.Stdout}
+	if fs.NArg() == 1 {
+		if err := r.Exec("open " + fs.Arg(0)); err != nil {
+			return err
+		}
+	}
+
+	editor := NewLineEditor(m.Stdin, m.Stdout)
+	history, err := m.openHistory(editor)
+	if err != nil {
+		fmt.Fprintln(m.Stderr, "phantomrepl: history disabled:", err)
+	} else if history != nil {
+		defer history.Close()
+	}
+
+	for ctx.Err() == nil {
+		line, err := editor.ReadLine("phantom> ")
+		if err == ErrInterrupt {
+			continue
+		} else if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		editor.AddHistory(line)
+		if history != nil && line != "" {
+			fmt.Fprintln(history, line)
+		}
+
+		if err := r.Exec(line); err == ErrQuit {
+			return nil
+		} else if err != nil {
+			fmt.Fprintln(m.Stderr, "error:", err)
+		}
+	}
+	return ctx.Err()
+}
+
+// openHistory loads the history file into the editor and returns it opened
+// for appending. Returns nil if history is disabled.
+func (m *Main) openHistory(editor *LineEditor) (*os.File, error) {
+	if m.HistoryPath == "" {
+		return nil, nil
+	}
+
+	f, err := os.OpenFile(m.HistoryPath, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		editor.AddHistory(scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
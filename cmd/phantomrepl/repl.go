@@ -0,0 +1,486 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/kere/phantomjs"
+)
+
+// ErrQuit is returned by Exec when the user asks to quit.
+var ErrQuit = errors.New("quit")
+
+// REPL executes commands against a single web page.
+type REPL struct {
+	Page   *phantomjs.WebPage
+	Stdout io.Writer
+}
+
+// command represents a built-in command. Built-in commands receive the rest
+// of the line unparsed.
+type command struct {
+	usage string
+	fn    func(r *REPL, arg string) error
+}
+
+// commands holds the built-in commands, keyed by name.
+var commands map[string]command
+
+func init() {
+	commands = map[string]command{
+		"open":     {"open <url>", (*REPL).open},
+		"eval":     {"eval <js>", (*REPL).eval},
+		"title":    {"title", (*REPL).title},
+		"content":  {"content", (*REPL).content},
+		"cookies":  {"cookies", (*REPL).cookies},
+		"frame":    {"frame [<name>|..]", (*REPL).frame},
+		"click":    {"click <selector>", (*REPL).click},
+		"shot":     {"shot <file>", (*REPL).shot},
+		"settings": {"settings", (*REPL).settings},
+		"help":     {"help", (*REPL).help},
+		"quit":     {"quit", func(*REPL, string) error { return ErrQuit }},
+	}
+}
+
+// Exec executes a single line. Built-in commands are matched first and any
+// other command is called as the WebPage method of the same name, ignoring
+// case, with arguments parsed from the line.
+func (r *REPL) Exec(line string) error {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return nil
+	}
+
+	name, arg := line, ""
+	if i := strings.IndexAny(line, " \t"); i >= 0 {
+		name, arg = line[:i], strings.TrimSpace(line[i+1:])
+	}
+
+	if cmd, ok := commands[strings.ToLower(name)]; ok {
+		return cmd.fn(r, arg)
+	} else if strings.EqualFold(name, "exit") {
+		return ErrQuit
+	}
+	return r.call(name, arg)
+}
+
+// open opens a URL in the page, loading all resources as a browser would.
+func (r *REPL) open(arg string) error {
+	if arg == "" {
+		return errors.New("usage: open <url>")
+	}
+	return r.Page.OpenAll(arg)
+}
+
+// eval evaluates a JavaScript function or expression and prints the result.
+func (r *REPL) eval(arg string) error {
+	if arg == "" {
+		return errors.New("usage: eval <js>")
+	}
+
+	script := arg
+	if !strings.HasPrefix(script, "function") {
+		script = "function() { return (" + script + "); }"
+	}
+	v, err := r.Page.Evaluate(script)
+	if err != nil {
+		return err
+	}
+	return r.print(v)
+}
+
+// title prints the page title.
+func (r *REPL) title(string) error { return r.call("Title", "") }
+
+// content prints the page content.
+func (r *REPL) content(string) error { return r.call("Content", "") }
+
+// cookies prints the cookies visible to the page.
+func (r *REPL) cookies(string) error { return r.call("Cookies", "") }
+
+// settings prints the page settings.
+func (r *REPL) settings(string) error { return r.call("Settings", "") }
+
+// frame switches to a named frame, to the parent frame with "..", or to the
+// main frame with no argument.
+func (r *REPL) frame(arg string) error {
+	switch arg {
+	case "":
+		return r.Page.SwitchToMainFrame()
+	case "..":
+		return r.Page.SwitchToParentFrame()
+	default:
+		return r.Page.SwitchToFrameName(unquote(arg))
+	}
+}
+
+// click sends a mouse click to the center of the first element matching a
+// selector.
+func (r *REPL) click(arg string) error {
+	if arg == "" {
+		return errors.New("usage: click <selector>")
+	}
+
+	selector, err := json.Marshal(unquote(arg))
+	if err != nil {
+		return err
+	}
+	v, err := r.Page.Evaluate(fmt.Sprintf(`function() {
+		var el = document.querySelector(%s);
+		if (!el) return null;
+		var r = el.getBoundingClientRect();
+		return [r.left + r.width / 2, r.top + r.height / 2];
+	}`, selector))
+	if err != nil {
+		return err
+	}
+	pt, ok := v.([]interface{})
+	if !ok || len(pt) != 2 {
+		return phantomjs.ErrElementNotFound
+	}
+	x, _ := pt[0].(float64)
+	y, _ := pt[1].(float64)
+	return r.Page.SendMouseEvent("click", int(x), int(y), "left")
+}
+
+// shot renders the page to a file using the format of its extension.
+func (r *REPL) shot(arg string) error {
+	if arg == "" {
+		return errors.New("usage: shot <file>")
+	}
+	filename, err := filepath.Abs(unquote(arg))
+	if err != nil {
+		return err
+	}
+
+	format := strings.TrimPrefix(strings.ToLower(filepath.Ext(filename)), ".")
+	switch format {
+	case "":
+		return errors.New("file extension required")
+	case "jpg":
+		format = "jpeg"
+	}
+	if err := r.Page.Render(filename, format, 100); err != nil {
+		return err
+	}
+	fmt.Fprintln(r.Stdout, filename)
+	return nil
+}
+
+// help prints the built-in commands and the WebPage methods.
+func (r *REPL) help(string) error {
+	var names []string
+	for name := range commands {
+		names = append(names, commands[name].usage)
+	}
+	sort.Strings(names)
+	fmt.Fprintln(r.Stdout, "Commands:")
+	for _, name := range names {
+		fmt.Fprintln(r.Stdout, "  "+name)
+	}
+
+	fmt.Fprintln(r.Stdout, "\nWebPage methods:")
+	t := reflect.TypeOf(r.Page)
+	for i := 0; i < t.NumMethod(); i++ {
+		m := t.Method(i)
+		if sig, ok := signature(m.Type); ok {
+			fmt.Fprintf(r.Stdout, "  %s%s\n", m.Name, sig)
+		}
+	}
+	return nil
+}
+
+// call calls a WebPage method by name with arguments parsed from arg and
+// prints any results.
+func (r *REPL) call(name, arg string) error {
+	m, ok := lookupMethod(r.Page, name)
+	if !ok {
+		return fmt.Errorf("unknown command: %s (type \"help\" for a list)", name)
+	}
+	t := m.Type()
+	if _, ok := signature(t); !ok {
+		return fmt.Errorf("%s cannot be called interactively", name)
+	}
+
+	args, err := parseArgs(t, arg)
+	if err != nil {
+		return fmt.Errorf("%s: %s", name, err)
+	}
+
+	out, err := invoke(m, args)
+	if err != nil {
+		return fmt.Errorf("%s: %s", name, err)
+	}
+
+	// Return a trailing error and print the remaining results.
+	if n := len(out); n > 0 && t.Out(n-1) == errorType {
+		if err, _ := out[n-1].Interface().(error); err != nil {
+			return err
+		}
+		out = out[:n-1]
+	}
+	for _, v := range out {
+		if err := r.print(v.Interface()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// invoke calls m with args and returns a panic, such as from a nil argument,
+// as an error.
+func invoke(m reflect.Value, args []reflect.Value) (out []reflect.Value, err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			err = fmt.Errorf("panic: %v", v)
+		}
+	}()
+	if m.Type().IsVariadic() {
+		return m.CallSlice(args), nil
+	}
+	return m.Call(args), nil
+}
+
+// print writes a value. Strings and text are written as is, binary data as its
+// size and everything else as indented JSON.
+func (r *REPL) print(v interface{}) error {
+	switch v := v.(type) {
+	case string:
+		_, err := fmt.Fprintln(r.Stdout, v)
+		return err
+	case []byte:
+		if utf8.Valid(v) {
+			_, err := fmt.Fprintln(r.Stdout, string(v))
+			return err
+		}
+		_, err := fmt.Fprintf(r.Stdout, "<%d bytes>\n", len(v))
+		return err
+	}
+
+	buf, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(r.Stdout, string(buf))
+	return err
+}
+
+var (
+	errorType    = reflect.TypeOf((*error)(nil)).Elem()
+	durationType = reflect.TypeOf(time.Duration(0))
+)
+
+// lookupMethod returns the exported method of v with a name, ignoring case.
+func lookupMethod(v interface{}, name string) (reflect.Value, bool) {
+	rv := reflect.ValueOf(v)
+	t := rv.Type()
+	for i := 0; i < t.NumMethod(); i++ {
+		if strings.EqualFold(t.Method(i).Name, name) {
+			return rv.Method(i), true
+		}
+	}
+	return reflect.Value{}, false
+}
+
+// signature returns the arguments of a method type for display. Returns false
+// if an argument cannot be parsed from text, such as a function or reader.
+func signature(t reflect.Type) (string, bool) {
+	var a []string
+	for i := 0; i < t.NumIn(); i++ {
+		in := t.In(i)
+		if i == 0 && in == reflect.TypeOf((*phantomjs.WebPage)(nil)) {
+			continue // receiver of a method expression
+		}
+		if !parseable(in) {
+			return "", false
+		}
+		s := in.String()
+		if t.IsVariadic() && i == t.NumIn()-1 {
+			s = "..." + in.Elem().String()
+		}
+		a = append(a, s)
+	}
+	if len(a) == 0 {
+		return "", true
+	}
+	return " " + strings.Join(a, " "), true
+}
+
+// parseable returns true if values of t can be parsed from text.
+func parseable(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Func, reflect.Chan, reflect.Interface, reflect.UnsafePointer:
+		return false
+	case reflect.Slice, reflect.Array, reflect.Ptr:
+		return t.Elem().Kind() == reflect.Uint8 || parseable(t.Elem())
+	}
+	return true
+}
+
+// parseArgs parses the arguments for a method from a line. A single string
+// argument receives the whole line. Otherwise arguments are separated by
+// spaces and may be quoted. Structs, maps and slices are parsed as JSON.
+func parseArgs(t reflect.Type, line string) ([]reflect.Value, error) {
+	if t.NumIn() == 1 && t.In(0).Kind() == reflect.String && !t.IsVariadic() {
+		if line == "" {
+			return nil, errors.New("expected 1 argument")
+		}
+		return []reflect.Value{reflect.ValueOf(unquote(line)).Convert(t.In(0))}, nil
+	}
+
+	fields, err := split(line)
+	if err != nil {
+		return nil, err
+	}
+
+	n := t.NumIn()
+	if t.IsVariadic() {
+		if len(fields) < n-1 {
+			return nil, fmt.Errorf("expected at least %d arguments", n-1)
+		}
+	} else if len(fields) != n {
+		return nil, fmt.Errorf("expected %d arguments, got %d", n, len(fields))
+	}
+
+	args := make([]reflect.Value, 0, n)
+	for i := 0; i < n; i++ {
+		if t.IsVariadic() && i == n-1 {
+			rest := reflect.MakeSlice(t.In(i), 0, len(fields)-i)
+			for _, field := range fields[i:] {
+				v, err := parseArg(field, t.In(i).Elem())
+				if err != nil {
+					return nil, err
+				}
+				rest = reflect.Append(rest, v)
+			}
+			args = append(args, rest)
+			break
+		}
+
+		v, err := parseArg(fields[i], t.In(i))
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, v)
+	}
+	return args, nil
+}
+
+// parseArg parses a single argument of type t.
+func parseArg(s string, t reflect.Type) (reflect.Value, error) {
+	v := reflect.New(t).Elem()
+	switch {
+	case t == durationType:
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return v, err
+		}
+		v.SetInt(int64(d))
+	case t.Kind() == reflect.String:
+		v.SetString(s)
+	case t.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return v, err
+		}
+		v.SetBool(b)
+	case t.Kind() >= reflect.Int && t.Kind() <= reflect.Int64:
+		i, err := strconv.ParseInt(s, 10, t.Bits())
+		if err != nil {
+			return v, err
+		}
+		v.SetInt(i)
+	case t.Kind() >= reflect.Uint && t.Kind() <= reflect.Uint64:
+		i, err := strconv.ParseUint(s, 10, t.Bits())
+		if err != nil {
+			return v, err
+		}
+		v.SetUint(i)
+	case t.Kind() == reflect.Float32 || t.Kind() == reflect.Float64:
+		f, err := strconv.ParseFloat(s, t.Bits())
+		if err != nil {
+			return v, err
+		}
+		v.SetFloat(f)
+	default:
+		if err := json.Unmarshal([]byte(s), v.Addr().Interface()); err != nil {
+			return v, fmt.Errorf("cannot parse %s as JSON: %s", t, err)
+		}
+	}
+	return v, nil
+}
+
+// split splits a line into fields separated by spaces. Fields may be quoted
+// with single or double quotes. Brackets and braces group JSON values so they
+// may contain spaces without quoting.
+func split(line string) ([]string, error) {
+	var fields []string
+	var buf strings.Builder
+	var quote rune
+	var depth int
+	inField, escaped := false, false
+
+	for _, ch := range line {
+		switch {
+		case escaped:
+			escaped = false
+			buf.WriteRune(ch)
+		case quote != 0 && depth > 0 && ch == '\\':
+			escaped = true
+			buf.WriteRune(ch)
+		case quote != 0:
+			if ch == quote && depth == 0 {
+				quote = 0
+				continue
+			} else if ch == quote {
+				quote = 0
+			}
+			buf.WriteRune(ch)
+		case (ch == '"' || ch == '\'') && depth == 0:
+			quote, inField = ch, true
+		case ch == '"' && depth > 0:
+			quote = ch
+			buf.WriteRune(ch)
+		case ch == '{' || ch == '[':
+			depth++
+			inField = true
+			buf.WriteRune(ch)
+		case (ch == '}' || ch == ']') && depth > 0:
+			depth--
+			buf.WriteRune(ch)
+		case (ch == ' ' || ch == '\t') && depth == 0:
+			if inField {
+				fields = append(fields, buf.String())
+				buf.Reset()
+				inField = false
+			}
+		default:
+			inField = true
+			buf.WriteRune(ch)
+		}
+	}
+
+	if quote != 0 || depth != 0 {
+		return nil, errors.New("unterminated argument")
+	} else if inField {
+		fields = append(fields, buf.String())
+	}
+	return fields, nil
+}
+
+// unquote removes matching quotes around s, if any.
+func unquote(s string) string {
+	if len(s) >= 2 && (s[0] == '"' || s[0] == '\'') && s[len(s)-1] == s[0] {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/kere/phantomjs"
+	"github.com/kere/phantomjs/phantomjsfake"
+)
+
+// Ensure built-in commands call the page and print results.
+func TestREPL_Exec_Builtins(t *testing.T) {
+	r, fake, out := MustNewREPL(t)
+	fake.HandleOpen("http://example.com/", phantomjsfake.Document{Content: "<html><head><title>Example</title></head></html>"})
+	fake.HandleEvaluate("1 + 1", map[string]interface{}{"sum": 2})
+
+	for _, line := range []string{"open http://example.com/", "title", "eval 1 + 1"} {
+		if err := r.Exec(line); err != nil {
+			t.Fatalf("%s: %s", line, err)
+		}
+	}
+	if exp := "Example\n{\n  \"sum\": 2\n}\n"; out.String() != exp {
+		t.Fatalf("unexpected output: %q", out.String())
+	} else if calls := fake.CallsTo("/webpage/Open"); len(calls) != 1 || calls[0].Body["all"] != true {
+		t.Fatalf("unexpected open calls: %v", calls)
+	}
+}
+
+// Ensure click quotes the selector as a JavaScript string and clicks the
+// center of the element.
+func TestREPL_Exec_Click(t *testing.T) {
+	r, fake, _ := MustNewREPL(t)
+	fake.EvaluateFunc = func(page *phantomjsfake.Page, script string) (interface{}, error) {
+		if !strings.Contains(script, `document.querySelector("a[title=\"\u003cx\u003e\"]")`) {
+			t.Fatalf("unexpected script: %s", script)
+		}
+		return []interface{}{10.0, 20.0}, nil
+	}
+
+	if err := r.Exec(`click 'a[title="<x>"]'`); err != nil {
+		t.Fatal(err)
+	} else if calls := fake.CallsTo("/webpage/SendMouseEvent"); len(calls) != 1 || calls[0].Body["mouseX"] != float64(10) || calls[0].Body["mouseY"] != float64(20) {
+		t.Fatalf("unexpected calls: %v", calls)
+	}
+}
+
+// Ensure WebPage methods can be called by name with parsed arguments.
+func TestREPL_Exec_Method(t *testing.T) {
+	r, fake, out := MustNewREPL(t)
+
+	if err := r.Exec("setviewportsize 320 240"); err != nil {
+		t.Fatal(err)
+	} else if err := r.Exec(`SetCustomHeaders {"X-Foo": ["bar baz"]}`); err != nil {
+		t.Fatal(err)
+	} else if err := r.Exec("SwitchToFrameName my frame"); err != nil {
+		t.Fatal(err)
+	}
+
+	if calls := fake.CallsTo("/webpage/SetViewportSize"); len(calls) != 1 || calls[0].Body["width"] != float64(320) {
+		t.Fatalf("unexpected calls: %v", calls)
+	} else if calls := fake.CallsTo("/webpage/SwitchToFrameName"); len(calls) != 1 || calls[0].Body["name"] != "my frame" {
+		t.Fatalf("unexpected calls: %v", calls)
+	} else if out.Len() != 0 {
+		t.Fatalf("unexpected output: %q", out.String())
+	}
+}
+
+// Ensure invalid commands return errors.
+func TestREPL_Exec_Errors(t *testing.T) {
+	r, _, _ := MustNewREPL(t)
+	for _, line := range []string{
+		"nosuchmethod",
+		"SetViewportSize 320",
+		"SetViewportSize a b",
+		"InFrame main",
+		"open",
+	} {
+		if err := r.Exec(line); err == nil {
+			t.Errorf("expected error: %s", line)
+		}
+	}
+
+	// Panics, such as from nil arguments, are returned as errors.
+	if err := r.Exec("SetCookies [null]"); err == nil || !strings.HasPrefix(err.Error(), "SetCookies: panic: ") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := r.Exec("quit"); err != ErrQuit {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+// Ensure lines are split into fields with quotes and JSON values.
+func TestSplit(t *testing.T) {
+	for _, tt := range []struct {
+		line string
+		exp  []string
+	}{
+		{``, nil},
+		{`a  b`, []string{"a", "b"}},
+		{`"a b" 'c'`, []string{"a b", "c"}},
+		{`{"a": [1, 2], "b": "}\" "} 3`, []string{`{"a": [1, 2], "b": "}\" "}`, "3"}},
+		{`""`, []string{""}},
+	} {
+		if fields, err := split(tt.line); err != nil {
+			t.Errorf("%s: %s", tt.line, err)
+		} else if !reflect.DeepEqual(fields, tt.exp) {
+			t.Errorf("%s: unexpected fields: %q", tt.line, fields)
+		}
+	}
+
+	if _, err := split(`"a`); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+// MustNewREPL returns a REPL with a page on a fake process.
+func MustNewREPL(tb testing.TB) (*REPL, *phantomjsfake.Handler, *bytes.Buffer) {
+	fake := phantomjsfake.NewHandler()
+	srv := httptest.NewServer(fake)
+	tb.Cleanup(srv.Close)
+
+	p := phantomjs.NewProcess()
+	p.BaseURL = srv.URL
+	page, err := p.CreateWebPage()
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	return &REPL{Page: page, Stdout: &out}, fake, &out
+}
@@ -0,0 +1,14 @@
+//go:build !linux && !darwin && !dragonfly && !freebsd && !netbsd && !openbsd
+
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+// makeRaw returns an error as raw mode is only supported on Linux and BSDs.
+// Lines are read without editing instead.
+func makeRaw(f *os.File) (func(), error) {
+	return nil, errors.New("raw mode not supported")
+}
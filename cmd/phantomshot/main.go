@@ -0,0 +1,470 @@
+// Command phantomshot renders URLs and local HTML files to PNG, JPEG or PDF.
+//
+// Usage:
+//
+//	phantomshot [flags] URL|FILE...
+//
+// Each input is written to the output directory using a name derived from the
+// input, or to the path given by -o when there is a single input. Inputs are
+// rendered in parallel across a pool of processes. The command exits with a
+// non-zero status if any input fails.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kere/phantomjs"
+)
+
+func main() {
+	m := NewMain()
+	if err := m.Run(context.Background(), os.Args[1:]...); err == flag.ErrHelp {
+		os.Exit(2)
+	} else if err != nil {
+		fmt.Fprintln(m.Stderr, "phantomshot:", err)
+		os.Exit(1)
+	}
+}
+
+// Main represents the program.
+type Main struct {
+	// Output format: "png", "jpeg" or "pdf".
+	Format  string
+	Quality int
+
+	// Output path for a single input, or directory for generated names.
+	Output string
+	Dir    string
+
+	// Viewport size, in pixels, and device preset name.
+	Width, Height int
+	Device        string
+
+	// If true, renders the entire document instead of the viewport.
+	FullPage bool
+
+	// If set, renders only the first element matching the selector.
+	Selector string
+
+	// If set, waits for an element matching the selector before rendering.
+	WaitFor string
+
+	// Time to wait after loading, before rendering.
+	Delay time.Duration
+
+	// Maximum time to wait for each input.
+	Timeout time.Duration
+
+	// Cookies file, in Netscape format or JSON if the name ends in ".json".
+	CookiesPath string
+
+	// Additional headers sent with each request.
+	Headers http.Header
+
+	// PDF paper size.
+	PaperSize phantomjs.PaperSize
+
+	// Number of processes and the port used by the first.
+	Parallel int
+	Port     int
+	BinPath  string
+
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
+// NewMain returns a new instance of Main with default settings.
+func NewMain() *Main {
+	return &Main{
+		Format:   "png",
+		Quality:  100,
+		Dir:      ".",
+		Width:    1280,
+		Height:   800,
+		Timeout:  30 * time.Second,
+		Headers:  make(http.Header),
+		Parallel: 2,
+		Port:     phantomjs.DefaultPort,
+		BinPath:  phantomjs.DefaultBinPath,
+		Stdout:   os.Stdout,
+		Stderr:   os.Stderr,
+	}
+}
+
+// Run parses the command line arguments and renders each input.
+func (m *Main) Run(ctx context.Context, args ...string) error {
+	inputs, err := m.ParseFlags(args)
+	if err != nil {
+		return err
+	}
+
+	// Start a pool of processes. Each process shares the same cookies.
+	pool := phantomjs.NewProcessPool(minInt(m.Parallel, len(inputs)))
+	pool.BasePort = m.Port
+	pool.BinPath = m.BinPath
+	if err := pool.Open(); err != nil {
+		return fmt.Errorf("cannot start phantomjs: %s", err)
+	}
+	defer pool.Close()
+
+	if m.CookiesPath != "" {
+		for _, p := range pool.Processes() {
+			if err := m.loadCookies(p); err != nil {
+				return fmt.Errorf("cannot load cookies: %s", err)
+			}
+		}
+	}
+
+	// Render inputs in parallel and report each failure.
+	var mu sync.Mutex
+	var failed int
+	var wg sync.WaitGroup
+	outputs := m.outputPaths(inputs)
+	sem := make(chan struct{}, len(pool.Processes()))
+	for i := range inputs {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(input, output string) {
+			defer func() { <-sem; wg.Done() }()
+
+			err := m.render(ctx, pool, input, output)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				failed++
+				fmt.Fprintf(m.Stderr, "phantomshot: %s: %s\n", input, err)
+				return
+			}
+			fmt.Fprintln(m.Stdout, output)
+		}(inputs[i], outputs[i])
+	}
+	wg.Wait()
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d inputs failed", failed, len(inputs))
+	}
+	return nil
+}
+
+// ParseFlags parses the command line flags and returns the inputs.
+func (m *Main) ParseFlags(args []string) ([]string, error) {
+	fs := flag.NewFlagSet("phantomshot", flag.ContinueOnError)
+	fs.SetOutput(m.Stderr)
+	fs.Usage = func() {
+		fmt.Fprintln(m.Stderr, "usage: phantomshot [flags] URL|FILE...")
+		fs.PrintDefaults()
+	}
+
+	format := fs.String("format", "", `output format: "png", "jpeg" or "pdf" (default from -o, or "png")`)
+	fs.IntVar(&m.Quality, "quality", m.Quality, "JPEG quality, 0-100")
+	fs.StringVar(&m.Output, "o", "", "output path; only valid with a single input")
+	fs.StringVar(&m.Dir, "dir", m.Dir, "output directory for generated file names")
+	viewport := fs.String("viewport", fmt.Sprintf("%dx%d", m.Width, m.Height), "viewport size as WIDTHxHEIGHT")
+	fs.StringVar(&m.Device, "device", "", "device preset: "+deviceNames())
+	fs.BoolVar(&m.FullPage, "full", false, "render the full page instead of the viewport")
+	fs.StringVar(&m.Selector, "selector", "", "render only the first element matching a CSS selector")
+	fs.StringVar(&m.WaitFor, "wait-for", "", "wait for an element matching a CSS selector before rendering")
+	fs.DurationVar(&m.Delay, "delay", 0, "time to wait after loading, before rendering")
+	fs.DurationVar(&m.Timeout, "timeout", m.Timeout, "maximum time per input")
+	fs.StringVar(&m.CookiesPath, "cookies", "", "cookies file in Netscape format, or JSON if named *.json")
+	fs.Var(headerFlag(m.Headers), "H", `custom header as "Name: value"; may be repeated`)
+	fs.StringVar(&m.PaperSize.Format, "paper", "A4", `PDF paper format, such as "A4" or "Letter"`)
+	fs.StringVar(&m.PaperSize.Orientation, "orientation", "portrait", `PDF orientation: "portrait" or "landscape"`)
+	margin := fs.String("margin", "", `PDF margins as "ALL" or "TOP,RIGHT,BOTTOM,LEFT", such as "1cm"`)
+	fs.IntVar(&m.Parallel, "parallel", m.Parallel, "number of phantomjs processes")
+	fs.IntVar(&m.Port, "port", m.Port, "port of the first phantomjs process")
+	fs.StringVar(&m.BinPath, "phantomjs", m.BinPath, "path to the phantomjs binary")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	inputs := fs.Args()
+	if len(inputs) == 0 {
+		fs.Usage()
+		return nil, flag.ErrHelp
+	} else if m.Output != "" && len(inputs) > 1 {
+		return nil, errors.New("-o cannot be used with multiple inputs")
+	}
+
+	// Determine format from the flag or output extension.
+	m.Format = *format
+	if m.Format == "" && m.Output != "" {
+		m.Format = strings.TrimPrefix(strings.ToLower(filepath.Ext(m.Output)), ".")
+	}
+	switch m.Format {
+	case "":
+		m.Format = "png"
+	case "jpg":
+		m.Format = "jpeg"
+	case "png", "jpeg", "pdf":
+	default:
+		return nil, fmt.Errorf("unsupported format: %q", m.Format)
+	}
+	if m.Selector != "" && m.Format == "pdf" {
+		return nil, errors.New("-selector cannot be used with pdf output")
+	}
+
+	var err error
+	if m.Width, m.Height, err = parseViewport(*viewport); err != nil {
+		return nil, err
+	} else if m.PaperSize.Margin, err = parseMargin(*margin); err != nil {
+		return nil, err
+	}
+	if m.Device != "" {
+		if _, ok := phantomjs.LookupDevice(m.Device); !ok {
+			return nil, fmt.Errorf("unknown device: %q", m.Device)
+		}
+	}
+	if m.Parallel < 1 {
+		m.Parallel = 1
+	}
+
+	return inputs, nil
+}
+
+// render opens a single input and writes the rendered output.
+//
+// PhantomJS calls cannot be cancelled so the page work runs in a separate
+// goroutine which is abandoned if the timeout is reached first.
+func (m *Main) render(ctx context.Context, pool *phantomjs.ProcessPool, input, output string) error {
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	u, err := inputURL(input)
+	if err != nil {
+		return err
+	}
+
+	type result struct {
+		data []byte
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		data, err := m.renderPage(ctx, pool, u)
+		done <- result{data, err}
+	}()
+
+	var data []byte
+	select {
+	case r := <-done:
+		if r.err != nil {
+			return r.err
+		}
+		data = r.data
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	if err := os.MkdirAll(filepath.Dir(output), 0777); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(output, data, 0666)
+}
+
+// renderPage opens u in a new page and returns the rendered output.
+func (m *Main) renderPage(ctx context.Context, pool *phantomjs.ProcessPool, u string) ([]byte, error) {
+	page, err := pool.CreateWebPage()
+	if err != nil {
+		return nil, err
+	}
+	defer page.Close()
+
+	// Configure page before opening.
+	if m.Device != "" {
+		d, _ := phantomjs.LookupDevice(m.Device)
+		if err := page.Emulate(d); err != nil {
+			return nil, err
+		}
+	} else if err := page.SetViewportSize(m.Width, m.Height); err != nil {
+		return nil, err
+	}
+	if len(m.Headers) > 0 {
+		if err := page.SetCustomHeaders(m.Headers); err != nil {
+			return nil, err
+		}
+	}
+	if m.Format == "pdf" {
+		if err := page.SetPaperSize(m.PaperSize); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := page.OpenAll(u); err != nil {
+		return nil, fmt.Errorf("cannot open page: %w", err)
+	}
+
+	// Wait for the page to be ready.
+	if m.WaitFor != "" {
+		if err := page.WaitForSelector(ctx, m.WaitFor); err != nil {
+			return nil, fmt.Errorf("cannot wait for %q: %w", m.WaitFor, err)
+		}
+	}
+	if m.Delay > 0 {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(m.Delay):
+		}
+	}
+
+	// Render the element, viewport or full page.
+	if m.Selector != "" {
+		return page.ScreenshotElement(m.Selector, phantomjs.RenderOptions{Format: m.Format})
+	}
+	if !m.FullPage && m.Format != "pdf" {
+		w, h, err := page.ViewportSize()
+		if err != nil {
+			return nil, err
+		} else if err := page.SetClipRect(phantomjs.Rect{Width: w, Height: h}); err != nil {
+			return nil, err
+		}
+	}
+	return page.RenderBytes(m.Format, m.Quality)
+}
+
+// loadCookies loads the cookies file into a process.
+func (m *Main) loadCookies(p *phantomjs.Process) error {
+	f, err := os.Open(m.CookiesPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	format := phantomjs.CookieFormatNetscape
+	if strings.EqualFold(filepath.Ext(m.CookiesPath), ".json") {
+		format = phantomjs.CookieFormatJSON
+	}
+	return p.LoadCookies(f, format)
+}
+
+// outputPaths returns the output path for each input. Generated names are
+// made unique by appending a counter.
+func (m *Main) outputPaths(inputs []string) []string {
+	if m.Output != "" {
+		return []string{m.Output}
+	}
+
+	ext := "." + m.Format
+	if m.Format == "jpeg" {
+		ext = ".jpg"
+	}
+
+	used := make(map[string]bool)
+	a := make([]string, len(inputs))
+	for i, input := range inputs {
+		base := outputName(input)
+		name := base
+		for n := 2; used[name]; n++ {
+			name = base + "-" + strconv.Itoa(n)
+		}
+		used[name] = true
+		a[i] = filepath.Join(m.Dir, name+ext)
+	}
+	return a
+}
+
+// outputName returns a file name, without extension, for an input. URLs use
+// their host and path and files use their base name.
+func outputName(input string) string {
+	s := strings.TrimSuffix(filepath.Base(input), filepath.Ext(input))
+	if u, err := url.Parse(input); err == nil && u.Host != "" {
+		s = u.Host + u.Path
+	}
+	s = strings.Trim(unsafeNameChars.ReplaceAllString(s, "-"), "-")
+	if s == "" {
+		return "page"
+	}
+	return s
+}
+
+var unsafeNameChars = regexp.MustCompile(`[^A-Za-z0-9._]+`)
+
+// inputURL returns the URL for an input. Inputs without a scheme are treated
+// as local files.
+func inputURL(input string) (string, error) {
+	if u, err := url.Parse(input); err == nil && u.Scheme != "" && len(u.Scheme) > 1 {
+		return input, nil
+	}
+
+	path, err := filepath.Abs(input)
+	if err != nil {
+		return "", err
+	} else if _, err := os.Stat(path); err != nil {
+		return "", err
+	}
+	return (&url.URL{Scheme: "file", Path: filepath.ToSlash(path)}).String(), nil
+}
+
+// parseViewport parses a size in the form "WIDTHxHEIGHT".
+func parseViewport(s string) (width, height int, err error) {
+	parts := strings.Split(strings.ToLower(s), "x")
+	if len(parts) == 2 {
+		width, err1 := strconv.Atoi(parts[0])
+		height, err2 := strconv.Atoi(parts[1])
+		if err1 == nil && err2 == nil && width > 0 && height > 0 {
+			return width, height, nil
+		}
+	}
+	return 0, 0, fmt.Errorf("invalid viewport %q: expected WIDTHxHEIGHT", s)
+}
+
+// parseMargin parses a single margin or four comma-separated margins.
+func parseMargin(s string) (*phantomjs.PaperSizeMargin, error) {
+	if s == "" {
+		return nil, nil
+	}
+	switch parts := strings.Split(s, ","); len(parts) {
+	case 1:
+		return &phantomjs.PaperSizeMargin{Top: s, Right: s, Bottom: s, Left: s}, nil
+	case 4:
+		return &phantomjs.PaperSizeMargin{Top: parts[0], Right: parts[1], Bottom: parts[2], Left: parts[3]}, nil
+	default:
+		return nil, fmt.Errorf("invalid margin %q: expected ALL or TOP,RIGHT,BOTTOM,LEFT", s)
+	}
+}
+
+// headerFlag is a repeatable flag which adds "Name: value" headers.
+type headerFlag http.Header
+
+func (h headerFlag) String() string { return "" }
+
+func (h headerFlag) Set(s string) error {
+	i := strings.IndexByte(s, ':')
+	if i <= 0 {
+		return fmt.Errorf("invalid header %q: expected \"Name: value\"", s)
+	}
+	http.Header(h).Add(strings.TrimSpace(s[:i]), strings.TrimSpace(s[i+1:]))
+	return nil
+}
+
+// deviceNames returns the names of the built-in device presets.
+func deviceNames() string {
+	a := make([]string, len(phantomjs.Devices))
+	for i, d := range phantomjs.Devices {
+		a[i] = strconv.Quote(d.Name)
+	}
+	return strings.Join(a, ", ")
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+// Ensure flags are parsed and the format is inferred from the output path.
+func TestMain_ParseFlags(t *testing.T) {
+	m := NewMain()
+	inputs, err := m.ParseFlags([]string{"-o", "out.jpg", "-viewport", "320x480", "-margin", "1cm", "-H", "X-Foo: bar", "http://example.com"})
+	if err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(inputs, []string{"http://example.com"}) {
+		t.Fatalf("unexpected inputs: %v", inputs)
+	} else if m.Format != "jpeg" {
+		t.Fatalf("unexpected format: %s", m.Format)
+	} else if m.Width != 320 || m.Height != 480 {
+		t.Fatalf("unexpected viewport: %dx%d", m.Width, m.Height)
+	} else if m.PaperSize.Margin == nil || m.PaperSize.Margin.Left != "1cm" {
+		t.Fatalf("unexpected margin: %#v", m.PaperSize.Margin)
+	} else if m.Headers.Get("X-Foo") != "bar" {
+		t.Fatalf("unexpected headers: %v", m.Headers)
+	}
+}
+
+// Ensure invalid flags return an error.
+func TestMain_ParseFlags_Invalid(t *testing.T) {
+	for _, args := range [][]string{
+		{"-format", "gif", "a.html"},
+		{"-viewport", "100", "a.html"},
+		{"-device", "no-such-device", "a.html"},
+		{"-o", "out.png", "a.html", "b.html"},
+		{"-format", "pdf", "-selector", "#main", "a.html"},
+		{"-H", "invalid", "a.html"},
+	} {
+		if _, err := NewMain().ParseFlags(args); err == nil {
+			t.Errorf("expected error: %v", args)
+		}
+	}
+}
+
+// Ensure output paths are derived from inputs and made unique.
+func TestMain_outputPaths(t *testing.T) {
+	m := NewMain()
+	m.Dir, m.Format = "out", "jpeg"
+	paths := m.outputPaths([]string{"https://example.com/a/b?q=1", "docs/index.html", "other/index.htm", "http://example.com"})
+	if exp := []string{"out/example.com-a-b.jpg", "out/index.jpg", "out/index-2.jpg", "out/example.com.jpg"}; !reflect.DeepEqual(paths, exp) {
+		t.Fatalf("unexpected paths: %v", paths)
+	}
+
+	// Generated names must not collide with names derived from other inputs.
+	paths = m.outputPaths([]string{"x/a.html", "y/a.html", "a-2.html"})
+	if exp := []string{"out/a.jpg", "out/a-2.jpg", "out/a-2-2.jpg"}; !reflect.DeepEqual(paths, exp) {
+		t.Fatalf("unexpected paths: %v", paths)
+	}
+}
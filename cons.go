@@ -17,6 +17,13 @@ server.listen(system.args[1], function(request, response) {
 	try {
 		switch (request.url) {
 			case '/ping': return handlePing(request, response);
+			case '/phantom/Cookies': return handlePhantomCookies(request, response);
+			case '/phantom/AddCookie': return handlePhantomAddCookie(request, response);
+			case '/phantom/DeleteCookie': return handlePhantomDeleteCookie(request, response);
+			case '/phantom/ClearCookies': return handlePhantomClearCookies(request, response);
+			case '/phantom/CookiesEnabled': return handlePhantomCookiesEnabled(request, response);
+			case '/phantom/SetCookiesEnabled': return handlePhantomSetCookiesEnabled(request, response);
+			case '/phantom/SetProxy': return handlePhantomSetProxy(request, response);
 			case '/webpage/CanGoBack': return handleWebpageCanGoBack(request, response);
 			case '/webpage/CanGoForward': return handleWebpageCanGoForward(request, response);
 			case '/webpage/ClipRect': return handleWebpageClipRect(request, response);
@@ -61,6 +68,10 @@ server.listen(system.args[1], function(request, response) {
 			case '/webpage/WindowName': return handleWebpageWindowName(request, response);
 			case '/webpage/ZoomFactor': return handleWebpageZoomFactor(request, response);
 			case '/webpage/SetZoomFactor': return handleWebpageSetZoomFactor(request, response);
+			case '/webpage/SetDeviceOverrides': return handleWebpageSetDeviceOverrides(request, response);
+			case '/webpage/SetNetworkOffline': return handleWebpageSetNetworkOffline(request, response);
+			case '/webpage/PendingResources': return handleWebpagePendingResources(request, response);
+			case '/webpage/VisitedStorage': return handleWebpageVisitedStorage(request, response);
 
 			case '/webpage/AddCookie': return handleWebpageAddCookie(request, response);
 			case '/webpage/ClearCookies': return handleWebpageClearCookies(request, response);
@@ -104,6 +115,50 @@ function handlePing(request, response) {
 	response.closeGracefully();
 }
 
+function handlePhantomCookies(request, response) {
+	response.write(JSON.stringify({value: phantom.cookies}));
+	response.closeGracefully();
+}
+
+function handlePhantomAddCookie(request, response) {
+	var msg = JSON.parse(request.post);
+	var returnValue = phantom.addCookie(msg.cookie);
+	response.write(JSON.stringify({returnValue: returnValue}));
+	response.closeGracefully();
+}
+
+function handlePhantomDeleteCookie(request, response) {
+	var msg = JSON.parse(request.post);
+	var returnValue = phantom.deleteCookie(msg.name);
+	response.write(JSON.stringify({returnValue: returnValue}));
+	response.closeGracefully();
+}
+
+function handlePhantomClearCookies(request, response) {
+	phantom.clearCookies();
+	response.write(JSON.stringify({}));
+	response.closeGracefully();
+}
+
+function handlePhantomCookiesEnabled(request, response) {
+	response.write(JSON.stringify({value: phantom.cookiesEnabled}));
+	response.closeGracefully();
+}
+
+function handlePhantomSetCookiesEnabled(request, response) {
+	var msg = JSON.parse(request.post);
+	phantom.cookiesEnabled = msg.value;
+	response.write(JSON.stringify({}));
+	response.closeGracefully();
+}
+
+function handlePhantomSetProxy(request, response) {
+	var msg = JSON.parse(request.post);
+	phantom.setProxy(msg.host, msg.port, msg.type, msg.user, msg.pass);
+	response.write(JSON.stringify({}));
+	response.closeGracefully();
+}
+
 function handleWebpageCanGoBack(request, response) {
 	var page = ref(JSON.parse(request.post).ref);
 	response.write(JSON.stringify({value: page.canGoBack}));
@@ -159,7 +214,10 @@ function handleWebpageSetCustomHeaders(request, response) {
 }
 
 function handleWebpageCreate(request, response) {
-	var ref = createRef(webpage.create());
+	var page = webpage.create();
+	var ref = createRef(page);
+	setResourceHandler(page, ref.id);
+	trackVisitedStorage(page, ref.id);
 	response.statusCode = 200;
 	response.write(JSON.stringify({ref: ref}));
 	response.closeGracefully();
@@ -172,20 +230,12 @@ function handleWebpageOpen(request, response) {
   }
   var page = ref(msg.ref);
 
-  page.onResourceRequested = function(requestData, pageRequest) {
-    var resURL = requestData['url']
-    if ((/http:\/\/.+?\.css(\?.+)?$/gi).test(resURL)) {
-      pageRequest.abort();
-    }else if ((/http:\/\/.+?\.png(\?.+)?$/gi).test(resURL)) {
-      pageRequest.abort();
-    }else if ((/http:\/\/.+?\.gif(\?.+)?$/gi).test(resURL)) {
-      pageRequest.abort();
-    }else if ((/http:\/\/.+?\.jpeg(\?.+)?$/gi).test(resURL)) {
-      pageRequest.abort();
-    }else if ((/http:\/\/.+?\.jpg(\?.+)?$/gi).test(resURL)) {
-      pageRequest.abort();
-    }
-  };
+  if (msg.all) {
+    delete openedPages[msg.ref];
+  } else {
+    openedPages[msg.ref] = true;
+  }
+  setResourceHandler(page, msg.ref);
 
 	page.open(msg.url, function(status) {
 		response.write(JSON.stringify({status: status}));
@@ -331,15 +381,36 @@ function handleWebpagePages(request, response) {
 }
 
 function handleWebpagePaperSize(request, response) {
-	var page = ref(JSON.parse(request.post).ref);
-	response.write(JSON.stringify({value: page.paperSize}));
+	var msg = JSON.parse(request.post);
+	var page = ref(msg.ref);
+	var size = page.paperSize;
+
+	// Header & footer callbacks are replaced by their original templates.
+	var value = {};
+	for (var key in size) {
+		if (key !== 'header' && key !== 'footer') {
+			value[key] = size[key];
+		}
+	}
+	var sections = paperSizeSections[msg.ref] || {};
+	if (sections.header) value.header = sections.header;
+	if (sections.footer) value.footer = sections.footer;
+
+	response.write(JSON.stringify({value: value}));
 	response.closeGracefully();
 }
 
 function handleWebpageSetPaperSize(request, response) {
 	var msg = JSON.parse(request.post);
 	var page = ref(msg.ref);
-	page.paperSize = msg.size;
+	var size = msg.size;
+
+	// Convert header & footer templates to callbacks.
+	paperSizeSections[msg.ref] = {header: size.header, footer: size.footer};
+	if (size.header) size.header = paperSizeSection(size.header);
+	if (size.footer) size.footer = paperSizeSection(size.footer);
+
+	page.paperSize = size;
 	response.write(JSON.stringify({}));
 	response.closeGracefully();
 }
@@ -426,6 +497,45 @@ function handleWebpageSetZoomFactor(request, response) {
 	response.closeGracefully();
 }
 
+function handleWebpageSetDeviceOverrides(request, response) {
+	var msg = JSON.parse(request.post);
+	var page = ref(msg.ref);
+	page.onInitialized = function() {
+		page.evaluate(applyDeviceOverrides, msg.device);
+	};
+	response.write(JSON.stringify({}));
+	response.closeGracefully();
+}
+
+function handleWebpageSetNetworkOffline(request, response) {
+	var msg = JSON.parse(request.post);
+	var page = ref(msg.ref);
+	if (msg.offline) {
+		offlinePages[msg.ref] = true;
+	} else {
+		delete offlinePages[msg.ref];
+	}
+	setResourceHandler(page, msg.ref);
+	response.write(JSON.stringify({}));
+	response.closeGracefully();
+}
+
+function handleWebpagePendingResources(request, response) {
+	var msg = JSON.parse(request.post);
+	var n = 0;
+	for (var key in pendingResources[msg.ref]) {
+		n++;
+	}
+	response.write(JSON.stringify({value: n}));
+	response.closeGracefully();
+}
+
+function handleWebpageVisitedStorage(request, response) {
+	var msg = JSON.parse(request.post);
+	response.write(JSON.stringify({value: visitedStorage[msg.ref] || {}}));
+	response.closeGracefully();
+}
+
 
 function handleWebpageAddCookie(request, response) {
 	var msg = JSON.parse(request.post);
@@ -458,6 +568,11 @@ function handleWebpageClose(request, response) {
 	var page = ref(msg.ref);
 	page.close();
 	delete(refs, msg.ref);
+	delete paperSizeSections[msg.ref];
+	delete offlinePages[msg.ref];
+	delete openedPages[msg.ref];
+	delete pendingResources[msg.ref];
+	delete visitedStorage[msg.ref];
 
 	// Close and dereference owned pages.
 	for (var i = 0; i < page.pages.length; i++) {
@@ -659,6 +774,143 @@ function handleNotFound(request, response) {
 }
 
 
+/*
+ * PAPER SIZE
+ */
+
+// Holds header & footer templates by page reference.
+var paperSizeSections = {};
+
+// Returns a paper size header or footer which renders a template on each page.
+function paperSizeSection(section) {
+	return {
+		height: section.height,
+		contents: phantom.callback(function(pageNum, numPages) {
+			return section.contents
+				.replace(/\{\{\s*\.PageNum\s*\}\}/g, pageNum)
+				.replace(/\{\{\s*\.NumPages\s*\}\}/g, numPages);
+		})
+	};
+}
+
+
+/*
+ * DEVICE EMULATION
+ */
+
+// Overrides device properties. Evaluated within the page context.
+function applyDeviceOverrides(device) {
+	var define = function(obj, name, value) {
+		try {
+			Object.defineProperty(obj, name, {get: function() { return value; }, configurable: true});
+		} catch(e) {}
+	};
+
+	define(window, 'devicePixelRatio', device.devicePixelRatio);
+	define(window.screen, 'width', device.screenWidth);
+	define(window.screen, 'height', device.screenHeight);
+	define(window.screen, 'availWidth', device.screenWidth);
+	define(window.screen, 'availHeight', device.screenHeight);
+
+	if (device.touch) {
+		window.ontouchstart = null;
+		document.ontouchstart = null;
+		define(navigator, 'maxTouchPoints', 5);
+	}
+}
+
+
+/*
+ * NETWORK
+ */
+
+// Holds pages which have network access disabled, by page reference.
+var offlinePages = {};
+
+// Holds pages which have been opened with Open, rather than OpenAll, by page
+// reference.
+var openedPages = {};
+
+// Holds the ids of unfinished resource requests, by page reference.
+var pendingResources = {};
+
+// Sets the page's resource handlers. Requests are aborted while the page is
+// offline. Otherwise stylesheets & images are blocked once the page has been
+// opened with Open. Unfinished requests are tracked in pendingResources.
+function setResourceHandler(page, id) {
+  pendingResources[id] = pendingResources[id] || {};
+
+  page.onResourceRequested = function(requestData, pageRequest) {
+    if (offlinePages[id]) {
+      pageRequest.abort();
+      return;
+    } else if (openedPages[id] && blockedResource(requestData['url'])) {
+      pageRequest.abort();
+      return;
+    }
+    pendingResources[id][requestData.id] = true;
+  };
+  page.onResourceReceived = function(response) {
+    if (response.stage === 'end') {
+      delete pendingResources[id][response.id];
+    }
+  };
+  page.onResourceError = function(resourceError) {
+    delete pendingResources[id][resourceError.id];
+  };
+  page.onResourceTimeout = function(request) {
+    delete pendingResources[id][request.id];
+  };
+}
+
+// Returns true if a resource is blocked on pages opened with Open.
+function blockedResource(resURL) {
+  return (/http:\/\/.+?\.(css|png|gif|jpeg|jpg)(\?.+)?$/i).test(resURL);
+}
+
+
+/*
+ * SESSION
+ */
+
+// Holds the web storage of http(s) origins which a page has navigated away
+// from, by page reference and origin.
+var visitedStorage = {};
+
+// Captures the storage of the page's current origin before its main frame
+// navigates away so that it can be saved with the page's session.
+function trackVisitedStorage(page, id) {
+	visitedStorage[id] = {};
+	page.onNavigationRequested = function(url, type, willNavigate, main) {
+		if (!willNavigate || !main) {
+			return;
+		}
+		var snapshot = page.evaluate(function() {
+			function copy(storage) {
+				var o = {};
+				for (var i = 0; i < storage.length; i++) {
+					var key = storage.key(i);
+					o[key] = storage.getItem(key);
+				}
+				return o;
+			}
+			try {
+				return {
+					origin: window.location.protocol + '//' + window.location.host,
+					local: copy(window.localStorage),
+					session: copy(window.sessionStorage)
+				};
+			} catch (e) {
+				return null;
+			}
+		});
+		if (snapshot && (/^https?:\/\//).test(snapshot.origin) && visitedStorage[id]) {
+			visitedStorage[id][snapshot.origin] = {local: snapshot.local, session: snapshot.session};
+		}
+	};
+}
+
+
 /*
  * REFS
  */
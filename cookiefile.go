@@ -0,0 +1,174 @@
+package phantomjs
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CookieFormat represents a file format used to persist cookies.
+type CookieFormat int
+
+// Cookie file formats.
+const (
+	// CookieFormatJSON is a JSON array of cookie objects in the same format
+	// as the "phantom.cookies" property.
+	CookieFormatJSON CookieFormat = iota
+
+	// CookieFormatNetscape is the tab-separated "cookies.txt" format used
+	// by curl and wget.
+	CookieFormatNetscape
+)
+
+// netscapeHTTPOnlyPrefix marks HTTP-only cookies in the Netscape format.
+const netscapeHTTPOnlyPrefix = "#HttpOnly_"
+
+// SaveCookies writes all cookies in the process' cookie jar to w.
+func (p *Process) SaveCookies(w io.Writer, format CookieFormat) error {
+	cookies, err := p.Cookies()
+	if err != nil {
+		return err
+	}
+	return WriteCookies(w, cookies, format)
+}
+
+// LoadCookies reads cookies from r and adds them to the process' cookie jar.
+// Cookies which have already expired are ignored.
+func (p *Process) LoadCookies(r io.Reader, format CookieFormat) error {
+	cookies, err := ReadCookies(r, format)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, c := range cookies {
+		if !c.Expires.IsZero() && !c.Expires.After(now) {
+			continue
+		}
+		if ok, err := p.AddCookie(c); err != nil {
+			return err
+		} else if !ok {
+			return fmt.Errorf("cannot add cookie: %s", c.Name)
+		}
+	}
+	return nil
+}
+
+// WriteCookies encodes cookies to w in the given format.
+func WriteCookies(w io.Writer, cookies []*http.Cookie, format CookieFormat) error {
+	switch format {
+	case CookieFormatJSON:
+		a := make([]cookieJSON, len(cookies))
+		for i := range cookies {
+			a[i] = encodeCookieJSON(cookies[i])
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "\t")
+		return enc.Encode(a)
+
+	case CookieFormatNetscape:
+		bw := bufio.NewWriter(w)
+		fmt.Fprintln(bw, "# Netscape HTTP Cookie File")
+		for _, c := range cookies {
+			domain := c.Domain
+			if c.HttpOnly {
+				domain = netscapeHTTPOnlyPrefix + domain
+			}
+
+			var expiry int64
+			if expires := cookieExpires(c); !expires.IsZero() {
+				expiry = expires.Unix()
+			}
+
+			fmt.Fprintf(bw, "%s\t%s\t%s\t%s\t%d\t%s\t%s\n",
+				domain,
+				netscapeBool(strings.HasPrefix(c.Domain, ".")),
+				c.Path,
+				netscapeBool(c.Secure),
+				expiry,
+				c.Name,
+				c.Value,
+			)
+		}
+		return bw.Flush()
+
+	default:
+		return fmt.Errorf("unknown cookie format: %d", format)
+	}
+}
+
+// ReadCookies decodes cookies from r in the given format.
+func ReadCookies(r io.Reader, format CookieFormat) ([]*http.Cookie, error) {
+	switch format {
+	case CookieFormatJSON:
+		var a []cookieJSON
+		if err := json.NewDecoder(r).Decode(&a); err != nil {
+			return nil, err
+		}
+		cookies := make([]*http.Cookie, len(a))
+		for i := range a {
+			cookies[i] = decodeCookieJSON(a[i])
+		}
+		return cookies, nil
+
+	case CookieFormatNetscape:
+		var cookies []*http.Cookie
+		scanner := bufio.NewScanner(r)
+		for lineNo := 1; scanner.Scan(); lineNo++ {
+			line := strings.TrimRight(scanner.Text(), "\r")
+
+			// Skip blank lines & comments other than HTTP-only markers.
+			var httpOnly bool
+			if strings.HasPrefix(line, netscapeHTTPOnlyPrefix) {
+				line, httpOnly = strings.TrimPrefix(line, netscapeHTTPOnlyPrefix), true
+			} else if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+
+			fields := strings.Split(line, "\t")
+			if len(fields) != 7 {
+				return nil, fmt.Errorf("invalid cookie on line %d: expected 7 fields", lineNo)
+			}
+			expiry, err := strconv.ParseInt(fields[4], 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid cookie expiry on line %d: %s", lineNo, err)
+			}
+
+			c := &http.Cookie{
+				Domain:   fields[0],
+				Path:     fields[2],
+				Secure:   fields[3] == "TRUE",
+				HttpOnly: httpOnly,
+				Name:     fields[5],
+				Value:    fields[6],
+			}
+			if fields[1] == "TRUE" && !strings.HasPrefix(c.Domain, ".") {
+				c.Domain = "." + c.Domain
+			}
+			if expiry != 0 {
+				c.Expires = time.Unix(expiry, 0).UTC()
+			}
+			cookies = append(cookies, c)
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+		return cookies, nil
+
+	default:
+		return nil, fmt.Errorf("unknown cookie format: %d", format)
+	}
+}
+
+// netscapeBool returns the Netscape cookie file representation of v.
+func netscapeBool(v bool) string {
+	if v {
+		return "TRUE"
+	}
+	return "FALSE"
+}
@@ -0,0 +1,114 @@
+package phantomjs_test
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/phantomjs"
+)
+
+// Ensure cookies can be written and read back without losing attributes.
+func TestWriteCookies_RoundTrip(t *testing.T) {
+	cookies := []*http.Cookie{
+		{Name: "SESSION", Value: "ABC", Domain: ".example.com", Path: "/", Secure: true, HttpOnly: true, Expires: time.Date(2030, time.January, 2, 3, 4, 5, 0, time.UTC)},
+		{Name: "PREF", Value: "dark", Domain: "www.example.com", Path: "/app"},
+	}
+
+	for _, format := range []phantomjs.CookieFormat{phantomjs.CookieFormatJSON, phantomjs.CookieFormatNetscape} {
+		var buf bytes.Buffer
+		if err := phantomjs.WriteCookies(&buf, cookies, format); err != nil {
+			t.Fatal(err)
+		}
+
+		other, err := phantomjs.ReadCookies(&buf, format)
+		if err != nil {
+			t.Fatal(err)
+		} else if len(other) != len(cookies) {
+			t.Fatalf("format %d: unexpected cookie count: %d", format, len(other))
+		}
+		for i := range cookies {
+			if a, b := cookies[i], other[i]; a.Name != b.Name || a.Value != b.Value || a.Domain != b.Domain || a.Path != b.Path ||
+				a.Secure != b.Secure || a.HttpOnly != b.HttpOnly || !a.Expires.Equal(b.Expires) {
+				t.Fatalf("format %d: unexpected cookie(%d): %#v", format, i, b)
+			}
+		}
+	}
+}
+
+// Ensure MaxAge is written as an absolute expiration time.
+func TestWriteCookies_MaxAge(t *testing.T) {
+	var buf bytes.Buffer
+	if err := phantomjs.WriteCookies(&buf, []*http.Cookie{{Name: "N", Value: "V", Domain: "example.com", Path: "/", MaxAge: 3600}}, phantomjs.CookieFormatNetscape); err != nil {
+		t.Fatal(err)
+	}
+
+	cookies, err := phantomjs.ReadCookies(&buf, phantomjs.CookieFormatNetscape)
+	if err != nil {
+		t.Fatal(err)
+	} else if d := time.Until(cookies[0].Expires); d < 59*time.Minute || d > time.Hour {
+		t.Fatalf("unexpected expiration: %s", cookies[0].Expires)
+	}
+}
+
+// Ensure cookie files written by curl can be read.
+func TestReadCookies_Netscape(t *testing.T) {
+	cookies, err := phantomjs.ReadCookies(strings.NewReader(""+
+		"# Netscape HTTP Cookie File\n"+
+		"# This file was generated by libcurl! Edit at your own risk.\n"+
+		"\n"+
+		"#HttpOnly_example.com\tTRUE\t/\tTRUE\t1893553445\tSESSION\tABC\n"+
+		"www.example.com\tFALSE\t/\tFALSE\t0\tPREF\tdark\n",
+	), phantomjs.CookieFormatNetscape)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(cookies) != 2 {
+		t.Fatalf("unexpected cookie count: %d", len(cookies))
+	}
+
+	if c := cookies[0]; c.Domain != ".example.com" || !c.HttpOnly || !c.Secure || c.Expires.Unix() != 1893553445 {
+		t.Fatalf("unexpected cookie(0): %#v", c)
+	} else if c := cookies[1]; c.Domain != "www.example.com" || c.HttpOnly || !c.Expires.IsZero() {
+		t.Fatalf("unexpected cookie(1): %#v", c)
+	}
+}
+
+// Ensure malformed cookie files return an error.
+func TestReadCookies_Netscape_ErrInvalid(t *testing.T) {
+	if _, err := phantomjs.ReadCookies(strings.NewReader("example.com\tTRUE\t/\n"), phantomjs.CookieFormatNetscape); err == nil || err.Error() != "invalid cookie on line 1: expected 7 fields" {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+// Ensure process cookies can be saved and loaded across processes.
+func TestProcess_SaveCookies(t *testing.T) {
+	p := MustOpenNewProcess()
+	defer p.MustClose()
+
+	expires := time.Now().Add(24 * time.Hour).UTC().Truncate(time.Second)
+	if _, err := p.AddCookie(&http.Cookie{Name: "SESSION", Value: "ABC", Domain: ".example.com", Path: "/", HttpOnly: true, Secure: true, Expires: expires}); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := p.SaveCookies(&buf, phantomjs.CookieFormatNetscape); err != nil {
+		t.Fatal(err)
+	}
+
+	// Clear the jar and load the saved cookies.
+	if err := p.ClearCookies(); err != nil {
+		t.Fatal(err)
+	} else if err := p.LoadCookies(&buf, phantomjs.CookieFormatNetscape); err != nil {
+		t.Fatal(err)
+	}
+
+	if cookies, err := p.Cookies(); err != nil {
+		t.Fatal(err)
+	} else if len(cookies) != 1 {
+		t.Fatalf("unexpected cookie count: %d", len(cookies))
+	} else if c := cookies[0]; c.Name != "SESSION" || !c.HttpOnly || !c.Secure || !c.Expires.Equal(expires) {
+		t.Fatalf("unexpected cookie: %#v", c)
+	}
+}
@@ -0,0 +1,178 @@
+package phantomjs
+
+import (
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CookieStore represents a cookie store within PhantomJS.
+// It is implemented by WebPage and Process.
+type CookieStore interface {
+	Cookies() ([]*http.Cookie, error)
+	AddCookie(cookie *http.Cookie) (bool, error)
+}
+
+// CookieJar implements http.CookieJar on top of a PhantomJS cookie store so
+// that Go HTTP clients and web pages can share a single live session.
+//
+// A web page only returns cookies visible to its current URL so a jar backed
+// by a WebPage can only return those cookies to HTTP clients. A jar backed by
+// a Process has access to every cookie.
+type CookieJar struct {
+	store CookieStore
+
+	mu  sync.Mutex
+	err error
+}
+
+// NewCookieJar returns a new cookie jar backed by store.
+func NewCookieJar(store CookieStore) *CookieJar {
+	return &CookieJar{store: store}
+}
+
+// Err returns the last error returned by the cookie store, if any. The
+// http.CookieJar interface does not allow errors to be returned directly.
+func (j *CookieJar) Err() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.err
+}
+
+// setErr records the last error returned by the cookie store.
+func (j *CookieJar) setErr(err error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.err = err
+}
+
+// SetCookies adds cookies received in a response from u to the store.
+// Cookies with a domain that does not match the host of u are ignored.
+func (j *CookieJar) SetCookies(u *url.URL, cookies []*http.Cookie) {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return
+	}
+	host := canonicalHost(u)
+
+	for _, c := range cookies {
+		other := *c
+
+		// Cookies without a domain are only sent to the originating host.
+		// Otherwise the domain must match the host & is sent to subdomains.
+		if other.Domain == "" {
+			other.Domain = host
+		} else {
+			domain := strings.TrimPrefix(strings.ToLower(other.Domain), ".")
+			if !domainMatch(host, domain) {
+				continue
+			}
+			other.Domain = "." + domain
+		}
+
+		if other.Path == "" || !strings.HasPrefix(other.Path, "/") {
+			other.Path = defaultCookiePath(u)
+		}
+
+		// Convert relative expiration to an absolute time.
+		if other.MaxAge < 0 {
+			other.Expires = time.Unix(1, 0).UTC()
+		} else if other.MaxAge > 0 {
+			other.Expires = time.Now().Add(time.Duration(other.MaxAge) * time.Second).UTC()
+		}
+		other.MaxAge = 0
+
+		if _, err := j.store.AddCookie(&other); err != nil {
+			j.setErr(err)
+			return
+		}
+	}
+}
+
+// Cookies returns the cookies in the store to send in a request to u.
+func (j *CookieJar) Cookies(u *url.URL) []*http.Cookie {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil
+	}
+
+	cookies, err := j.store.Cookies()
+	if err != nil {
+		j.setErr(err)
+		return nil
+	}
+
+	host, path, now := canonicalHost(u), u.Path, time.Now()
+	if path == "" {
+		path = "/"
+	}
+
+	var a []*http.Cookie
+	for _, c := range cookies {
+		if c.Secure && u.Scheme != "https" {
+			continue
+		} else if !c.Expires.IsZero() && !c.Expires.After(now) {
+			continue
+		} else if !cookieDomainMatch(host, c.Domain) {
+			continue
+		} else if !pathMatch(path, c.Path) {
+			continue
+		}
+		a = append(a, c)
+	}
+
+	// Cookies with longer paths are sent first.
+	sort.SliceStable(a, func(i, k int) bool { return len(a[i].Path) > len(a[k].Path) })
+
+	out := make([]*http.Cookie, len(a))
+	for i, c := range a {
+		out[i] = &http.Cookie{Name: c.Name, Value: c.Value}
+	}
+	return out
+}
+
+// canonicalHost returns the lowercase host of u without a port.
+func canonicalHost(u *url.URL) string {
+	return strings.ToLower(u.Hostname())
+}
+
+// cookieDomainMatch returns true if a cookie with domain should be sent to host.
+// Domains with a leading dot match subdomains. Other domains are host-only.
+func cookieDomainMatch(host, domain string) bool {
+	domain = strings.ToLower(domain)
+	if strings.HasPrefix(domain, ".") {
+		return domainMatch(host, domain[1:])
+	}
+	return host == domain
+}
+
+// domainMatch returns true if host is domain or a subdomain of domain.
+func domainMatch(host, domain string) bool {
+	if host == domain {
+		return true
+	} else if net.ParseIP(host) != nil {
+		return false
+	}
+	return strings.HasSuffix(host, "."+domain)
+}
+
+// pathMatch returns true if a cookie with cookiePath should be sent to path.
+func pathMatch(path, cookiePath string) bool {
+	if cookiePath == "" || cookiePath == "/" || path == cookiePath {
+		return true
+	} else if !strings.HasPrefix(path, cookiePath) {
+		return false
+	}
+	return strings.HasSuffix(cookiePath, "/") || path[len(cookiePath)] == '/'
+}
+
+// defaultCookiePath returns the default cookie path for a request to u.
+func defaultCookiePath(u *url.URL) string {
+	i := strings.LastIndex(u.Path, "/")
+	if i <= 0 {
+		return "/"
+	}
+	return u.Path[:i]
+}
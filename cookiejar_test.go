@@ -0,0 +1,152 @@
+package phantomjs_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/phantomjs"
+)
+
+// Ensure the jar implements the standard library interface.
+var _ http.CookieJar = &phantomjs.CookieJar{}
+
+// Ensure cookies set by a response are added to the store.
+func TestCookieJar_SetCookies(t *testing.T) {
+	var store MemoryCookieStore
+	jar := phantomjs.NewCookieJar(&store)
+
+	jar.SetCookies(MustParseURL("http://www.example.com/a/b"), []*http.Cookie{
+		{Name: "HOST", Value: "1"},
+		{Name: "DOMAIN", Value: "2", Domain: "example.com", Path: "/"},
+		{Name: "OTHER", Value: "3", Domain: "other.com"},
+	})
+	if err := jar.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual([]*http.Cookie(store), []*http.Cookie{
+		{Name: "HOST", Value: "1", Domain: "www.example.com", Path: "/a"},
+		{Name: "DOMAIN", Value: "2", Domain: ".example.com", Path: "/"},
+	}) {
+		t.Fatalf("unexpected cookies: %#v", store)
+	}
+}
+
+// Ensure only matching cookies are returned for a request.
+func TestCookieJar_Cookies(t *testing.T) {
+	store := MemoryCookieStore{
+		{Name: "HOST", Value: "1", Domain: "www.example.com", Path: "/"},
+		{Name: "DOMAIN", Value: "2", Domain: ".example.com", Path: "/"},
+		{Name: "PATH", Value: "3", Domain: ".example.com", Path: "/a"},
+		{Name: "NOPATH", Value: "4", Domain: ".example.com", Path: "/ab"},
+		{Name: "SECURE", Value: "5", Domain: ".example.com", Path: "/", Secure: true},
+		{Name: "EXPIRED", Value: "6", Domain: ".example.com", Path: "/", Expires: time.Now().Add(-time.Hour)},
+		{Name: "OTHER", Value: "7", Domain: "other.com", Path: "/"},
+	}
+	jar := phantomjs.NewCookieJar(&store)
+
+	// Ensure subdomain receives host & domain cookies.
+	if a := jar.Cookies(MustParseURL("http://www.example.com/a/b")); !reflect.DeepEqual(a, []*http.Cookie{
+		{Name: "PATH", Value: "3"},
+		{Name: "HOST", Value: "1"},
+		{Name: "DOMAIN", Value: "2"},
+	}) {
+		t.Fatalf("unexpected cookies: %#v", a)
+	}
+
+	// Ensure secure cookies are only sent over HTTPS.
+	if a := jar.Cookies(MustParseURL("https://example.com/")); !reflect.DeepEqual(a, []*http.Cookie{
+		{Name: "DOMAIN", Value: "2"},
+		{Name: "SECURE", Value: "5"},
+	}) {
+		t.Fatalf("unexpected cookies: %#v", a)
+	}
+}
+
+// Ensure an HTTP client and a web page can share a session.
+func TestCookieJar_WebPage(t *testing.T) {
+	// Mock external HTTP server which sets a session on login.
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/login":
+			http.SetCookie(w, &http.Cookie{Name: "SESSION", Value: "ABC", Path: "/"})
+		default:
+			w.Write([]byte(`<html><body></body></html>`))
+		}
+	}))
+	defer srv.Close()
+
+	p := MustOpenNewProcess()
+	defer p.MustClose()
+
+	page := p.MustCreateWebPage()
+	defer MustClosePage(page)
+	if err := page.Open(srv.URL); err != nil {
+		t.Fatal(err)
+	}
+
+	// Log in with the Go client.
+	jar := phantomjs.NewCookieJar(page)
+	client := &http.Client{Jar: jar}
+	if resp, err := client.Get(srv.URL + "/login"); err != nil {
+		t.Fatal(err)
+	} else {
+		resp.Body.Close()
+	}
+	if err := jar.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Verify the cookie is visible within the page.
+	if v, err := page.Evaluate(`function() { return document.cookie; }`); err != nil {
+		t.Fatal(err)
+	} else if v != "SESSION=ABC" {
+		t.Fatalf("unexpected cookie: %#v", v)
+	}
+}
+
+// Ensure a jar backed by a process can seed a session before a page exists.
+func TestCookieJar_Process(t *testing.T) {
+	p := MustOpenNewProcess()
+	defer p.MustClose()
+
+	jar := phantomjs.NewCookieJar(p)
+	u := MustParseURL("http://www.example.com/")
+	jar.SetCookies(u, []*http.Cookie{{Name: "SESSION", Value: "ABC", Domain: "example.com"}})
+	if err := jar.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	if a := jar.Cookies(u); !reflect.DeepEqual(a, []*http.Cookie{{Name: "SESSION", Value: "ABC"}}) {
+		t.Fatalf("unexpected cookies: %#v", a)
+	} else if err := jar.Err(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// MemoryCookieStore is an in-memory implementation of phantomjs.CookieStore.
+type MemoryCookieStore []*http.Cookie
+
+// Cookies returns all cookies in the store.
+func (s *MemoryCookieStore) Cookies() ([]*http.Cookie, error) {
+	return *s, nil
+}
+
+// AddCookie appends a cookie to the store.
+func (s *MemoryCookieStore) AddCookie(cookie *http.Cookie) (bool, error) {
+	*s = append(*s, cookie)
+	return true, nil
+}
+
+// MustParseURL parses rawurl. Panic on error.
+func MustParseURL(rawurl string) *url.URL {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		panic(err)
+	}
+	return u
+}
@@ -0,0 +1,344 @@
+// Package crawler implements a concurrent web crawler using PhantomJS pages.
+package crawler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/kere/phantomjs"
+)
+
+// Default crawler settings.
+const (
+	DefaultWorkers   = 4
+	DefaultDelay     = 500 * time.Millisecond
+	DefaultUserAgent = "phantomjs-crawler"
+)
+
+// Crawler errors.
+var (
+	ErrUnsupportedScheme = errors.New("unsupported url scheme")
+	ErrRelativeURL       = errors.New("url is not absolute")
+	ErrDisallowed        = errors.New("url disallowed by robots.txt")
+)
+
+// Response represents the result of visiting a URL.
+type Response struct {
+	// Canonical URL which was requested.
+	URL string
+
+	// Number of links followed from a seed URL. Seeds have a depth of zero.
+	Depth int
+
+	// Canonical URL of the page which linked to this page.
+	Referrer string
+
+	// Absolute URLs of links found on the page.
+	Links []string
+
+	// Set if the page could not be opened, or to ErrDisallowed if a seed URL
+	// was skipped because of the host's robots.txt.
+	Err error
+}
+
+// Crawler visits pages, starting from one or more seed URLs, and follows the
+// links found on each page. Pages are opened by a pool of workers which each
+// use their own page on the next process from Pool.
+type Crawler struct {
+	// Processes used to open pages.
+	Pool *phantomjs.ProcessPool
+
+	// Number of pages opened concurrently.
+	Workers int
+
+	// Maximum link depth from a seed URL. Zero is unlimited.
+	MaxDepth int
+
+	// Maximum number of pages to visit. Zero is unlimited.
+	MaxPages int
+
+	// If true, only links to the hosts of the seed URLs are followed.
+	SameHost bool
+
+	// If true, URLs disallowed by a host's robots.txt are skipped.
+	RespectRobots bool
+
+	// User agent matched against robots.txt rules and used to fetch them.
+	UserAgent string
+
+	// Minimum time between requests to the same host. A longer Crawl-delay
+	// in a host's robots.txt takes precedence.
+	Delay time.Duration
+
+	// Client used to fetch robots.txt.
+	HTTPClient *http.Client
+
+	visit func(*phantomjs.WebPage, *Response) error
+}
+
+// NewCrawler returns a new instance of Crawler with default settings.
+func NewCrawler(pool *phantomjs.ProcessPool) *Crawler {
+	return &Crawler{
+		Pool:          pool,
+		Workers:       DefaultWorkers,
+		SameHost:      true,
+		RespectRobots: true,
+		UserAgent:     DefaultUserAgent,
+		Delay:         DefaultDelay,
+		HTTPClient:    http.DefaultClient,
+	}
+}
+
+// Visit sets the function called for each visited page. The page is only
+// valid until fn returns. Returning an error stops the crawl and the error is
+// returned from Run().
+//
+// fn is called concurrently from every worker in the pool so it must be safe
+// for concurrent use.
+//
+// Seed URLs disallowed by robots.txt are reported with a nil page and a
+// response error of ErrDisallowed.
+func (c *Crawler) Visit(fn func(*phantomjs.WebPage, *Response) error) {
+	c.visit = fn
+}
+
+// Run crawls from the seed URLs until no URLs remain, a limit is reached, a
+// visit function returns an error or ctx is done.
+func (c *Crawler) Run(ctx context.Context, seeds ...string) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	r := &run{
+		crawler:  c,
+		frontier: newFrontier(c.MaxPages),
+		hosts:    make(map[string]struct{}),
+		limiter:  newHostLimiter(c.Delay),
+	}
+	if c.RespectRobots {
+		r.robots = newRobotsCache(c.HTTPClient, c.UserAgent)
+	}
+	defer r.frontier.closeOnDone(ctx)()
+
+	for _, seed := range seeds {
+		u, err := Canonicalize(seed)
+		if err != nil {
+			return err
+		}
+		pu, _ := url.Parse(u)
+		r.hosts[pu.Host] = struct{}{}
+		if r.allowed(ctx, pu) {
+			r.frontier.push(task{url: u})
+		} else if c.visit != nil {
+			if err := c.visit(nil, &Response{URL: u, Err: ErrDisallowed}); err != nil {
+				return err
+			}
+		}
+	}
+
+	workers := c.Workers
+	if workers <= 0 {
+		workers = DefaultWorkers
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := r.work(ctx); err != nil {
+				r.setErr(err)
+				cancel()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if r.err != nil {
+		return r.err
+	}
+	return ctx.Err()
+}
+
+// run holds the state of a single call to Crawler.Run().
+type run struct {
+	crawler  *Crawler
+	frontier *frontier
+	hosts    map[string]struct{} // seed hosts, read-only once started
+	robots   *robotsCache
+	limiter  *hostLimiter
+
+	mu  sync.Mutex
+	err error
+}
+
+// setErr records the first error from a worker.
+func (r *run) setErr(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err == nil {
+		r.err = err
+	}
+}
+
+// work visits tasks from the frontier until none remain.
+func (r *run) work(ctx context.Context) error {
+	var page *phantomjs.WebPage
+	defer func() {
+		if page != nil {
+			page.Close()
+		}
+	}()
+
+	for {
+		t, ok := r.frontier.pop()
+		if !ok {
+			return nil
+		}
+
+		if page == nil {
+			var err error
+			if page, err = r.crawler.Pool.CreateWebPage(); err != nil {
+				r.frontier.done()
+				return err
+			}
+		}
+
+		err := r.visit(ctx, page, t)
+		r.frontier.done()
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// visit opens a single URL, calls the visit function and queues its links.
+func (r *run) visit(ctx context.Context, page *phantomjs.WebPage, t task) error {
+	u, err := url.Parse(t.url)
+	if err != nil {
+		return nil
+	}
+
+	// Use the host's Crawl-delay, if specified.
+	var delay time.Duration
+	if r.robots != nil {
+		if rules := r.robots.get(ctx, u.Scheme+"://"+u.Host); rules != nil {
+			delay = rules.delay
+		}
+	}
+
+	if err := r.limiter.wait(ctx, u.Host, delay); err != nil {
+		return nil
+	}
+
+	resp := &Response{URL: t.url, Depth: t.depth, Referrer: t.referrer}
+	if resp.Err = page.Open(t.url); resp.Err == nil {
+		resp.Links, resp.Err = links(page)
+	}
+
+	if r.crawler.visit != nil {
+		if err := r.crawler.visit(page, resp); err != nil {
+			return err
+		}
+	}
+
+	// Queue links unless the depth limit has been reached.
+	if max := r.crawler.MaxDepth; max > 0 && t.depth >= max {
+		return nil
+	}
+	for _, link := range resp.Links {
+		lu, err := url.Parse(link)
+		if err != nil {
+			continue
+		} else if _, ok := r.hosts[canonicalHost(lu)]; r.crawler.SameHost && !ok {
+			continue
+		} else if !r.allowed(ctx, lu) {
+			continue
+		}
+		r.frontier.push(task{url: link, depth: t.depth + 1, referrer: t.url})
+	}
+	return nil
+}
+
+// allowed returns true if u is not disallowed by its host's robots.txt.
+func (r *run) allowed(ctx context.Context, u *url.URL) bool {
+	if r.robots == nil {
+		return true
+	} else if u.Scheme != "http" && u.Scheme != "https" {
+		return false
+	}
+	return r.robots.get(ctx, u.Scheme+"://"+u.Host).allowed(u.RequestURI())
+}
+
+// links returns the absolute URLs of all anchors on the page.
+func links(page *phantomjs.WebPage) ([]string, error) {
+	v, err := page.Evaluate(`function() {
+		var a = document.querySelectorAll('a[href]'), links = [];
+		for (var i = 0; i < a.length; i++) {
+			links.push(a[i].href);
+		}
+		return links;
+	}`)
+	if err != nil {
+		return nil, err
+	}
+
+	values, _ := v.([]interface{})
+	a := make([]string, 0, len(values))
+	for _, value := range values {
+		if s, ok := value.(string); ok {
+			a = append(a, s)
+		}
+	}
+	return a, nil
+}
+
+// canonicalHost returns the host of u in the form used by Canonicalize().
+func canonicalHost(u *url.URL) string {
+	c, err := Canonicalize(u.String())
+	if err != nil {
+		return ""
+	}
+	cu, _ := url.Parse(c)
+	return cu.Host
+}
+
+// hostLimiter spaces out requests to each host.
+type hostLimiter struct {
+	mu    sync.Mutex
+	delay time.Duration
+	next  map[string]time.Time
+}
+
+func newHostLimiter(delay time.Duration) *hostLimiter {
+	return &hostLimiter{delay: delay, next: make(map[string]time.Time)}
+}
+
+// wait blocks until a request may be made to host. A larger delay overrides
+// the limiter's default delay for this request.
+func (l *hostLimiter) wait(ctx context.Context, host string, delay time.Duration) error {
+	if delay < l.delay {
+		delay = l.delay
+	}
+
+	l.mu.Lock()
+	now := time.Now()
+	t := l.next[host]
+	if t.Before(now) {
+		t = now
+	}
+	l.next[host] = t.Add(delay)
+	l.mu.Unlock()
+
+	timer := time.NewTimer(t.Sub(now))
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,225 @@
+package crawler_test
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/kere/phantomjs"
+	"github.com/kere/phantomjs/crawler"
+	"github.com/kere/phantomjs/phantomjstest"
+)
+
+// Ensure URLs are normalized so equivalent URLs compare equal.
+func TestCanonicalize(t *testing.T) {
+	for _, tt := range []struct {
+		in, out string
+	}{
+		{"HTTP://Example.COM", "http://example.com/"},
+		{"http://example.com:80/a#frag", "http://example.com/a"},
+		{"https://example.com:443/?b=2&a=1", "https://example.com/?a=1&b=2"},
+		{"http://example.com:8080/a/b", "http://example.com:8080/a/b"},
+	} {
+		if u, err := crawler.Canonicalize(tt.in); err != nil {
+			t.Fatal(err)
+		} else if u != tt.out {
+			t.Errorf("Canonicalize(%q)=%q, expected %q", tt.in, u, tt.out)
+		}
+	}
+
+	if _, err := crawler.Canonicalize("mailto:foo@example.com"); err != crawler.ErrUnsupportedScheme {
+		t.Fatalf("unexpected error: %v", err)
+	} else if _, err := crawler.Canonicalize("/foo"); err != crawler.ErrRelativeURL {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+// Ensure the crawler follows links within the depth limit, dedupes URLs and
+// skips URLs disallowed by robots.txt or on other hosts.
+func TestCrawler_Run(t *testing.T) {
+	srv := NewSite()
+	defer srv.Close()
+
+	pool := MustOpenPool(t)
+	defer pool.Close()
+
+	c := crawler.NewCrawler(pool)
+	c.Delay = 0
+	c.MaxDepth = 2
+
+	var mu sync.Mutex
+	var visited []string
+	c.Visit(func(page *phantomjs.WebPage, resp *crawler.Response) error {
+		if resp.Err != nil {
+			return resp.Err
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		visited = append(visited, fmt.Sprintf("%d %s", resp.Depth, strings.TrimPrefix(resp.URL, srv.URL)))
+		return nil
+	})
+	if err := c.Run(context.Background(), srv.URL); err != nil {
+		t.Fatal(err)
+	}
+
+	sort.Strings(visited)
+	if exp := []string{"0 /", "1 /a", "1 /b?x=1&y=2", "2 /c"}; !reflect.DeepEqual(visited, exp) {
+		t.Fatalf("unexpected visits: %v", visited)
+	}
+}
+
+// Ensure the crawler stops after the maximum number of pages.
+func TestCrawler_Run_MaxPages(t *testing.T) {
+	srv := NewSite()
+	defer srv.Close()
+
+	pool := MustOpenPool(t)
+	defer pool.Close()
+
+	c := crawler.NewCrawler(pool)
+	c.Delay = 0
+	c.MaxPages = 2
+
+	var mu sync.Mutex
+	var n int
+	c.Visit(func(page *phantomjs.WebPage, resp *crawler.Response) error {
+		mu.Lock()
+		defer mu.Unlock()
+		n++
+		return nil
+	})
+	if err := c.Run(context.Background(), srv.URL); err != nil {
+		t.Fatal(err)
+	} else if n != 2 {
+		t.Fatalf("unexpected visit count: %d", n)
+	}
+}
+
+// Ensure an error from the visit function stops the crawl.
+func TestCrawler_Run_VisitError(t *testing.T) {
+	srv := NewSite()
+	defer srv.Close()
+
+	pool := MustOpenPool(t)
+	defer pool.Close()
+
+	errMarker := fmt.Errorf("marker")
+	c := crawler.NewCrawler(pool)
+	c.Delay = 0
+	c.Visit(func(page *phantomjs.WebPage, resp *crawler.Response) error {
+		return errMarker
+	})
+	if err := c.Run(context.Background(), srv.URL); err != errMarker {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+// Ensure seeds disallowed by robots.txt are reported to the visit function.
+func TestCrawler_Run_DisallowedSeed(t *testing.T) {
+	srv := NewSite()
+	defer srv.Close()
+
+	// The pool is never used as no page is opened.
+	c := crawler.NewCrawler(phantomjs.NewProcessPool(1))
+	c.Delay = 0
+
+	var responses []*crawler.Response
+	c.Visit(func(page *phantomjs.WebPage, resp *crawler.Response) error {
+		if page != nil {
+			t.Fatalf("unexpected visit: %s", resp.URL)
+		}
+		responses = append(responses, resp)
+		return nil
+	})
+	if err := c.Run(context.Background(), srv.URL+"/private/x"); err != nil {
+		t.Fatal(err)
+	} else if len(responses) != 1 {
+		t.Fatalf("unexpected responses: %d", len(responses))
+	} else if responses[0].URL != srv.URL+"/private/x" || responses[0].Err != crawler.ErrDisallowed {
+		t.Fatalf("unexpected response: %#v", responses[0])
+	}
+}
+
+// NewSite returns a test site with the following link structure:
+//
+//	/  -> /a, /a#top, /b?y=2&x=1, /private/x, http://other.invalid/
+//	/a -> /, /c
+//	/b -> /a
+//	/c -> /d
+//
+// The robots.txt disallows /private.
+func NewSite() *httptest.Server {
+	pages := map[string][]string{
+		"/":  {"/a", "/a#top", "/b?y=2&x=1", "/private/x", "http://other.invalid/"},
+		"/a": {"/", "/c"},
+		"/b": {"/a"},
+		"/c": {"/d"},
+		"/d": nil,
+	}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/robots.txt" {
+			fmt.Fprint(w, "User-agent: *\nDisallow: /private\n")
+			return
+		}
+
+		links, ok := pages[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, "<html><body>")
+		for _, link := range links {
+			fmt.Fprintf(w, `<a href="%s">link</a>`, link)
+		}
+		fmt.Fprint(w, "</body></html>")
+	}))
+}
+
+// MustOpenPool returns an open process pool on free ports. Skips the test if
+// the phantomjs binary is not installed. Panic on error.
+func MustOpenPool(tb testing.TB) *phantomjs.ProcessPool {
+	phantomjstest.SkipIfUnavailable(tb)
+
+	pool := phantomjs.NewProcessPool(2)
+	pool.BinPath = phantomjstest.BinPath
+	pool.BasePort = MustFreePorts(2)
+	if err := pool.Open(); err != nil {
+		panic(err)
+	}
+	return pool
+}
+
+// MustFreePorts returns the first of n consecutive local TCP ports which are
+// not in use. Panic if none are found.
+func MustFreePorts(n int) int {
+	for i := 0; i < 100; i++ {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			panic(err)
+		}
+		base := ln.Addr().(*net.TCPAddr).Port
+		ln.Close()
+
+		ok := true
+		for port := base; port < base+n && ok; port++ {
+			ln, err := net.Listen("tcp", "127.0.0.1:"+strconv.Itoa(port))
+			if err != nil {
+				ok = false
+				continue
+			}
+			ln.Close()
+		}
+		if ok {
+			return base
+		}
+	}
+	panic("no consecutive free ports")
+}
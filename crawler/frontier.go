@@ -0,0 +1,147 @@
+package crawler
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// Canonicalize returns a normalized form of an absolute HTTP or HTTPS URL so
+// equivalent URLs can be deduplicated. The scheme and host are lowercased,
+// default ports and fragments are removed, an empty path becomes "/" and query
+// parameters are sorted.
+func Canonicalize(rawurl string) (string, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return "", err
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	if u.Scheme == "" {
+		return "", ErrRelativeURL
+	} else if u.Scheme != "http" && u.Scheme != "https" {
+		return "", ErrUnsupportedScheme
+	} else if u.Host == "" {
+		return "", ErrRelativeURL
+	}
+
+	host, port := strings.ToLower(u.Hostname()), u.Port()
+	if (u.Scheme == "http" && port == "80") || (u.Scheme == "https" && port == "443") {
+		port = ""
+	}
+	if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+	u.Host = host
+	if port != "" {
+		u.Host += ":" + port
+	}
+
+	if u.Path == "" {
+		u.Path = "/"
+	}
+	u.RawQuery = u.Query().Encode()
+	u.Fragment, u.RawFragment = "", ""
+	u.User = nil
+	return u.String(), nil
+}
+
+// task represents a URL waiting to be visited.
+type task struct {
+	url      string
+	depth    int
+	referrer string
+}
+
+// frontier is a queue of URLs to visit. URLs are deduplicated by their
+// canonical form and a URL is only ever queued once.
+type frontier struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	queue   []task
+	seen    map[string]struct{}
+	pending int // tasks dequeued but not yet done
+	n       int // total tasks dequeued
+	max     int // maximum tasks to dequeue, zero is unlimited
+	closed  bool
+}
+
+func newFrontier(max int) *frontier {
+	f := &frontier{seen: make(map[string]struct{}), max: max}
+	f.cond = sync.NewCond(&f.mu)
+	return f
+}
+
+// push adds a URL to the queue if it has not been seen before.
+// Returns false if the URL was a duplicate or is invalid.
+func (f *frontier) push(t task) bool {
+	u, err := Canonicalize(t.url)
+	if err != nil {
+		return false
+	}
+	t.url = u
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.seen[u]; ok {
+		return false
+	}
+	f.seen[u] = struct{}{}
+	f.queue = append(f.queue, t)
+	f.cond.Signal()
+	return true
+}
+
+// pop blocks until a task is available. Returns false once the queue is empty
+// and no tasks are in progress, the page limit is reached, or the frontier is
+// closed.
+func (f *frontier) pop() (task, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for {
+		if f.closed || (f.max > 0 && f.n >= f.max) {
+			return task{}, false
+		} else if len(f.queue) > 0 {
+			break
+		} else if f.pending == 0 {
+			return task{}, false
+		}
+		f.cond.Wait()
+	}
+
+	t := f.queue[0]
+	f.queue = f.queue[1:]
+	f.pending++
+	f.n++
+	return t, true
+}
+
+// done marks a dequeued task as complete.
+func (f *frontier) done() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.pending--
+	f.cond.Broadcast()
+}
+
+// close wakes all waiting workers and stops further tasks from being dequeued.
+func (f *frontier) close() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.closed = true
+	f.cond.Broadcast()
+}
+
+// closeOnDone closes the frontier when ctx is done. The returned function
+// must be called to release resources.
+func (f *frontier) closeOnDone(ctx context.Context) func() {
+	stop := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			f.close()
+		case <-stop:
+		}
+	}()
+	return func() { close(stop) }
+}
@@ -0,0 +1,61 @@
+package crawler
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// Ensure requests to the same host are spaced by the delay while other hosts
+// are not held up.
+func TestHostLimiter_Wait(t *testing.T) {
+	l := newHostLimiter(50 * time.Millisecond)
+	ctx := context.Background()
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if err := l.wait(ctx, "a.com", 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if d := time.Since(start); d < 100*time.Millisecond {
+		t.Fatalf("expected same host requests to be delayed, took %s", d)
+	}
+
+	start = time.Now()
+	if err := l.wait(ctx, "b.com", 0); err != nil {
+		t.Fatal(err)
+	} else if d := time.Since(start); d >= 50*time.Millisecond {
+		t.Fatalf("expected other host not to be delayed, took %s", d)
+	}
+}
+
+// Ensure a larger per-request delay, such as from Crawl-delay, overrides the
+// default delay.
+func TestHostLimiter_Wait_Delay(t *testing.T) {
+	l := newHostLimiter(0)
+	ctx := context.Background()
+
+	start := time.Now()
+	if err := l.wait(ctx, "a.com", 100*time.Millisecond); err != nil {
+		t.Fatal(err)
+	} else if err := l.wait(ctx, "a.com", 0); err != nil {
+		t.Fatal(err)
+	} else if d := time.Since(start); d < 100*time.Millisecond {
+		t.Fatalf("expected crawl delay to apply, took %s", d)
+	}
+}
+
+// Ensure waiting returns early when the context is canceled.
+func TestHostLimiter_Wait_Canceled(t *testing.T) {
+	l := newHostLimiter(time.Hour)
+	if err := l.wait(context.Background(), "a.com", 0); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := l.wait(ctx, "a.com", 0); err != context.DeadlineExceeded {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
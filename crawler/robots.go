@@ -0,0 +1,194 @@
+package crawler
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// robots represents the rules of a robots.txt file which apply to a user agent.
+type robots struct {
+	rules []robotsRule
+	delay time.Duration // Crawl-delay, if specified
+}
+
+// robotsRule represents a single Allow or Disallow line.
+type robotsRule struct {
+	allow bool
+	path  string
+	re    *regexp.Regexp
+}
+
+// allowed returns true if path may be crawled. The longest matching rule wins
+// and Allow wins over Disallow on a tie.
+func (r *robots) allowed(path string) bool {
+	if r == nil {
+		return true
+	}
+
+	allow, n := true, -1
+	for _, rule := range r.rules {
+		if !rule.re.MatchString(path) {
+			continue
+		}
+		if len(rule.path) > n || (len(rule.path) == n && rule.allow) {
+			allow, n = rule.allow, len(rule.path)
+		}
+	}
+	return allow
+}
+
+// parseRobots parses a robots.txt file and returns the rules for the first
+// group matching userAgent, or the "*" group if no group matches.
+func parseRobots(r io.Reader, userAgent string) *robots {
+	type group struct {
+		agents []string
+		robots robots
+	}
+
+	var groups []*group
+	var g *group
+	inAgents := false
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		i := strings.IndexByte(line, ':')
+		if i < 0 {
+			continue
+		}
+		key := strings.ToLower(strings.TrimSpace(line[:i]))
+		value := strings.TrimSpace(line[i+1:])
+
+		switch key {
+		case "user-agent":
+			if !inAgents {
+				g = &group{}
+				groups = append(groups, g)
+				inAgents = true
+			}
+			g.agents = append(g.agents, strings.ToLower(value))
+			continue
+		case "allow", "disallow":
+			if g != nil && value != "" {
+				g.robots.rules = append(g.robots.rules, robotsRule{
+					allow: key == "allow",
+					path:  value,
+					re:    robotsPattern(value),
+				})
+			}
+		case "crawl-delay":
+			if g != nil {
+				if sec, err := strconv.ParseFloat(value, 64); err == nil {
+					g.robots.delay = time.Duration(sec * float64(time.Second))
+				}
+			}
+		}
+		inAgents = false
+	}
+
+	// Find the group for the user agent, falling back to the wildcard group.
+	userAgent = strings.ToLower(userAgent)
+	var wildcard *robots
+	for _, g := range groups {
+		for _, agent := range g.agents {
+			if agent == "*" {
+				if wildcard == nil {
+					wildcard = &g.robots
+				}
+			} else if userAgent != "" && strings.Contains(userAgent, agent) {
+				return &g.robots
+			}
+		}
+	}
+	return wildcard
+}
+
+// robotsPattern converts a robots.txt path into a regular expression.
+// Supports the "*" wildcard and the "$" end anchor.
+func robotsPattern(path string) *regexp.Regexp {
+	anchored := strings.HasSuffix(path, "$")
+	path = strings.TrimSuffix(path, "$")
+
+	s := "^" + strings.Replace(regexp.QuoteMeta(path), `\*`, ".*", -1)
+	if anchored {
+		s += "$"
+	}
+	return regexp.MustCompile(s)
+}
+
+// robotsCache fetches and caches robots.txt rules by origin.
+type robotsCache struct {
+	mu        sync.Mutex
+	entries   map[string]*robotsEntry
+	client    *http.Client
+	userAgent string
+}
+
+// robotsEntry holds the rules for an origin once they are fetched.
+type robotsEntry struct {
+	ready  chan struct{}
+	robots *robots
+}
+
+func newRobotsCache(client *http.Client, userAgent string) *robotsCache {
+	return &robotsCache{
+		entries:   make(map[string]*robotsEntry),
+		client:    client,
+		userAgent: userAgent,
+	}
+}
+
+// get returns the rules for an origin (e.g. "http://example.com"). Rules are
+// fetched once per origin. A missing or unreadable robots.txt allows all URLs.
+func (c *robotsCache) get(ctx context.Context, origin string) *robots {
+	c.mu.Lock()
+	e := c.entries[origin]
+	if e != nil {
+		c.mu.Unlock()
+		select {
+		case <-e.ready:
+			return e.robots
+		case <-ctx.Done():
+			return nil
+		}
+	}
+	e = &robotsEntry{ready: make(chan struct{})}
+	c.entries[origin] = e
+	c.mu.Unlock()
+
+	e.robots = c.fetch(ctx, origin)
+	close(e.ready)
+	return e.robots
+}
+
+// fetch retrieves and parses the robots.txt for an origin.
+func (c *robotsCache) fetch(ctx context.Context, origin string) *robots {
+	req, err := http.NewRequest("GET", origin+"/robots.txt", nil)
+	if err != nil {
+		return nil
+	}
+	req = req.WithContext(ctx)
+	if c.userAgent != "" {
+		req.Header.Set("User-Agent", c.userAgent)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil
+	}
+	return parseRobots(resp.Body, c.userAgent)
+}
@@ -0,0 +1,111 @@
+package crawler
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// Ensure robots.txt paths are matched as prefixes with "*" and "$" support.
+func TestRobotsPattern(t *testing.T) {
+	for _, tt := range []struct {
+		pattern, path string
+		match         bool
+	}{
+		{"/private", "/private", true},
+		{"/private", "/private/a.html", true},
+		{"/private", "/public", false},
+		{"/*.php", "/index.php", true},
+		{"/*.php", "/a/b/index.php?x=1", true},
+		{"/*.php", "/index.html", false},
+		{"/*.php$", "/index.php", true},
+		{"/*.php$", "/index.php?x=1", false},
+		{"/a$", "/a", true},
+		{"/a$", "/ab", false},
+		{"/a*b", "/a/x/b", true},
+		{"/a.b", "/axb", false},
+		{"/a?b", "/a?b", true},
+	} {
+		if match := robotsPattern(tt.pattern).MatchString(tt.path); match != tt.match {
+			t.Errorf("robotsPattern(%q).MatchString(%q)=%v, expected %v", tt.pattern, tt.path, match, tt.match)
+		}
+	}
+}
+
+// Ensure robots.txt groups are selected by user agent and the longest
+// matching rule wins, with Allow winning ties.
+func TestParseRobots(t *testing.T) {
+	const txt = `
+# comment
+User-agent: *
+Disallow: /private
+Allow: /private/public
+Crawl-delay: 2
+
+User-agent: FooBot
+User-agent: BarBot
+Disallow: /
+Allow: /$
+Allow: /open
+Disallow: /open/closed # trailing comment
+Crawl-delay: 0.5
+
+User-agent: TieBot
+Disallow: /tie
+Allow: /tie
+`
+
+	for _, tt := range []struct {
+		agent string
+		path  string
+		allow bool
+	}{
+		{"Mozilla/5.0", "/", true},
+		{"Mozilla/5.0", "/private", false},
+		{"Mozilla/5.0", "/private/secret", false},
+		{"Mozilla/5.0", "/private/public/page", true},
+		{"Mozilla/5.0", "/other", true},
+		{"", "/private", false},
+		{"foobot/1.0", "/", true},
+		{"foobot/1.0", "/index.html", false},
+		{"FooBot/1.0", "/open/page", true},
+		{"FooBot/1.0", "/open/closed/page", false},
+		{"BarBot", "/private/public", false},
+		{"TieBot", "/tie", true},
+	} {
+		r := parseRobots(strings.NewReader(txt), tt.agent)
+		if allow := r.allowed(tt.path); allow != tt.allow {
+			t.Errorf("agent %q: allowed(%q)=%v, expected %v", tt.agent, tt.path, allow, tt.allow)
+		}
+	}
+
+	for _, tt := range []struct {
+		agent string
+		delay time.Duration
+	}{
+		{"Mozilla/5.0", 2 * time.Second},
+		{"FooBot", 500 * time.Millisecond},
+		{"TieBot", 0},
+	} {
+		if r := parseRobots(strings.NewReader(txt), tt.agent); r.delay != tt.delay {
+			t.Errorf("agent %q: delay=%s, expected %s", tt.agent, r.delay, tt.delay)
+		}
+	}
+}
+
+// Ensure missing groups and invalid lines allow all paths.
+func TestParseRobots_NoMatch(t *testing.T) {
+	r := parseRobots(strings.NewReader("User-agent: FooBot\nDisallow: /\n"), "BarBot")
+	if r != nil {
+		t.Fatalf("unexpected rules: %#v", r)
+	} else if !r.allowed("/") {
+		t.Fatal("expected nil rules to allow all paths")
+	}
+
+	r = parseRobots(strings.NewReader("Disallow: /\nUser-agent: *\nDisallow:\nCrawl-delay: abc\n"), "")
+	if !r.allowed("/") {
+		t.Fatal("expected empty disallow to allow all paths")
+	} else if r.delay != 0 {
+		t.Fatalf("unexpected delay: %s", r.delay)
+	}
+}
@@ -0,0 +1,133 @@
+package phantomjs
+
+import (
+	"strings"
+)
+
+// Device represents the screen and browser characteristics of a device.
+type Device struct {
+	Name string
+
+	// Size of the viewport, in CSS pixels.
+	Width  int
+	Height int
+
+	// Ratio of physical pixels to CSS pixels. Rendered images are scaled by
+	// this factor. Defaults to 1.
+	DevicePixelRatio float64
+
+	// User agent sent with requests. The page's current user agent is kept
+	// if this is blank.
+	UserAgent string
+
+	// If true, touch events are reported as supported by the browser.
+	Touch bool
+}
+
+// Built-in device presets.
+var (
+	IPhone = Device{
+		Name:             "iPhone",
+		Width:            375,
+		Height:           667,
+		DevicePixelRatio: 2,
+		UserAgent:        "Mozilla/5.0 (iPhone; CPU iPhone OS 11_0 like Mac OS X) AppleWebKit/604.1.38 (KHTML, like Gecko) Version/11.0 Mobile/15A372 Safari/604.1",
+		Touch:            true,
+	}
+
+	IPad = Device{
+		Name:             "iPad",
+		Width:            768,
+		Height:           1024,
+		DevicePixelRatio: 2,
+		UserAgent:        "Mozilla/5.0 (iPad; CPU OS 11_0 like Mac OS X) AppleWebKit/604.1.34 (KHTML, like Gecko) Version/11.0 Mobile/15A5341f Safari/604.1",
+		Touch:            true,
+	}
+
+	AndroidPhone = Device{
+		Name:             "Android",
+		Width:            360,
+		Height:           640,
+		DevicePixelRatio: 3,
+		UserAgent:        "Mozilla/5.0 (Linux; Android 8.0.0; Pixel 2 Build/OPD3.170816.012) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/65.0.3325.109 Mobile Safari/537.36",
+		Touch:            true,
+	}
+
+	Desktop1080p = Device{
+		Name:             "Desktop 1080p",
+		Width:            1920,
+		Height:           1080,
+		DevicePixelRatio: 1,
+		UserAgent:        "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/65.0.3325.181 Safari/537.36",
+	}
+)
+
+// Devices holds the built-in device presets.
+var Devices = []Device{IPhone, IPad, AndroidPhone, Desktop1080p}
+
+// LookupDevice returns a built-in device preset by case-insensitive name.
+func LookupDevice(name string) (Device, bool) {
+	for _, d := range Devices {
+		if strings.EqualFold(d.Name, name) {
+			return d, true
+		}
+	}
+	return Device{}, false
+}
+
+// Emulate applies the viewport size, user agent and pixel ratio of a device to
+// the web page.
+//
+// The viewport and zoom factor are scaled by the device pixel ratio so pages
+// are laid out at the device's CSS size and rendered at its physical size.
+// The window.devicePixelRatio, screen size and touch support overrides are
+// injected when the page is next initialized, such as by Open().
+func (p *WebPage) Emulate(d Device) error {
+	return p.Do(func(page *WebPage) error {
+		return page.emulate(d)
+	})
+}
+
+// emulate applies a device profile. The caller must hold the page lock.
+func (p *WebPage) emulate(d Device) error {
+	dpr := d.DevicePixelRatio
+	if dpr <= 0 {
+		dpr = 1
+	}
+
+	if d.UserAgent != "" {
+		settings, err := p.Settings()
+		if err != nil {
+			return err
+		}
+		settings.UserAgent = d.UserAgent
+		if err := p.SetSettings(settings); err != nil {
+			return err
+		}
+	}
+
+	if err := p.SetViewportSize(int(float64(d.Width)*dpr), int(float64(d.Height)*dpr)); err != nil {
+		return err
+	} else if err := p.SetZoomFactor(dpr); err != nil {
+		return err
+	}
+
+	req := map[string]interface{}{
+		"ref": p.ref.id,
+		"device": deviceJSON{
+			DevicePixelRatio: dpr,
+			ScreenWidth:      d.Width,
+			ScreenHeight:     d.Height,
+			Touch:            d.Touch,
+		},
+	}
+	return p.doJSON("POST", "/webpage/SetDeviceOverrides", req, nil)
+}
+
+// deviceJSON is a struct for encoding the overrides injected into a page.
+type deviceJSON struct {
+	DevicePixelRatio float64 `json:"devicePixelRatio"`
+	ScreenWidth      int     `json:"screenWidth"`
+	ScreenHeight     int     `json:"screenHeight"`
+	Touch            bool    `json:"touch"`
+}
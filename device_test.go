@@ -0,0 +1,70 @@
+package phantomjs_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/benbjohnson/phantomjs"
+)
+
+// Ensure web page can emulate a device.
+func TestWebPage_Emulate(t *testing.T) {
+	// Mock external HTTP server.
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<html><head><meta name="viewport" content="width=device-width"></head><body>DEVICE</body></html>`))
+	}))
+	defer srv.Close()
+
+	p := MustOpenNewProcess()
+	defer p.MustClose()
+
+	page := p.MustCreateWebPage()
+	defer MustClosePage(page)
+	if err := page.Emulate(phantomjs.IPhone); err != nil {
+		t.Fatal(err)
+	} else if err := page.Open(srv.URL); err != nil {
+		t.Fatal(err)
+	}
+
+	// Verify viewport is scaled by the pixel ratio.
+	if w, h, err := page.ViewportSize(); err != nil {
+		t.Fatal(err)
+	} else if w != 750 || h != 1334 {
+		t.Fatalf("unexpected viewport: %dx%d", w, h)
+	}
+
+	// Verify overrides within the page.
+	if v, err := page.Evaluate(`function() {
+		return {
+			devicePixelRatio: window.devicePixelRatio,
+			screenWidth: screen.width,
+			screenHeight: screen.height,
+			touch: 'ontouchstart' in window,
+			userAgent: navigator.userAgent
+		};
+	}`); err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(v, map[string]interface{}{
+		"devicePixelRatio": float64(2),
+		"screenWidth":      float64(375),
+		"screenHeight":     float64(667),
+		"touch":            true,
+		"userAgent":        phantomjs.IPhone.UserAgent,
+	}) {
+		t.Fatalf("unexpected value: %#v", v)
+	}
+}
+
+// Ensure built-in devices can be found by name.
+func TestLookupDevice(t *testing.T) {
+	if d, ok := phantomjs.LookupDevice("ipad"); !ok {
+		t.Fatal("expected device")
+	} else if !reflect.DeepEqual(d, phantomjs.IPad) {
+		t.Fatalf("unexpected device: %#v", d)
+	}
+	if _, ok := phantomjs.LookupDevice("no such device"); ok {
+		t.Fatal("expected no device")
+	}
+}
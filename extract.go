@@ -0,0 +1,311 @@
+package phantomjs
+
+import (
+	"encoding"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrInvalidExtractTarget is returned by Extract() when not passed a non-nil
+// pointer to a struct.
+var ErrInvalidExtractTarget = errors.New("extract target must be a non-nil pointer to a struct")
+
+// Extract fills the struct pointed to by v with values from the current
+// document. Fields are mapped to elements using "phantom" struct tags:
+//
+//	type Product struct {
+//		Name    string    `phantom:"css=h1"`
+//		Price   float64   `phantom:"css=.price"`
+//		SKU     string    `phantom:"css=.sku;attr=data-sku"`
+//		Link    string    `phantom:"css=a.details;prop=href"`
+//		Added   time.Time `phantom:"css=.added;layout=2006-01-02"`
+//		Reviews []Review  `phantom:"css=.review"`
+//	}
+//
+// The "css" key selects the first matching element within the parent element.
+// Slice fields select all matching elements. Struct fields are extracted
+// relative to their element, or to the parent element if "css" is omitted.
+//
+// Values are the trimmed text content of the element unless "attr" names an
+// attribute or "prop" names an element property. Strings, bools, ints, uints,
+// floats, time.Time and encoding.TextUnmarshaler types are supported. Numbers
+// ignore non-numeric characters such as currency symbols and separators.
+// Times are parsed with "layout", or RFC 3339 if omitted. Pointer fields are
+// left nil when no element matches. Fields without a tag are skipped, except
+// untagged structs which are extracted relative to the parent element.
+//
+// The extraction runs as a single call to the page.
+func (p *WebPage) Extract(v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return ErrInvalidExtractTarget
+	}
+
+	schema, err := newExtractSchema(rv.Elem().Type())
+	if err != nil {
+		return err
+	}
+
+	var result interface{}
+	if err := p.evaluate(&result, extractScript, schema); err != nil {
+		return err
+	}
+	return schema.decode(rv.Elem(), result, "")
+}
+
+// extractScript walks a schema and returns the extracted values.
+const extractScript = `function(schema) {
+	function value(el, node) {
+		if (node.attr) return el.getAttribute(node.attr);
+		if (node.prop) return el[node.prop] == null ? null : String(el[node.prop]);
+		return (el.textContent || '').trim();
+	}
+	function object(el, node) {
+		var o = {};
+		for (var i = 0; i < node.fields.length; i++) {
+			o[node.fields[i].name] = extract(el, node.fields[i].node);
+		}
+		return o;
+	}
+	function item(el, node) {
+		return node.fields ? object(el, node) : value(el, node);
+	}
+	function extract(root, node) {
+		if (node.list) {
+			var els = root.querySelectorAll(node.css), a = [];
+			for (var i = 0; i < els.length; i++) a.push(item(els[i], node));
+			return a;
+		}
+		var el = node.css ? root.querySelector(node.css) : root;
+		return el ? item(el, node) : null;
+	}
+	return extract(document, schema);
+}`
+
+// extractSchema describes how to extract a value from the document.
+// It is sent to the page as JSON and also used to decode the result.
+type extractSchema struct {
+	CSS    string         `json:"css,omitempty"`
+	Attr   string         `json:"attr,omitempty"`
+	Prop   string         `json:"prop,omitempty"`
+	List   bool           `json:"list,omitempty"`
+	Fields []extractField `json:"fields"` // nil for single values
+
+	layout string
+	index  []int // field index within the parent struct
+}
+
+// extractField represents a named struct field in a schema.
+type extractField struct {
+	Name string         `json:"name"`
+	Node *extractSchema `json:"node"`
+}
+
+var (
+	timeType            = reflect.TypeOf(time.Time{})
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// newExtractSchema returns the schema for the fields of struct type typ.
+func newExtractSchema(typ reflect.Type) (*extractSchema, error) {
+	return buildExtractSchema(typ, make(map[reflect.Type]bool))
+}
+
+// buildExtractSchema returns the schema for typ. The types currently being
+// built are tracked in parents so recursive types return an error.
+func buildExtractSchema(typ reflect.Type, parents map[reflect.Type]bool) (*extractSchema, error) {
+	if parents[typ] {
+		return nil, fmt.Errorf("recursive type %s cannot be extracted", typ)
+	}
+	parents[typ] = true
+	defer delete(parents, typ)
+
+	s := &extractSchema{Fields: []extractField{}}
+	for i := 0; i < typ.NumField(); i++ {
+		f := typ.Field(i)
+		if f.PkgPath != "" {
+			continue // unexported
+		}
+
+		tag, ok := f.Tag.Lookup("phantom")
+		if tag == "-" {
+			continue
+		}
+
+		node := &extractSchema{index: f.Index}
+		for _, kv := range strings.Split(tag, ";") {
+			if kv = strings.TrimSpace(kv); kv == "" {
+				continue
+			}
+			j := strings.IndexByte(kv, '=')
+			if j < 0 {
+				return nil, fmt.Errorf("invalid phantom tag on %s.%s: %q", typ.Name(), f.Name, kv)
+			}
+			switch key, value := strings.TrimSpace(kv[:j]), strings.TrimSpace(kv[j+1:]); key {
+			case "css":
+				node.CSS = value
+			case "attr":
+				node.Attr = value
+			case "prop":
+				node.Prop = value
+			case "layout":
+				node.layout = value
+			default:
+				return nil, fmt.Errorf("unknown phantom tag key on %s.%s: %q", typ.Name(), f.Name, key)
+			}
+		}
+
+		// Determine shape from the field type.
+		ft := f.Type
+		if ft.Kind() == reflect.Slice && ft.Elem().Kind() != reflect.Uint8 {
+			node.List, ft = true, ft.Elem()
+		}
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+
+		// Untagged fields are only extracted if they hold nested structs.
+		isStruct := isExtractStruct(ft)
+		if !ok && !isStruct {
+			continue
+		} else if node.List && node.CSS == "" {
+			return nil, fmt.Errorf("slice field %s.%s requires a css selector", typ.Name(), f.Name)
+		}
+
+		if isStruct {
+			sub, err := buildExtractSchema(ft, parents)
+			if err != nil {
+				return nil, err
+			}
+			node.Fields = sub.Fields
+		}
+
+		s.Fields = append(s.Fields, extractField{Name: f.Name, Node: node})
+	}
+	return s, nil
+}
+
+// isExtractStruct returns true if typ is extracted as a nested struct rather
+// than decoded from a single value.
+func isExtractStruct(typ reflect.Type) bool {
+	if typ.Kind() != reflect.Struct || typ == timeType {
+		return false
+	}
+	return !reflect.PtrTo(typ).Implements(textUnmarshalerType)
+}
+
+// decode assigns an extracted value to v. The field path, such as
+// "Reviews[0].Author", is used in error messages.
+func (s *extractSchema) decode(v reflect.Value, data interface{}, path string) error {
+	if data == nil {
+		return nil
+	}
+
+	// Allocate pointers for values which exist.
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		v = v.Elem()
+	}
+
+	switch {
+	case s.List && v.Kind() == reflect.Slice:
+		items, _ := data.([]interface{})
+		slice := reflect.MakeSlice(v.Type(), len(items), len(items))
+		item := *s
+		item.List = false
+		for i, data := range items {
+			if err := item.decode(slice.Index(i), data, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+		v.Set(slice)
+		return nil
+
+	case s.Fields != nil:
+		m, _ := data.(map[string]interface{})
+		for _, f := range s.Fields {
+			name := f.Name
+			if path != "" {
+				name = path + "." + f.Name
+			}
+			if err := f.Node.decode(v.FieldByIndex(f.Node.index), m[f.Name], name); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	str, _ := data.(string)
+	if err := decodeExtractValue(v, str, s.layout); err != nil {
+		return fmt.Errorf("extract %s: cannot decode %q into %s: %w", path, str, v.Type(), err)
+	}
+	return nil
+}
+
+// decodeExtractValue parses s into v based on the type of v.
+func decodeExtractValue(v reflect.Value, s, layout string) error {
+	if v.Type() == timeType {
+		if layout == "" {
+			layout = time.RFC3339
+		}
+		t, err := time.Parse(layout, s)
+		if err != nil {
+			return err
+		}
+		v.Set(reflect.ValueOf(t))
+		return nil
+	} else if u, ok := v.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return u.UnmarshalText([]byte(s))
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Slice:
+		v.SetBytes([]byte(s))
+	case reflect.Bool:
+		b, err := strconv.ParseBool(strings.TrimSpace(s))
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(numeric(s), 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(numeric(s), 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(numeric(s), v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(n)
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+	return nil
+}
+
+// numeric returns s with all characters removed except digits, signs and
+// decimal points. For example, "$1,234.50" becomes "1234.50".
+func numeric(s string) string {
+	return strings.Map(func(r rune) rune {
+		if (r >= '0' && r <= '9') || r == '.' || r == '-' || r == '+' {
+			return r
+		}
+		return -1
+	}, s)
+}
@@ -0,0 +1,156 @@
+package phantomjs_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/phantomjs"
+)
+
+// Ensure web page can extract document values into a struct.
+func TestWebPage_Extract(t *testing.T) {
+	p := MustOpenNewProcess()
+	defer p.MustClose()
+
+	page := p.MustCreateWebPage()
+	defer MustClosePage(page)
+	if err := page.SetContentAndURL(`<html><body>
+		<h1> Widget </h1>
+		<span class="price">$1,234.50</span>
+		<span class="stock" data-count="12">In stock</span>
+		<a class="details" href="/widget">Details</a>
+		<time>2020-01-02</time>
+		<ul>
+			<li class="review"><b>Alice</b><i>5</i></li>
+			<li class="review"><b>Bob</b><i>3</i></li>
+		</ul>
+		<span class="tag">a</span><span class="tag">b</span>
+	</body></html>`, "http://example.com/products/"); err != nil {
+		t.Fatal(err)
+	}
+
+	type Review struct {
+		Author string `phantom:"css=b"`
+		Rating int    `phantom:"css=i"`
+	}
+	var v struct {
+		Name    string    `phantom:"css=h1"`
+		Price   float64   `phantom:"css=.price"`
+		Stock   int       `phantom:"css=.stock;attr=data-count"`
+		Link    string    `phantom:"css=a.details;prop=href"`
+		Added   time.Time `phantom:"css=time;layout=2006-01-02"`
+		Reviews []Review  `phantom:"css=.review"`
+		Tags    []string  `phantom:"css=.tag"`
+		Missing *string   `phantom:"css=.missing"`
+		Ignored string
+	}
+	if err := page.Extract(&v); err != nil {
+		t.Fatal(err)
+	}
+
+	if v.Name != "Widget" {
+		t.Fatalf("unexpected name: %q", v.Name)
+	} else if v.Price != 1234.50 {
+		t.Fatalf("unexpected price: %v", v.Price)
+	} else if v.Stock != 12 {
+		t.Fatalf("unexpected stock: %d", v.Stock)
+	} else if v.Link != "http://example.com/widget" {
+		t.Fatalf("unexpected link: %s", v.Link)
+	} else if !v.Added.Equal(time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("unexpected added: %s", v.Added)
+	} else if !reflect.DeepEqual(v.Reviews, []Review{{"Alice", 5}, {"Bob", 3}}) {
+		t.Fatalf("unexpected reviews: %#v", v.Reviews)
+	} else if !reflect.DeepEqual(v.Tags, []string{"a", "b"}) {
+		t.Fatalf("unexpected tags: %#v", v.Tags)
+	} else if v.Missing != nil {
+		t.Fatalf("unexpected missing: %q", *v.Missing)
+	}
+
+	// Ensure a decoding error reports the field.
+	var invalid struct {
+		Name int `phantom:"css=h1"`
+	}
+	if err := page.Extract(&invalid); err == nil || err.Error() != `extract Name: cannot decode "Widget" into int: strconv.ParseInt: parsing "": invalid syntax` {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Ensure the target must be a pointer to a struct.
+	if err := page.Extract(v); err != phantomjs.ErrInvalidExtractTarget {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+// Ensure recursive types return an error instead of overflowing the stack.
+func TestWebPage_Extract_Recursive(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"ref":{"id":"1"}}`))
+	}))
+	defer srv.Close()
+
+	p := phantomjs.NewProcess()
+	p.BaseURL = srv.URL
+	page, err := p.CreateWebPage()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type treeNode struct {
+		Name   string `phantom:"css=.name"`
+		Parent *treeNode
+	}
+	var node treeNode
+	if err := page.Extract(&node); err == nil || err.Error() != "recursive type phantomjs_test.treeNode cannot be extracted" {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	type category struct {
+		Subcategories []category `phantom:"css=.child"`
+	}
+	var cat category
+	if err := page.Extract(&cat); err == nil || err.Error() != "recursive type phantomjs_test.category cannot be extracted" {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+// Ensure untagged slice fields are skipped rather than requiring a selector.
+func TestWebPage_Extract_UntaggedSlice(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/webpage/Evaluate" {
+			w.Write([]byte(`{"returnValue":{"Name":"Widget"}}`))
+			return
+		}
+		w.Write([]byte(`{"ref":{"id":"1"}}`))
+	}))
+	defer srv.Close()
+
+	p := phantomjs.NewProcess()
+	p.BaseURL = srv.URL
+	page, err := p.CreateWebPage()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v := struct {
+		Name  string `phantom:"css=h1"`
+		Notes []string
+	}{Notes: []string{"kept"}}
+	if err := page.Extract(&v); err != nil {
+		t.Fatal(err)
+	} else if v.Name != "Widget" {
+		t.Fatalf("unexpected name: %q", v.Name)
+	} else if !reflect.DeepEqual(v.Notes, []string{"kept"}) {
+		t.Fatalf("unexpected notes: %#v", v.Notes)
+	}
+
+	// Ensure tagged slice fields still require a selector.
+	type product struct {
+		Notes []string `phantom:"attr=title"`
+	}
+	var invalid product
+	if err := page.Extract(&invalid); err == nil || err.Error() != "slice field product.Notes requires a css selector" {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,68 @@
+package phantomjs
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/gif"
+	"io"
+)
+
+// gifHeaderSize is the size of the GIF header and logical screen descriptor
+// written by gif.EncodeAll() when there is no global color table.
+const gifHeaderSize = 13
+
+// gifLoopForever is the application extension which makes an animated GIF
+// loop forever.
+var gifLoopForever = []byte{
+	0x21, 0xFF, 0x0B, 'N', 'E', 'T', 'S', 'C', 'A', 'P', 'E', '2', '.', '0',
+	0x03, 0x01, 0x00, 0x00, 0x00,
+}
+
+// gifStreamWriter writes an animated GIF to w one frame at a time so that
+// frames do not need to be held in memory until encoding. Each frame is
+// encoded with its own color table. The logical screen size is taken from the
+// first frame.
+type gifStreamWriter struct {
+	w   io.Writer
+	n   int // frames written
+	buf bytes.Buffer
+}
+
+// writeFrame encodes a frame with a delay in hundredths of a second.
+func (gw *gifStreamWriter) writeFrame(frame *image.Paletted, delay int) error {
+	gw.buf.Reset()
+	if err := gif.EncodeAll(&gw.buf, &gif.GIF{
+		Image: []*image.Paletted{frame},
+		Delay: []int{delay},
+	}); err != nil {
+		return err
+	}
+
+	// Split the encoded image into its header, image blocks and trailer.
+	b := gw.buf.Bytes()
+	if len(b) <= gifHeaderSize || b[len(b)-1] != 0x3B {
+		return errors.New("gif: unexpected encoding")
+	}
+	if gw.n == 0 {
+		if _, err := gw.w.Write(b[:gifHeaderSize]); err != nil {
+			return err
+		} else if _, err := gw.w.Write(gifLoopForever); err != nil {
+			return err
+		}
+	}
+	if _, err := gw.w.Write(b[gifHeaderSize : len(b)-1]); err != nil {
+		return err
+	}
+	gw.n++
+	return nil
+}
+
+// close writes the GIF trailer. Returns an error if no frames were written.
+func (gw *gifStreamWriter) close() error {
+	if gw.n == 0 {
+		return errors.New("gif: no frames written")
+	}
+	_, err := gw.w.Write([]byte{0x3B})
+	return err
+}
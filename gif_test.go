@@ -0,0 +1,57 @@
+package phantomjs
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/gif"
+	"testing"
+)
+
+// Ensure frames written one at a time decode as an animated GIF.
+func TestGIFStreamWriter(t *testing.T) {
+	var buf bytes.Buffer
+	gw := &gifStreamWriter{w: &buf}
+	colors := []color.Color{color.White, color.Black, palette.Plan9[100]}
+	for _, c := range colors {
+		frame := image.NewPaletted(image.Rect(0, 0, 4, 3), palette.Plan9)
+		for i := range frame.Pix {
+			frame.Pix[i] = uint8(frame.Palette.Index(c))
+		}
+		if err := gw.writeFrame(frame, 5); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := gw.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	g, err := gif.DecodeAll(&buf)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(g.Image) != len(colors) {
+		t.Fatalf("unexpected frame count: %d", len(g.Image))
+	} else if g.LoopCount != 0 {
+		t.Fatalf("unexpected loop count: %d", g.LoopCount)
+	} else if g.Config.Width != 4 || g.Config.Height != 3 {
+		t.Fatalf("unexpected size: %dx%d", g.Config.Width, g.Config.Height)
+	}
+	for i, img := range g.Image {
+		r0, g0, b0, _ := img.At(2, 1).RGBA()
+		r1, g1, b1, _ := colors[i].RGBA()
+		if r0 != r1 || g0 != g1 || b0 != b1 {
+			t.Fatalf("unexpected color in frame %d: %v", i, img.At(2, 1))
+		} else if g.Delay[i] != 5 {
+			t.Fatalf("unexpected delay in frame %d: %d", i, g.Delay[i])
+		}
+	}
+}
+
+// Ensure a GIF without frames cannot be closed.
+func TestGIFStreamWriter_NoFrames(t *testing.T) {
+	var buf bytes.Buffer
+	if err := (&gifStreamWriter{w: &buf}).close(); err == nil {
+		t.Fatal("expected error")
+	}
+}
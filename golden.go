@@ -0,0 +1,193 @@
+package phantomjs
+
+import (
+	"bytes"
+	"encoding/base64"
+	"flag"
+	"image"
+	"image/color"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// UpdateGolden forces CompareScreenshot() to rewrite golden files instead of
+// comparing against them. Golden files are also rewritten when the test
+// binary defines a boolean "update" flag and it is set:
+//
+//	var _ = flag.Bool("update", false, "rewrite golden files")
+//
+// The flag is not registered by this package so that it cannot conflict with
+// flags defined by the test binary. Importing phantomjstest registers it.
+var UpdateGolden bool
+
+// Tolerance represents the differences allowed by CompareScreenshot().
+type Tolerance struct {
+	// Maximum difference between two pixels for any color channel, 0-255.
+	Channel uint8
+
+	// Number of differing pixels allowed before the comparison fails.
+	Pixels int
+
+	// Regions excluded from comparison, such as timestamps or animations.
+	Ignore []image.Rectangle
+}
+
+// ignored returns true if pt is within an ignored region.
+func (tol Tolerance) ignored(pt image.Point) bool {
+	for _, r := range tol.Ignore {
+		if pt.In(r) {
+			return true
+		}
+	}
+	return false
+}
+
+// Colors used when highlighting differences.
+var (
+	diffColor    = color.RGBA{R: 0xFF, A: 0xFF}
+	ignoredColor = color.RGBA{R: 0x80, G: 0x80, B: 0xFF, A: 0xFF}
+)
+
+// CompareImages compares got against want and returns the number of pixels
+// that differ by more than the tolerance.
+//
+// The returned diff image contains a faded copy of got with differing pixels
+// highlighted in red and ignored regions highlighted in blue. Pixels outside
+// the bounds of either image are always considered different.
+func CompareImages(want, got image.Image, tol Tolerance) (n int, diff *image.RGBA) {
+	bounds := want.Bounds().Union(got.Bounds())
+	diff = image.NewRGBA(bounds)
+
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			pt := image.Pt(x, y)
+			switch {
+			case tol.ignored(pt):
+				diff.SetRGBA(x, y, ignoredColor)
+			case !pt.In(want.Bounds()) || !pt.In(got.Bounds()):
+				diff.SetRGBA(x, y, diffColor)
+				n++
+			case !colorsMatch(want.At(x, y), got.At(x, y), tol.Channel):
+				diff.SetRGBA(x, y, diffColor)
+				n++
+			default:
+				diff.SetRGBA(x, y, fade(got.At(x, y)))
+			}
+		}
+	}
+	return n, diff
+}
+
+// colorsMatch returns true if every channel of a and b is within threshold.
+func colorsMatch(a, b color.Color, threshold uint8) bool {
+	c0 := color.NRGBAModel.Convert(a).(color.NRGBA)
+	c1 := color.NRGBAModel.Convert(b).(color.NRGBA)
+	return channelDelta(c0.R, c1.R) <= threshold &&
+		channelDelta(c0.G, c1.G) <= threshold &&
+		channelDelta(c0.B, c1.B) <= threshold &&
+		channelDelta(c0.A, c1.A) <= threshold
+}
+
+// channelDelta returns the absolute difference between two channel values.
+func channelDelta(a, b uint8) uint8 {
+	if a > b {
+		return a - b
+	}
+	return b - a
+}
+
+// fade returns a light grayscale version of c used as diff image background.
+func fade(c color.Color) color.RGBA {
+	g := color.GrayModel.Convert(c).(color.Gray)
+	v := 0xC0 + g.Y/4
+	return color.RGBA{R: v, G: v, B: v, A: 0xFF}
+}
+
+// CompareScreenshot renders page as a PNG and compares it against the golden
+// image stored at goldenPath.
+//
+// If the images differ by more than the tolerance then a diff image is written
+// next to the golden file with a ".diff.png" extension and the test is marked
+// as failed. If UpdateGolden or the "-update" flag is set then the golden file
+// is rewritten with the rendered image instead.
+func CompareScreenshot(t testing.TB, page *WebPage, goldenPath string, tol Tolerance) {
+	t.Helper()
+
+	// Render the page to an image.
+	data, err := page.RenderBase64("png")
+	if err != nil {
+		t.Fatalf("render: %s", err)
+	}
+	buf, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		t.Fatalf("decode render: %s", err)
+	}
+
+	// Rewrite golden file, if requested.
+	if updateGolden() {
+		if err := os.MkdirAll(filepath.Dir(goldenPath), 0777); err != nil {
+			t.Fatal(err)
+		} else if err := ioutil.WriteFile(goldenPath, buf, 0666); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	got, err := png.Decode(bytes.NewReader(buf))
+	if err != nil {
+		t.Fatalf("decode render: %s", err)
+	}
+	want, err := readPNG(goldenPath)
+	if os.IsNotExist(err) {
+		t.Fatalf("golden file not found, run with -update to create: %s", goldenPath)
+	} else if err != nil {
+		t.Fatalf("read golden file: %s", err)
+	}
+
+	// Compare and write diff image on failure.
+	n, diff := CompareImages(want, got, tol)
+	if n <= tol.Pixels {
+		return
+	}
+
+	diffPath := strings.TrimSuffix(goldenPath, filepath.Ext(goldenPath)) + ".diff.png"
+	var diffBuf bytes.Buffer
+	if err := png.Encode(&diffBuf, diff); err != nil {
+		t.Fatalf("encode diff: %s", err)
+	} else if err := ioutil.WriteFile(diffPath, diffBuf.Bytes(), 0666); err != nil {
+		t.Fatalf("write diff: %s", err)
+	}
+	t.Errorf("screenshot differs from %s by %d pixels, see %s", goldenPath, n, diffPath)
+}
+
+// updateGolden returns true if golden files should be rewritten.
+func updateGolden() bool {
+	if UpdateGolden {
+		return true
+	}
+
+	f := flag.Lookup("update")
+	if f == nil {
+		return false
+	}
+	g, ok := f.Value.(flag.Getter)
+	if !ok {
+		return false
+	}
+	v, _ := g.Get().(bool)
+	return v
+}
+
+// readPNG decodes the PNG image stored at path.
+func readPNG(path string) (image.Image, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return png.Decode(f)
+}
@@ -0,0 +1,100 @@
+package phantomjs_test
+
+import (
+	"image"
+	"image/color"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/benbjohnson/phantomjs"
+)
+
+// Ensure identical images have no differences.
+func TestCompareImages_Equal(t *testing.T) {
+	a := newSolidImage(10, 10, color.RGBA{R: 10, G: 20, B: 30, A: 255})
+	b := newSolidImage(10, 10, color.RGBA{R: 10, G: 20, B: 30, A: 255})
+	if n, diff := phantomjs.CompareImages(a, b, phantomjs.Tolerance{}); n != 0 {
+		t.Fatalf("unexpected diff count: %d", n)
+	} else if diff.Bounds() != a.Bounds() {
+		t.Fatalf("unexpected diff bounds: %v", diff.Bounds())
+	}
+}
+
+// Ensure per-channel differences within the threshold are allowed.
+func TestCompareImages_Channel(t *testing.T) {
+	a := newSolidImage(10, 10, color.RGBA{R: 10, G: 20, B: 30, A: 255})
+	b := newSolidImage(10, 10, color.RGBA{R: 15, G: 20, B: 30, A: 255})
+	if n, _ := phantomjs.CompareImages(a, b, phantomjs.Tolerance{Channel: 5}); n != 0 {
+		t.Fatalf("unexpected diff count: %d", n)
+	}
+	if n, _ := phantomjs.CompareImages(a, b, phantomjs.Tolerance{Channel: 4}); n != 100 {
+		t.Fatalf("unexpected diff count: %d", n)
+	}
+}
+
+// Ensure differences within ignored regions are excluded.
+func TestCompareImages_Ignore(t *testing.T) {
+	a := newSolidImage(10, 10, color.White)
+	b := newSolidImage(10, 10, color.White)
+	for y := 0; y < 5; y++ {
+		for x := 0; x < 10; x++ {
+			b.Set(x, y, color.Black)
+		}
+	}
+
+	tol := phantomjs.Tolerance{Ignore: []image.Rectangle{image.Rect(0, 0, 10, 4)}}
+	if n, diff := phantomjs.CompareImages(a, b, tol); n != 10 {
+		t.Fatalf("unexpected diff count: %d", n)
+	} else if c := diff.RGBAAt(0, 4); c != (color.RGBA{R: 0xFF, A: 0xFF}) {
+		t.Fatalf("unexpected highlight: %#v", c)
+	}
+}
+
+// Ensure images with different sizes are reported as different.
+func TestCompareImages_Size(t *testing.T) {
+	a := newSolidImage(10, 10, color.White)
+	b := newSolidImage(10, 12, color.White)
+	if n, diff := phantomjs.CompareImages(a, b, phantomjs.Tolerance{}); n != 20 {
+		t.Fatalf("unexpected diff count: %d", n)
+	} else if diff.Bounds() != image.Rect(0, 0, 10, 12) {
+		t.Fatalf("unexpected diff bounds: %v", diff.Bounds())
+	}
+}
+
+// Ensure a page can be compared against a golden image.
+func TestCompareScreenshot(t *testing.T) {
+	p := MustOpenNewProcess()
+	defer p.MustClose()
+
+	page := p.MustCreateWebPage()
+	defer MustClosePage(page)
+	if err := page.SetContent(`<html><body style="background:blue"></body></html>`); err != nil {
+		t.Fatal(err)
+	} else if err := page.SetViewportSize(100, 100); err != nil {
+		t.Fatal(err)
+	}
+
+	// Write the golden file.
+	path := filepath.Join(t.TempDir(), "page.png")
+	phantomjs.UpdateGolden = true
+	phantomjs.CompareScreenshot(t, page, path, phantomjs.Tolerance{})
+	phantomjs.UpdateGolden = false
+
+	// Compare against the golden file.
+	phantomjs.CompareScreenshot(t, page, path, phantomjs.Tolerance{})
+	if _, err := os.Stat(filepath.Join(filepath.Dir(path), "page.diff.png")); !os.IsNotExist(err) {
+		t.Fatal("expected no diff file")
+	}
+}
+
+// newSolidImage returns an image of the given size filled with c.
+func newSolidImage(w, h int, c color.Color) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, c)
+		}
+	}
+	return img
+}
@@ -0,0 +1,619 @@
+package phantomjs
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// InterceptProxy is an HTTP forward proxy run within the Go process. When set
+// on Process.Intercept, all traffic from PhantomJS is routed through it so
+// requests can be recorded, mocked, delayed, throttled or failed.
+//
+// HTTPS requests are tunneled to their destination unless MITM is enabled, in
+// which case they are decrypted using certificates signed by a generated CA.
+type InterceptProxy struct {
+	// If true, decrypts HTTPS traffic so it can be recorded and mocked.
+	// The process is started with "--ignore-ssl-errors=true" so the
+	// generated certificates are accepted.
+	MITM bool
+
+	// If true, completed exchanges are stored and returned by Exchanges().
+	Record bool
+
+	// Called after each completed exchange, if set.
+	OnExchange func(*Exchange)
+
+	// Transport used to send requests upstream.
+	// Defaults to a transport which does not use a proxy.
+	Transport http.RoundTripper
+
+	mu        sync.Mutex
+	rules     []interceptRule
+	exchanges []*Exchange
+	latency   time.Duration
+	download  int // kbps
+	upload    int // kbps
+
+	ln      net.Listener
+	srv     *http.Server
+	tunnels map[io.Closer]struct{} // open HTTPS tunnels
+	closed  bool
+
+	ca    *x509.Certificate
+	caKey *ecdsa.PrivateKey
+	certs map[string]*tls.Certificate
+}
+
+// Exchange represents a request & response passed through an InterceptProxy.
+type Exchange struct {
+	Method         string
+	URL            string
+	RequestHeader  http.Header
+	RequestBody    []byte
+	StatusCode     int
+	ResponseHeader http.Header
+	ResponseBody   []byte
+
+	// True if the response was served by a mock handler.
+	Mocked bool
+
+	// Set if the request failed or was deliberately aborted.
+	Err error
+
+	Time     time.Time
+	Duration time.Duration
+}
+
+// ErrRequestAborted is recorded on exchanges aborted by InterceptProxy.Fail().
+var ErrRequestAborted = errors.New("request aborted")
+
+// interceptRule represents a mock or failure applied to matching URLs.
+type interceptRule struct {
+	re      *regexp.Regexp
+	handler http.Handler // nil to abort the connection
+}
+
+// NewInterceptProxy returns a new instance of InterceptProxy.
+func NewInterceptProxy() *InterceptProxy {
+	return &InterceptProxy{
+		Transport: &http.Transport{},
+		certs:     make(map[string]*tls.Certificate),
+	}
+}
+
+// Open starts listening on a random local port.
+func (ip *InterceptProxy) Open() error {
+	if ip.MITM {
+		if err := ip.generateCA(); err != nil {
+			return err
+		}
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return err
+	}
+	ip.ln = ln
+	ip.srv = &http.Server{Handler: ip}
+	go ip.srv.Serve(ln)
+	return nil
+}
+
+// Close stops the proxy and closes any open HTTPS tunnels.
+func (ip *InterceptProxy) Close() error {
+	ip.mu.Lock()
+	ip.closed = true
+	for c := range ip.tunnels {
+		c.Close()
+	}
+	ip.tunnels = nil
+	ip.mu.Unlock()
+
+	if ip.srv != nil {
+		return ip.srv.Close()
+	}
+	return nil
+}
+
+// track adds c to the tunnels closed by Close(). Returns false if the proxy
+// is already closed, in which case c is closed immediately.
+func (ip *InterceptProxy) track(c io.Closer) bool {
+	ip.mu.Lock()
+	defer ip.mu.Unlock()
+	if ip.closed {
+		c.Close()
+		return false
+	}
+	if ip.tunnels == nil {
+		ip.tunnels = make(map[io.Closer]struct{})
+	}
+	ip.tunnels[c] = struct{}{}
+	return true
+}
+
+// untrack removes c from the open tunnels.
+func (ip *InterceptProxy) untrack(c io.Closer) {
+	ip.mu.Lock()
+	defer ip.mu.Unlock()
+	delete(ip.tunnels, c)
+}
+
+// Addr returns the host & port the proxy is listening on.
+func (ip *InterceptProxy) Addr() string {
+	if ip.ln == nil {
+		return ""
+	}
+	return ip.ln.Addr().String()
+}
+
+// Mock serves requests with URLs matching re using h instead of sending them
+// upstream. Rules are checked in the order they are added.
+func (ip *InterceptProxy) Mock(re *regexp.Regexp, h http.Handler) {
+	ip.mu.Lock()
+	defer ip.mu.Unlock()
+	ip.rules = append(ip.rules, interceptRule{re: re, handler: h})
+}
+
+// Fail aborts the connection of requests with URLs matching re.
+func (ip *InterceptProxy) Fail(re *regexp.Regexp) {
+	ip.mu.Lock()
+	defer ip.mu.Unlock()
+	ip.rules = append(ip.rules, interceptRule{re: re})
+}
+
+// ClearRules removes all mocks & failures.
+func (ip *InterceptProxy) ClearRules() {
+	ip.mu.Lock()
+	defer ip.mu.Unlock()
+	ip.rules = nil
+}
+
+// Throttle delays each request by latency and limits the transfer rate of
+// request & response bodies, in kilobits per second. Zero disables a limit.
+func (ip *InterceptProxy) Throttle(latency time.Duration, downloadKbps, uploadKbps int) {
+	ip.mu.Lock()
+	defer ip.mu.Unlock()
+	ip.latency, ip.download, ip.upload = latency, downloadKbps, uploadKbps
+}
+
+// Exchanges returns the recorded exchanges in the order they completed.
+func (ip *InterceptProxy) Exchanges() []*Exchange {
+	ip.mu.Lock()
+	defer ip.mu.Unlock()
+	return append([]*Exchange{}, ip.exchanges...)
+}
+
+// Reset removes all recorded exchanges.
+func (ip *InterceptProxy) Reset() {
+	ip.mu.Lock()
+	defer ip.mu.Unlock()
+	ip.exchanges = nil
+}
+
+// CACertificatePEM returns the PEM-encoded CA certificate used to sign
+// generated certificates. Returns nil if MITM is not enabled.
+func (ip *InterceptProxy) CACertificatePEM() []byte {
+	if ip.ca == nil {
+		return nil
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ip.ca.Raw})
+}
+
+// ServeHTTP implements the proxy's http.Handler.
+func (ip *InterceptProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodConnect {
+		ip.serveConnect(w, r)
+		return
+	}
+	ip.serveHTTP(w, r)
+}
+
+// conditions returns the current latency & bandwidth limits.
+func (ip *InterceptProxy) conditions() (latency time.Duration, download, upload int) {
+	ip.mu.Lock()
+	defer ip.mu.Unlock()
+	return ip.latency, ip.download, ip.upload
+}
+
+// match returns the first rule matching rawurl, if any.
+func (ip *InterceptProxy) match(rawurl string) (interceptRule, bool) {
+	ip.mu.Lock()
+	defer ip.mu.Unlock()
+	for _, rule := range ip.rules {
+		if rule.re.MatchString(rawurl) {
+			return rule, true
+		}
+	}
+	return interceptRule{}, false
+}
+
+// serveHTTP handles a proxied request with an absolute URL.
+func (ip *InterceptProxy) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	latency, download, upload := ip.conditions()
+	ex := &Exchange{
+		Method:        r.Method,
+		URL:           r.URL.String(),
+		RequestHeader: r.Header.Clone(),
+		Time:          time.Now(),
+	}
+	defer ip.complete(ex)
+
+	// Read request body at the upload rate.
+	body, err := ioutil.ReadAll(newThrottledReader(r.Body, upload))
+	if err != nil {
+		ex.Err = err
+		return
+	}
+	ex.RequestBody = body
+
+	if latency > 0 {
+		time.Sleep(latency)
+	}
+
+	// Apply mocks & failures.
+	rule, ok := ip.match(ex.URL)
+	if ok && rule.handler == nil {
+		ex.Err = ErrRequestAborted
+		if hj, ok := w.(http.Hijacker); ok {
+			if conn, _, err := hj.Hijack(); err == nil {
+				conn.Close()
+				return
+			}
+		}
+		panic(http.ErrAbortHandler)
+	}
+
+	var resp *http.Response
+	if ok {
+		ex.Mocked = true
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+		buf := newResponseBuffer()
+		rule.handler.ServeHTTP(buf, r)
+		resp = buf.response()
+	} else {
+		// Forward upstream. The transport decompresses responses so that
+		// recorded bodies are readable.
+		req := r.Clone(r.Context())
+		req.RequestURI = ""
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+		req.ContentLength = int64(len(body))
+		req.Header.Del("Accept-Encoding")
+		removeHopHeaders(req.Header)
+
+		if resp, err = ip.Transport.RoundTrip(req); err != nil {
+			ex.Err = err
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+	}
+	defer resp.Body.Close()
+
+	if ex.ResponseBody, err = ioutil.ReadAll(resp.Body); err != nil {
+		ex.Err = err
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	ex.StatusCode, ex.ResponseHeader = resp.StatusCode, resp.Header.Clone()
+
+	// Write response at the download rate.
+	removeHopHeaders(resp.Header)
+	for key, values := range resp.Header {
+		w.Header()[key] = values
+	}
+	w.WriteHeader(resp.StatusCode)
+	io.Copy(w, newThrottledReader(bytes.NewReader(ex.ResponseBody), download))
+}
+
+// complete records an exchange and notifies the callback.
+func (ip *InterceptProxy) complete(ex *Exchange) {
+	ex.Duration = time.Since(ex.Time)
+	if ip.Record {
+		ip.mu.Lock()
+		ip.exchanges = append(ip.exchanges, ex)
+		ip.mu.Unlock()
+	}
+	if ip.OnExchange != nil {
+		ip.OnExchange(ex)
+	}
+}
+
+// serveConnect handles an HTTPS tunnel request. The tunnel is decrypted if MITM
+// is enabled. Otherwise the connection is relayed to the destination.
+func (ip *InterceptProxy) serveConnect(w http.ResponseWriter, r *http.Request) {
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "hijacking not supported", http.StatusInternalServerError)
+		return
+	}
+	conn, _, err := hj.Hijack()
+	if err != nil {
+		return
+	}
+
+	if ip.MITM {
+		if _, err := io.WriteString(conn, "HTTP/1.1 200 Connection Established\r\n\r\n"); err != nil {
+			conn.Close()
+			return
+		}
+		ip.serveTLS(conn)
+		return
+	}
+
+	latency, download, upload := ip.conditions()
+	if latency > 0 {
+		time.Sleep(latency)
+	}
+
+	upstream, err := net.Dial("tcp", r.Host)
+	if err != nil {
+		io.WriteString(conn, "HTTP/1.1 502 Bad Gateway\r\n\r\n")
+		conn.Close()
+		return
+	}
+	if _, err := io.WriteString(conn, "HTTP/1.1 200 Connection Established\r\n\r\n"); err != nil {
+		conn.Close()
+		upstream.Close()
+		return
+	}
+
+	if !ip.track(conn) {
+		upstream.Close()
+		return
+	} else if !ip.track(upstream) {
+		ip.untrack(conn)
+		conn.Close()
+		return
+	}
+	defer ip.untrack(conn)
+	defer ip.untrack(upstream)
+
+	go func() {
+		io.Copy(upstream, newThrottledReader(conn, upload))
+		upstream.Close()
+	}()
+	io.Copy(conn, newThrottledReader(upstream, download))
+	conn.Close()
+}
+
+// serveTLS decrypts a tunneled connection and serves its requests.
+func (ip *InterceptProxy) serveTLS(conn net.Conn) {
+	tlsConn := tls.Server(conn, &tls.Config{GetCertificate: ip.certificate})
+	ln := newSingleConnListener(tlsConn)
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.URL.Scheme, r.URL.Host = "https", r.Host
+		ip.serveHTTP(w, r)
+	})}
+	if !ip.track(srv) {
+		tlsConn.Close()
+		return
+	}
+	defer ip.untrack(srv)
+	srv.Serve(ln)
+}
+
+// certificate returns a certificate for the requested server name, signed by
+// the generated CA. Certificates are cached by name.
+func (ip *InterceptProxy) certificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	name := hello.ServerName
+	if name == "" {
+		if host, _, err := net.SplitHostPort(hello.Conn.LocalAddr().String()); err == nil {
+			name = host
+		}
+	}
+
+	ip.mu.Lock()
+	defer ip.mu.Unlock()
+	if cert := ip.certs[name]; cert != nil {
+		return cert, nil
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, err
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	if ipAddr := net.ParseIP(name); ipAddr != nil {
+		tmpl.IPAddresses = []net.IP{ipAddr}
+	} else {
+		tmpl.DNSNames = []string{name}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ip.ca, &key.PublicKey, ip.caKey)
+	if err != nil {
+		return nil, err
+	}
+	cert := &tls.Certificate{Certificate: [][]byte{der, ip.ca.Raw}, PrivateKey: key}
+	ip.certs[name] = cert
+	return cert, nil
+}
+
+// generateCA creates the self-signed CA used to sign certificates.
+func (ip *InterceptProxy) generateCA() error {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "phantomjs intercept proxy CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return err
+	}
+	ca, err := x509.ParseCertificate(der)
+	if err != nil {
+		return err
+	}
+
+	ip.ca, ip.caKey = ca, key
+	if ip.certs == nil {
+		ip.certs = make(map[string]*tls.Certificate)
+	}
+	return nil
+}
+
+// responseBuffer is an http.ResponseWriter which buffers a mocked response.
+type responseBuffer struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func newResponseBuffer() *responseBuffer {
+	return &responseBuffer{header: make(http.Header)}
+}
+
+func (b *responseBuffer) Header() http.Header { return b.header }
+
+func (b *responseBuffer) WriteHeader(status int) {
+	if b.status == 0 {
+		b.status = status
+	}
+}
+
+func (b *responseBuffer) Write(p []byte) (int, error) {
+	b.WriteHeader(http.StatusOK)
+	return b.body.Write(p)
+}
+
+// response returns the buffered response. The status defaults to 200.
+func (b *responseBuffer) response() *http.Response {
+	b.WriteHeader(http.StatusOK)
+	return &http.Response{
+		StatusCode:    b.status,
+		Status:        http.StatusText(b.status),
+		Header:        b.header,
+		Body:          ioutil.NopCloser(&b.body),
+		ContentLength: int64(b.body.Len()),
+	}
+}
+
+// hopHeaders are removed when forwarding requests & responses.
+var hopHeaders = []string{
+	"Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Proxy-Connection",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+func removeHopHeaders(h http.Header) {
+	for _, key := range hopHeaders {
+		h.Del(key)
+	}
+}
+
+// throttledReader limits reads to a fixed rate, in kilobits per second.
+type throttledReader struct {
+	r    io.Reader
+	kbps int
+}
+
+// newThrottledReader returns r limited to kbps. Returns r if kbps is zero.
+func newThrottledReader(r io.Reader, kbps int) io.Reader {
+	if kbps <= 0 {
+		return r
+	}
+	return &throttledReader{r: r, kbps: kbps}
+}
+
+func (r *throttledReader) Read(p []byte) (int, error) {
+	// Read in chunks of roughly 100ms worth of data.
+	if max := r.kbps * 1000 / 8 / 10; max > 0 && len(p) > max {
+		p = p[:max]
+	}
+	n, err := r.r.Read(p)
+	if n > 0 {
+		time.Sleep(time.Duration(n) * 8 * time.Second / time.Duration(r.kbps*1000))
+	}
+	return n, err
+}
+
+// singleConnListener is a net.Listener which returns a single connection.
+// Accept blocks after the first call until the connection or listener is
+// closed.
+type singleConnListener struct {
+	conn      net.Conn
+	once      sync.Once
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+func newSingleConnListener(conn net.Conn) *singleConnListener {
+	ln := &singleConnListener{closed: make(chan struct{})}
+	ln.conn = &notifyCloseConn{Conn: conn, fn: ln.close}
+	return ln
+}
+
+func (ln *singleConnListener) Accept() (net.Conn, error) {
+	var conn net.Conn
+	ln.once.Do(func() { conn = ln.conn })
+	if conn != nil {
+		return conn, nil
+	}
+	<-ln.closed
+	return nil, errors.New("listener closed")
+}
+
+func (ln *singleConnListener) close() {
+	ln.closeOnce.Do(func() { close(ln.closed) })
+}
+
+func (ln *singleConnListener) Close() error {
+	ln.close()
+	return nil
+}
+
+func (ln *singleConnListener) Addr() net.Addr {
+	return ln.conn.LocalAddr()
+}
+
+// notifyCloseConn calls fn once the connection is closed.
+type notifyCloseConn struct {
+	net.Conn
+	once sync.Once
+	fn   func()
+}
+
+func (c *notifyCloseConn) Close() error {
+	c.once.Do(c.fn)
+	return c.Conn.Close()
+}
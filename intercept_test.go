@@ -0,0 +1,241 @@
+package phantomjs_test
+
+import (
+	"bufio"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/phantomjs"
+)
+
+// Ensure the proxy forwards requests upstream and records full exchanges.
+func TestInterceptProxy_Record(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		w.Header().Set("X-Upstream", "1")
+		fmt.Fprintf(w, "echo:%s", body)
+	}))
+	defer srv.Close()
+
+	ip := MustOpenInterceptProxy(false)
+	defer ip.Close()
+
+	resp, err := ip.Client().Post(srv.URL+"/echo", "text/plain", strings.NewReader("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "echo:hello" {
+		t.Fatalf("unexpected body: %s", body)
+	}
+
+	a := ip.Exchanges()
+	if len(a) != 1 {
+		t.Fatalf("unexpected exchange count: %d", len(a))
+	} else if ex := a[0]; ex.Method != "POST" || ex.URL != srv.URL+"/echo" {
+		t.Fatalf("unexpected request: %s %s", ex.Method, ex.URL)
+	} else if string(ex.RequestBody) != "hello" {
+		t.Fatalf("unexpected request body: %s", ex.RequestBody)
+	} else if ex.StatusCode != http.StatusOK || ex.ResponseHeader.Get("X-Upstream") != "1" {
+		t.Fatalf("unexpected response: %d %v", ex.StatusCode, ex.ResponseHeader)
+	} else if string(ex.ResponseBody) != "echo:hello" || ex.Mocked {
+		t.Fatalf("unexpected response body: %s", ex.ResponseBody)
+	}
+
+	ip.Reset()
+	if a := ip.Exchanges(); len(a) != 0 {
+		t.Fatalf("unexpected exchange count after reset: %d", len(a))
+	}
+}
+
+// Ensure matching requests are served by mocks or aborted.
+func TestInterceptProxy_Mock(t *testing.T) {
+	ip := MustOpenInterceptProxy(false)
+	defer ip.Close()
+
+	ip.Fail(regexp.MustCompile(`/fail$`))
+	ip.Mock(regexp.MustCompile(`^http://example\.invalid/`), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "mock:%s", r.URL.Path)
+	}))
+
+	resp, err := ip.Client().Get("http://example.invalid/foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "mock:/foo" {
+		t.Fatalf("unexpected body: %s", body)
+	}
+
+	if _, err := ip.Client().Get("http://example.invalid/fail"); err == nil {
+		t.Fatal("expected error")
+	}
+
+	a := ip.Exchanges()
+	if len(a) != 2 {
+		t.Fatalf("unexpected exchange count: %d", len(a))
+	} else if !a[0].Mocked {
+		t.Fatal("expected mocked exchange")
+	} else if a[1].Err != phantomjs.ErrRequestAborted {
+		t.Fatalf("unexpected error: %v", a[1].Err)
+	}
+}
+
+// Ensure the proxy delays requests by the configured latency.
+func TestInterceptProxy_Throttle(t *testing.T) {
+	ip := MustOpenInterceptProxy(false)
+	defer ip.Close()
+
+	ip.Throttle(200*time.Millisecond, 0, 0)
+	ip.Mock(regexp.MustCompile(`.`), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	t0 := time.Now()
+	resp, err := ip.Client().Get("http://example.invalid/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if d := time.Since(t0); d < 200*time.Millisecond {
+		t.Fatalf("expected latency: %s", d)
+	}
+}
+
+// Ensure HTTPS requests can be decrypted and recorded.
+func TestInterceptProxy_MITM(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("secure"))
+	}))
+	defer srv.Close()
+
+	ip := MustOpenInterceptProxy(true)
+	ip.Transport = srv.Client().Transport
+	defer ip.Close()
+
+	resp, err := ip.Client().Get(srv.URL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "secure" {
+		t.Fatalf("unexpected body: %s", body)
+	}
+
+	if a := ip.Exchanges(); len(a) != 1 {
+		t.Fatalf("unexpected exchange count: %d", len(a))
+	} else if a[0].URL != srv.URL+"/" || string(a[0].ResponseBody) != "secure" {
+		t.Fatalf("unexpected exchange: %s %s", a[0].URL, a[0].ResponseBody)
+	}
+}
+
+// Ensure open HTTPS tunnels are closed when the proxy is closed.
+func TestInterceptProxy_Close(t *testing.T) {
+	upstream, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer upstream.Close()
+	go func() {
+		for {
+			conn, err := upstream.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	for _, mitm := range []bool{false, true} {
+		ip := MustOpenInterceptProxy(mitm)
+
+		conn, err := net.Dial("tcp", ip.Addr())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		fmt.Fprintf(conn, "CONNECT %s HTTP/1.1\r\nHost: %s\r\n\r\n", upstream.Addr(), upstream.Addr())
+		if line, err := bufio.NewReader(conn).ReadString('\n'); err != nil {
+			t.Fatal(err)
+		} else if !strings.Contains(line, "200") {
+			t.Fatalf("unexpected status: %q", line)
+		}
+
+		if err := ip.Close(); err != nil {
+			t.Fatal(err)
+		}
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		if _, err := conn.Read(make([]byte, 1)); err != io.EOF {
+			t.Fatalf("mitm=%v: expected tunnel to be closed, got %v", mitm, err)
+		}
+	}
+}
+
+// Ensure page traffic is routed through a process' intercepting proxy.
+func TestProcess_Intercept(t *testing.T) {
+	ip := phantomjs.NewInterceptProxy()
+	ip.Record = true
+	ip.Mock(regexp.MustCompile(`^http://example\.invalid/`), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<html><head><title>MOCKED</title></head></html>`))
+	}))
+
+	p := NewProcess()
+	p.Intercept = ip
+	if err := p.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer p.MustClose()
+
+	page := p.MustCreateWebPage()
+	defer MustClosePage(page)
+	if err := page.Open("http://example.invalid/"); err != nil {
+		t.Fatal(err)
+	} else if title, err := page.Title(); err != nil {
+		t.Fatal(err)
+	} else if title != "MOCKED" {
+		t.Fatalf("unexpected title: %s", title)
+	}
+
+	if a := ip.Exchanges(); len(a) == 0 || a[0].URL != "http://example.invalid/" {
+		t.Fatalf("unexpected exchanges: %v", a)
+	}
+}
+
+// InterceptProxy is a test wrapper for phantomjs.InterceptProxy.
+type InterceptProxy struct {
+	*phantomjs.InterceptProxy
+}
+
+// MustOpenInterceptProxy returns a new, open, recording proxy. Panic on error.
+func MustOpenInterceptProxy(mitm bool) *InterceptProxy {
+	ip := phantomjs.NewInterceptProxy()
+	ip.MITM, ip.Record = mitm, true
+	if err := ip.Open(); err != nil {
+		panic(err)
+	}
+	return &InterceptProxy{InterceptProxy: ip}
+}
+
+// Client returns an HTTP client which sends requests through the proxy and
+// trusts the proxy's CA.
+func (ip *InterceptProxy) Client() *http.Client {
+	u, _ := url.Parse("http://" + ip.Addr())
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(ip.CACertificatePEM())
+	return &http.Client{Transport: &http.Transport{
+		Proxy:           http.ProxyURL(u),
+		TLSClientConfig: &tls.Config{RootCAs: roots},
+	}}
+}
@@ -0,0 +1,107 @@
+package phantomjs
+
+import (
+	"errors"
+	"net"
+	"strconv"
+	"time"
+)
+
+// ErrProxyInUse is returned when network throttling and a proxy set with
+// SetProxy() are used on the same process.
+var ErrProxyInUse = errors.New("process already uses a proxy")
+
+// Profile represents simulated network conditions used by EmulateNetwork().
+type Profile struct {
+	// Delay added before each request is sent.
+	Latency time.Duration
+
+	// Transfer rate limits, in kilobits per second. Zero is unlimited.
+	DownloadKbps int
+	UploadKbps   int
+
+	// If true, all requests made by the page are aborted.
+	Offline bool
+}
+
+// Network profile presets.
+var (
+	NetworkNoThrottle = Profile{}
+	NetworkOffline    = Profile{Offline: true}
+	NetworkSlow3G     = Profile{Latency: 400 * time.Millisecond, DownloadKbps: 400, UploadKbps: 400}
+	NetworkFast3G     = Profile{Latency: 150 * time.Millisecond, DownloadKbps: 1600, UploadKbps: 750}
+	Network4G         = Profile{Latency: 50 * time.Millisecond, DownloadKbps: 9000, UploadKbps: 9000}
+)
+
+// EmulateNetwork simulates network conditions for subsequent requests.
+//
+// Offline mode applies only to this page. Latency and bandwidth limits are
+// applied by a local relay which the process is routed through, so they apply
+// to all pages in the process. If the process has an intercepting proxy then
+// it is used as the relay. Otherwise the relay cannot be combined with a proxy
+// so ErrProxyInUse is returned if one was set with SetProxy() or the process
+// options, and SetProxy() fails once the relay is running.
+func (p *WebPage) EmulateNetwork(profile Profile) error {
+	req := map[string]interface{}{
+		"ref":     p.ref.id,
+		"offline": profile.Offline,
+	}
+	if err := p.doJSON("POST", "/webpage/SetNetworkOffline", req, nil); err != nil {
+		return err
+	}
+
+	throttled := profile.Latency > 0 || profile.DownloadKbps > 0 || profile.UploadKbps > 0
+	relay, err := p.ref.process.networkRelay(throttled)
+	if err != nil {
+		return err
+	} else if relay != nil {
+		relay.Throttle(profile.Latency, profile.DownloadKbps, profile.UploadKbps)
+	}
+	return nil
+}
+
+// networkRelay returns the proxy used to throttle the process' traffic.
+// If create is true then a relay is started if one does not exist.
+// Returns nil if there is no relay and create is false.
+func (p *Process) networkRelay(create bool) (*InterceptProxy, error) {
+	if p.Intercept != nil {
+		return p.Intercept, nil
+	}
+
+	p.mu.Lock()
+	relay := p.relay
+	p.mu.Unlock()
+	if relay != nil || !create {
+		return relay, nil
+	}
+
+	// Serialize with SetProxy() without holding p.mu across API calls.
+	p.proxyMu.Lock()
+	defer p.proxyMu.Unlock()
+
+	p.mu.Lock()
+	relay, inUse := p.relay, p.hasProxy()
+	p.mu.Unlock()
+	if relay != nil {
+		return relay, nil
+	} else if inUse {
+		return nil, ErrProxyInUse
+	}
+
+	relay = NewInterceptProxy()
+	if err := relay.Open(); err != nil {
+		return nil, err
+	}
+
+	host, port, _ := net.SplitHostPort(relay.Addr())
+	n, _ := strconv.Atoi(port)
+	if err := p.setProxy(ProxyConfig{Host: host, Port: n}); err != nil {
+		relay.Close()
+		return nil, err
+	}
+
+	p.mu.Lock()
+	p.relay = relay
+	p.mu.Unlock()
+	return relay, nil
+}
@@ -0,0 +1,126 @@
+package phantomjs_test
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/phantomjs"
+)
+
+// Ensure a page can simulate slow networks and being offline.
+func TestWebPage_EmulateNetwork(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<html><head><title>OK</title></head></html>`))
+	}))
+	defer srv.Close()
+
+	p := MustOpenNewProcess()
+	defer p.MustClose()
+
+	page := p.MustCreateWebPage()
+	defer MustClosePage(page)
+
+	t.Run("Latency", func(t *testing.T) {
+		if err := page.EmulateNetwork(phantomjs.Profile{Latency: 500 * time.Millisecond}); err != nil {
+			t.Fatal(err)
+		}
+
+		t0 := time.Now()
+		if err := page.Open(srv.URL); err != nil {
+			t.Fatal(err)
+		} else if d := time.Since(t0); d < 500*time.Millisecond {
+			t.Fatalf("expected latency: %s", d)
+		}
+	})
+
+	t.Run("Offline", func(t *testing.T) {
+		if err := page.EmulateNetwork(phantomjs.NetworkOffline); err != nil {
+			t.Fatal(err)
+		} else if err := page.Open(srv.URL); err == nil {
+			t.Fatal("expected error")
+		}
+	})
+
+	t.Run("Online", func(t *testing.T) {
+		if err := page.EmulateNetwork(phantomjs.NetworkNoThrottle); err != nil {
+			t.Fatal(err)
+		} else if err := page.Open(srv.URL); err != nil {
+			t.Fatal(err)
+		} else if title, err := page.Title(); err != nil {
+			t.Fatal(err)
+		} else if title != "OK" {
+			t.Fatalf("unexpected title: %s", title)
+		}
+	})
+}
+
+// Ensure throttling is not combined with a proxy set on the process.
+func TestWebPage_EmulateNetwork_ProxyInUse(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"ref":{"id":"1"}}`))
+	}))
+	defer srv.Close()
+
+	p := phantomjs.NewProcess()
+	p.BaseURL = srv.URL
+	p.Options = []string{"--proxy=127.0.0.1:3128"}
+	page, err := p.CreateWebPage()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := page.EmulateNetwork(phantomjs.NetworkSlow3G); err != phantomjs.ErrProxyInUse {
+		t.Fatalf("unexpected error: %v", err)
+	} else if err := page.EmulateNetwork(phantomjs.NetworkOffline); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Ensure throttling starts a relay and sets it as the process' proxy.
+func TestWebPage_EmulateNetwork_Relay(t *testing.T) {
+	var mu sync.Mutex
+	var paths []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		paths = append(paths, r.URL.Path)
+		mu.Unlock()
+		if r.URL.Path == "/phantom/SetProxy" {
+			w.Write([]byte(`{}`))
+			return
+		}
+		w.Write([]byte(`{"ref":{"id":"1"}}`))
+	}))
+	defer srv.Close()
+
+	p := phantomjs.NewProcess()
+	p.BaseURL = srv.URL
+	defer p.Close()
+	page, err := p.CreateWebPage()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	rec := p.Recorder(&buf)
+	if err := page.EmulateNetwork(phantomjs.NetworkSlow3G); err != nil {
+		t.Fatal(err)
+	} else if err := rec.Stop(); err != nil {
+		t.Fatal(err)
+	} else if !strings.Contains(buf.String(), "/phantom/SetProxy") {
+		t.Fatalf("expected recorded proxy call: %s", buf.String())
+	} else if err := p.SetProxy(phantomjs.ProxyConfig{Host: "127.0.0.1", Port: 3128}); err != phantomjs.ErrProxyInUse {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if exp := []string{"/webpage/Create", "/webpage/SetNetworkOffline", "/phantom/SetProxy"}; !reflect.DeepEqual(paths, exp) {
+		t.Fatalf("unexpected calls: %v", paths)
+	}
+}
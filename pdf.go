@@ -0,0 +1,142 @@
+package phantomjs
+
+import (
+	"bytes"
+	"context"
+	"html/template"
+	"time"
+)
+
+// LoadPollInterval is the interval between checks while waiting for a page's
+// resources to finish loading or for an element to appear.
+const LoadPollInterval = 50 * time.Millisecond
+
+// DefaultLoadTimeout is the maximum time GeneratePDF() waits for a page's
+// resources to finish loading when ctx has no deadline.
+const DefaultLoadTimeout = 30 * time.Second
+
+// PDFOptions represents options used by GeneratePDF().
+type PDFOptions struct {
+	// URL the generated document is loaded from. Relative references to
+	// stylesheets, images & fonts are resolved against this URL. To reference
+	// local assets use a "file://" URL ending in a slash.
+	BaseURL string
+
+	// Size, margins, header & footer of the generated document.
+	PaperSize PaperSize
+}
+
+// GeneratePDF executes tmpl with data and returns the result rendered as a PDF
+// using the default process.
+func GeneratePDF(ctx context.Context, tmpl *template.Template, data interface{}, opt PDFOptions) ([]byte, error) {
+	return DefaultProcess.GeneratePDF(ctx, tmpl, data, opt)
+}
+
+// GeneratePDF executes tmpl with data and returns the result rendered as a PDF.
+//
+// The document is rendered once every resource it requested, such as
+// stylesheets, images and web fonts, has finished loading. If ctx has no
+// deadline then loading is limited to DefaultLoadTimeout.
+// Pages are reused from a shared pool so GeneratePDF is safe to call from
+// multiple goroutines. Calls block while every pooled page is in use.
+func (p *Process) GeneratePDF(ctx context.Context, tmpl *template.Template, data interface{}, opt PDFOptions) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return nil, err
+	}
+
+	pool := p.pagePool()
+	page, err := pool.Get(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := page.generatePDF(ctx, buf.String(), opt)
+	if err != nil {
+		// Page state is unknown after a failure so do not reuse it.
+		pool.Discard(page)
+		return nil, err
+	}
+	pool.Put(page)
+	return b, nil
+}
+
+// generatePDF loads content into the page and renders it as a PDF.
+// The page is locked until rendering completes.
+func (p *WebPage) generatePDF(ctx context.Context, content string, opt PDFOptions) (b []byte, err error) {
+	err = p.Do(func(page *WebPage) error {
+		if err := page.SetPaperSize(opt.PaperSize); err != nil {
+			return err
+		}
+
+		if opt.BaseURL != "" {
+			if err := page.SetContentAndURL(content, opt.BaseURL); err != nil {
+				return err
+			}
+		} else if err := page.SetContent(content); err != nil {
+			return err
+		}
+
+		if err := page.waitForLoad(ctx); err != nil {
+			return err
+		}
+		b, err = page.RenderBytes("pdf", 100)
+		return err
+	})
+	return b, err
+}
+
+// waitForLoad blocks until the document has loaded and no resource requests
+// are pending, or until ctx is done. PhantomJS has no font loading API so web
+// fonts are tracked as resource requests by the shim.
+func (p *WebPage) waitForLoad(ctx context.Context) error {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, DefaultLoadTimeout)
+		defer cancel()
+	}
+
+	ticker := time.NewTicker(LoadPollInterval)
+	defer ticker.Stop()
+
+	for {
+		var loaded bool
+		if err := p.evaluate(&loaded, `function() {
+			if (document.readyState !== 'complete') {
+				return false;
+			}
+			for (var i = 0; i < document.images.length; i++) {
+				if (!document.images[i].complete) {
+					return false;
+				}
+			}
+			return true;
+		}`); err != nil {
+			return err
+		} else if loaded {
+			if n, err := p.pendingResources(); err != nil {
+				return err
+			} else if n == 0 {
+				return nil
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// pendingResources returns the number of unfinished resource requests made by
+// the page.
+func (p *WebPage) pendingResources() (int, error) {
+	var resp struct {
+		Value int `json:"value"`
+	}
+	if err := p.doJSON("POST", "/webpage/PendingResources", map[string]interface{}{"ref": p.ref.id}, &resp); err != nil {
+		return 0, err
+	}
+	return resp.Value, nil
+}
@@ -0,0 +1,105 @@
+package phantomjs_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/phantomjs"
+)
+
+// Ensure a template can be rendered as a PDF.
+func TestProcess_GeneratePDF(t *testing.T) {
+	// Mock external HTTP server for assets.
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/assets/style.css":
+			w.Header().Set("Content-Type", "text/css")
+			w.Write([]byte(`body { color: red }`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	p := MustOpenNewProcess()
+	defer p.MustClose()
+
+	tmpl := template.Must(template.New("invoice").Parse(`<html><head><link rel="stylesheet" href="style.css"></head><body>Invoice #{{.ID}}</body></html>`))
+	opt := phantomjs.PDFOptions{
+		BaseURL:   srv.URL + "/assets/",
+		PaperSize: phantomjs.PaperSize{Format: "A4"},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// Generate several documents concurrently.
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			buf, err := p.GeneratePDF(ctx, tmpl, map[string]int{"ID": i}, opt)
+			if err != nil {
+				errs <- err
+			} else if !bytes.HasPrefix(buf, []byte("%PDF")) {
+				errs <- errUnexpectedPDF
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Fatal(err)
+	}
+}
+
+var errUnexpectedPDF = errors.New("unexpected pdf header")
+
+// Ensure a PDF is not rendered until slow resources, such as web fonts, load.
+func TestProcess_GeneratePDF_SlowFont(t *testing.T) {
+	var mu sync.Mutex
+	var served time.Time
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/assets/font.woff" {
+			http.NotFound(w, r)
+			return
+		}
+		time.Sleep(500 * time.Millisecond)
+		mu.Lock()
+		served = time.Now()
+		mu.Unlock()
+		w.Header().Set("Content-Type", "font/woff")
+		w.Write([]byte("wOFF"))
+	}))
+	defer srv.Close()
+
+	p := MustOpenNewProcess()
+	defer p.MustClose()
+
+	tmpl := template.Must(template.New("doc").Parse(`<html><head><style>
+		@font-face { font-family: Slow; src: url(font.woff); }
+		body { font-family: Slow; }
+	</style></head><body>Text</body></html>`))
+	buf, err := p.GeneratePDF(context.Background(), tmpl, nil, phantomjs.PDFOptions{BaseURL: srv.URL + "/assets/"})
+	if err != nil {
+		t.Fatal(err)
+	} else if !bytes.HasPrefix(buf, []byte("%PDF")) {
+		t.Fatal(errUnexpectedPDF)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if served.IsZero() {
+		t.Fatal("expected font to be requested before rendering")
+	}
+}
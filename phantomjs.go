@@ -2,6 +2,7 @@ package phantomjs
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -11,12 +12,23 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strings"
+	"sync"
 	"time"
 )
 
 var (
 	// ErrInjectionFailed is returned by InjectJS when injection fails.
 	ErrInjectionFailed = errors.New("injection failed")
+
+	// ErrElementNotFound is returned when a selector does not match any element.
+	ErrElementNotFound = errors.New("element not found")
+
+	// ErrElementZeroSize is returned when a matched element has no width or height.
+	ErrElementZeroSize = errors.New("element has zero size")
+
+	// ErrDocumentZeroSize is returned when the document has no width or height.
+	ErrDocumentZeroSize = errors.New("document has zero size")
 )
 
 // Keyboard modifiers.
@@ -48,9 +60,29 @@ type Process struct {
 	// HTTP port used to communicate with phantomjs.
 	Port int
 
+	// If set, overrides the API URL built from Port. Used to point the
+	// process at another implementation of the API, such as a fake.
+	BaseURL string
+
 	// Output from the process.
 	Stdout io.Writer
 	Stderr io.Writer
+
+	// If set, the proxy is started with the process and all page traffic
+	// is routed through it.
+	Intercept *InterceptProxy
+
+	mu    sync.Mutex
+	pages *PagePool              // shared pool used by GeneratePDF()
+	relay *InterceptProxy        // throttling relay used by EmulateNetwork()
+	proxy bool                   // true if a proxy was set with SetProxy()
+	locks map[string]*sync.Mutex // page locks, by ref id
+
+	proxyMu sync.Mutex // serializes proxy changes, held across API calls
+
+	recMu    sync.Mutex   // protects recorder, as it is read by every API call
+	recorder *Recorder    // records API calls, if attached
+	client   *http.Client // overrides http.DefaultClient, used by Replay()
 }
 
 // NewProcess returns a new instance of Process.
@@ -101,6 +133,18 @@ func (p *Process) Open() error {
 
 		args := append([]string{scriptPath, fmt.Sprint(p.Port)}, p.Options...)
 
+		// Route traffic through the intercepting proxy, if set.
+		if p.Intercept != nil {
+			if err := p.Intercept.Open(); err != nil {
+				return err
+			}
+			flags := []string{"--proxy=" + p.Intercept.Addr(), "--proxy-type=http"}
+			if p.Intercept.MITM {
+				flags = append(flags, "--ignore-ssl-errors=true")
+			}
+			args = append(flags, args...)
+		}
+
 		// Start external process.
 		cmd := exec.Command(p.BinPath, args...)
 		// cmd.Env = []string{fmt.Sprintf("PORT=%d", p.Port)}
@@ -135,6 +179,27 @@ func (p *Process) Close() (err error) {
 		p.cmd.Wait()
 	}
 
+	// Stop intercepting proxy.
+	if p.Intercept != nil {
+		if e := p.Intercept.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+
+	// Pages in the shared pool belong to the killed process.
+	p.mu.Lock()
+	p.pages = nil
+	p.locks = nil
+
+	// Stop throttling relay.
+	if p.relay != nil {
+		if e := p.relay.Close(); e != nil && err == nil {
+			err = e
+		}
+		p.relay = nil
+	}
+	p.mu.Unlock()
+
 	// Remove shim file.
 	if p.path != "" {
 		if e := os.RemoveAll(p.path); e != nil && err == nil {
@@ -147,6 +212,9 @@ func (p *Process) Close() (err error) {
 
 // URL returns the process' API URL.
 func (p *Process) URL() string {
+	if p.BaseURL != "" {
+		return strings.TrimSuffix(p.BaseURL, "/")
+	}
 	return fmt.Sprintf("http://localhost:%d", p.Port)
 }
 
@@ -197,16 +265,110 @@ func (p *Process) CreateWebPage() (*WebPage, error) {
 	return &WebPage{ref: newRef(p, resp.Ref.ID)}, nil
 }
 
+// Cookies returns all cookies in the process' cookie jar.
+func (p *Process) Cookies() ([]*http.Cookie, error) {
+	var resp struct {
+		Value []cookieJSON `json:"value"`
+	}
+	if err := p.doJSON("POST", "/phantom/Cookies", nil, &resp); err != nil {
+		return nil, err
+	}
+
+	a := make([]*http.Cookie, len(resp.Value))
+	for i := range resp.Value {
+		a[i] = decodeCookieJSON(resp.Value[i])
+	}
+	return a, nil
+}
+
+// AddCookie adds a cookie to the process' cookie jar.
+// Returns true if the cookie was successfully added.
+func (p *Process) AddCookie(cookie *http.Cookie) (bool, error) {
+	var resp struct {
+		ReturnValue bool `json:"returnValue"`
+	}
+	if err := p.doJSON("POST", "/phantom/AddCookie", map[string]interface{}{"cookie": encodeCookieJSON(cookie)}, &resp); err != nil {
+		return false, err
+	}
+	return resp.ReturnValue, nil
+}
+
+// DeleteCookie removes a cookie with a matching name from the process' cookie jar.
+// Returns true if the cookie was successfully deleted.
+func (p *Process) DeleteCookie(name string) (bool, error) {
+	var resp struct {
+		ReturnValue bool `json:"returnValue"`
+	}
+	if err := p.doJSON("POST", "/phantom/DeleteCookie", map[string]interface{}{"name": name}, &resp); err != nil {
+		return false, err
+	}
+	return resp.ReturnValue, nil
+}
+
+// ClearCookies deletes all cookies in the process' cookie jar.
+func (p *Process) ClearCookies() error {
+	return p.doJSON("POST", "/phantom/ClearCookies", nil, nil)
+}
+
+// CookiesEnabled returns true if cookies are enabled for the process.
+func (p *Process) CookiesEnabled() (bool, error) {
+	var resp struct {
+		Value bool `json:"value"`
+	}
+	if err := p.doJSON("POST", "/phantom/CookiesEnabled", nil, &resp); err != nil {
+		return false, err
+	}
+	return resp.Value, nil
+}
+
+// SetCookiesEnabled sets whether cookies are enabled for the process.
+func (p *Process) SetCookiesEnabled(v bool) error {
+	return p.doJSON("POST", "/phantom/SetCookiesEnabled", map[string]interface{}{"value": v}, nil)
+}
+
+// pagePool returns the shared page pool, creating it if necessary.
+func (p *Process) pagePool() *PagePool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.pages == nil {
+		p.pages = NewPagePool(p, DefaultPagePoolSize)
+	}
+	return p.pages
+}
+
+// pageLock returns the lock used to serialize calls to a page.
+func (p *Process) pageLock(id string) *sync.Mutex {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.locks == nil {
+		p.locks = make(map[string]*sync.Mutex)
+	}
+	mu := p.locks[id]
+	if mu == nil {
+		mu = &sync.Mutex{}
+		p.locks[id] = mu
+	}
+	return mu
+}
+
+// deletePageLock removes the lock for a closed page.
+func (p *Process) deletePageLock(id string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.locks, id)
+}
+
 // doJSON sends an HTTP request to url and encodes and decodes the req/resp as JSON.
 func (p *Process) doJSON(method, path string, req, resp interface{}) error {
 	// Encode request.
 	var r io.Reader
+	var reqBody []byte
 	if req != nil {
 		buf, err := json.Marshal(req)
 		if err != nil {
 			return err
 		}
-		r = bytes.NewReader(buf)
+		r, reqBody = bytes.NewReader(buf), buf
 	}
 
 	// Create request.
@@ -216,7 +378,11 @@ func (p *Process) doJSON(method, path string, req, resp interface{}) error {
 	}
 
 	// Send request.
-	httpResponse, err := http.DefaultClient.Do(httpRequest)
+	client := http.DefaultClient
+	if p.client != nil {
+		client = p.client
+	}
+	httpResponse, err := client.Do(httpRequest)
 	if err != nil {
 		return err
 	}
@@ -228,6 +394,11 @@ func (p *Process) doJSON(method, path string, req, resp interface{}) error {
 		return err
 	}
 
+	// Write exchange to the recorder, if attached.
+	if rec := p.currentRecorder(); rec != nil {
+		rec.record(method, path, reqBody, httpResponse.StatusCode, body)
+	}
+
 	// Check response code.
 	if httpResponse.StatusCode == http.StatusNotFound {
 		return fmt.Errorf("not found: %s", path)
@@ -265,20 +436,82 @@ func CreateWebPage() (*WebPage, error) {
 }
 
 // WebPage represents an object returned from "webpage.create()".
+//
+// A WebPage is safe for concurrent use. Each call is serialized with other
+// calls to the same page, including calls through other WebPage values which
+// reference the same page. Use Do() to run a sequence of calls which depend
+// on shared page state, such as the clip rect or current frame, atomically.
 type WebPage struct {
 	ref *Ref
+
+	// True if the page's lock is held by the caller, such as within Do().
+	held bool
+}
+
+// Do calls fn while holding the page's lock so no other goroutine can use the
+// page until fn returns. The page passed to fn must only be used within fn.
+//
+// The lock is not reentrant: calling methods on p, or on any other WebPage for
+// the same page, from within fn deadlocks. Use the page passed to fn instead,
+// including for nested calls to Do() and InFrame().
+func (p *WebPage) Do(fn func(*WebPage) error) error {
+	if p.held {
+		return fn(p)
+	}
+
+	mu := p.ref.process.pageLock(p.ref.id)
+	mu.Lock()
+	defer mu.Unlock()
+	return fn(&WebPage{ref: p.ref, held: true})
+}
+
+// InFrame switches to the child frame with the given name, calls fn, and then
+// switches back to the parent frame. The page is locked for the duration so,
+// as with Do(), fn must only use the page passed to it.
+func (p *WebPage) InFrame(name string, fn func(*WebPage) error) error {
+	return p.Do(func(page *WebPage) error {
+		if err := page.SwitchToFrameName(name); err != nil {
+			return err
+		}
+		err := fn(page)
+		if e := page.SwitchToParentFrame(); e != nil && err == nil {
+			err = e
+		}
+		return err
+	})
+}
+
+// doJSON sends a request to the page's process while holding the page's lock.
+func (p *WebPage) doJSON(method, path string, req, resp interface{}) error {
+	return p.Do(func(page *WebPage) error {
+		return page.ref.process.doJSON(method, path, req, resp)
+	})
 }
 
-// Open opens a URL.
+// Open opens a URL. Stylesheets and images are not loaded; use OpenAll to
+// load every resource, such as when rendering the page.
 func (p *WebPage) Open(url string) error {
-	req := map[string]interface{}{
+	return p.open(map[string]interface{}{
 		"ref": p.ref.id,
 		"url": url,
-	}
+	})
+}
+
+// OpenAll opens a URL and loads all of its resources, including stylesheets
+// and images.
+func (p *WebPage) OpenAll(url string) error {
+	return p.open(map[string]interface{}{
+		"ref": p.ref.id,
+		"url": url,
+		"all": true,
+	})
+}
+
+func (p *WebPage) open(req map[string]interface{}) error {
 	var resp struct {
 		Status string `json:"status"`
 	}
-	if err := p.ref.process.doJSON("POST", "/webpage/Open", req, &resp); err != nil {
+	if err := p.doJSON("POST", "/webpage/Open", req, &resp); err != nil {
 		return err
 	}
 
@@ -293,7 +526,7 @@ func (p *WebPage) CanGoBack() (bool, error) {
 	var resp struct {
 		Value bool `json:"value"`
 	}
-	if err := p.ref.process.doJSON("POST", "/webpage/CanGoBack", map[string]interface{}{"ref": p.ref.id}, &resp); err != nil {
+	if err := p.doJSON("POST", "/webpage/CanGoBack", map[string]interface{}{"ref": p.ref.id}, &resp); err != nil {
 		return false, err
 	}
 	return resp.Value, nil
@@ -304,7 +537,7 @@ func (p *WebPage) CanGoForward() (bool, error) {
 	var resp struct {
 		Value bool `json:"value"`
 	}
-	if err := p.ref.process.doJSON("POST", "/webpage/CanGoForward", map[string]interface{}{"ref": p.ref.id}, &resp); err != nil {
+	if err := p.doJSON("POST", "/webpage/CanGoForward", map[string]interface{}{"ref": p.ref.id}, &resp); err != nil {
 		return false, err
 	}
 	return resp.Value, nil
@@ -316,7 +549,7 @@ func (p *WebPage) ClipRect() (Rect, error) {
 	var resp struct {
 		Value rectJSON `json:"value"`
 	}
-	if err := p.ref.process.doJSON("POST", "/webpage/ClipRect", map[string]interface{}{"ref": p.ref.id}, &resp); err != nil {
+	if err := p.doJSON("POST", "/webpage/ClipRect", map[string]interface{}{"ref": p.ref.id}, &resp); err != nil {
 		return Rect{}, err
 	}
 	return Rect{
@@ -339,7 +572,7 @@ func (p *WebPage) SetClipRect(rect Rect) error {
 			Height: rect.Height,
 		},
 	}
-	return p.ref.process.doJSON("POST", "/webpage/SetClipRect", req, nil)
+	return p.doJSON("POST", "/webpage/SetClipRect", req, nil)
 }
 
 // Content returns content of the webpage enclosed in an HTML/XML element.
@@ -347,7 +580,7 @@ func (p *WebPage) Content() (string, error) {
 	var resp struct {
 		Value string `json:"value"`
 	}
-	if err := p.ref.process.doJSON("POST", "/webpage/Content", map[string]interface{}{"ref": p.ref.id}, &resp); err != nil {
+	if err := p.doJSON("POST", "/webpage/Content", map[string]interface{}{"ref": p.ref.id}, &resp); err != nil {
 		return "", err
 	}
 	return resp.Value, nil
@@ -355,7 +588,7 @@ func (p *WebPage) Content() (string, error) {
 
 // SetContent sets the content of the webpage.
 func (p *WebPage) SetContent(content string) error {
-	return p.ref.process.doJSON("POST", "/webpage/SetContent", map[string]interface{}{"ref": p.ref.id, "content": content}, nil)
+	return p.doJSON("POST", "/webpage/SetContent", map[string]interface{}{"ref": p.ref.id, "content": content}, nil)
 }
 
 // Cookies returns a list of cookies visible to the current URL.
@@ -363,7 +596,7 @@ func (p *WebPage) Cookies() ([]*http.Cookie, error) {
 	var resp struct {
 		Value []cookieJSON `json:"value"`
 	}
-	if err := p.ref.process.doJSON("POST", "/webpage/Cookies", map[string]interface{}{"ref": p.ref.id}, &resp); err != nil {
+	if err := p.doJSON("POST", "/webpage/Cookies", map[string]interface{}{"ref": p.ref.id}, &resp); err != nil {
 		return nil, err
 	}
 
@@ -381,7 +614,7 @@ func (p *WebPage) SetCookies(cookies []*http.Cookie) error {
 		a[i] = encodeCookieJSON(cookies[i])
 	}
 	req := map[string]interface{}{"ref": p.ref.id, "cookies": a}
-	return p.ref.process.doJSON("POST", "/webpage/SetCookies", req, nil)
+	return p.doJSON("POST", "/webpage/SetCookies", req, nil)
 }
 
 // CustomHeaders returns a list of additional headers sent with the web page.
@@ -389,7 +622,7 @@ func (p *WebPage) CustomHeaders() (http.Header, error) {
 	var resp struct {
 		Value map[string]string `json:"value"`
 	}
-	if err := p.ref.process.doJSON("POST", "/webpage/CustomHeaders", map[string]interface{}{"ref": p.ref.id}, &resp); err != nil {
+	if err := p.doJSON("POST", "/webpage/CustomHeaders", map[string]interface{}{"ref": p.ref.id}, &resp); err != nil {
 		return nil, err
 	}
 
@@ -411,7 +644,7 @@ func (p *WebPage) SetCustomHeaders(header http.Header) error {
 		m[key] = header.Get(key)
 	}
 	req := map[string]interface{}{"ref": p.ref.id, "headers": m}
-	return p.ref.process.doJSON("POST", "/webpage/SetCustomHeaders", req, nil)
+	return p.doJSON("POST", "/webpage/SetCustomHeaders", req, nil)
 }
 
 // FocusedFrameName returns the name of the currently focused frame.
@@ -419,7 +652,7 @@ func (p *WebPage) FocusedFrameName() (string, error) {
 	var resp struct {
 		Value string `json:"value"`
 	}
-	if err := p.ref.process.doJSON("POST", "/webpage/FocusedFrameName", map[string]interface{}{"ref": p.ref.id}, &resp); err != nil {
+	if err := p.doJSON("POST", "/webpage/FocusedFrameName", map[string]interface{}{"ref": p.ref.id}, &resp); err != nil {
 		return "", err
 	}
 	return resp.Value, nil
@@ -430,7 +663,7 @@ func (p *WebPage) FrameContent() (string, error) {
 	var resp struct {
 		Value string `json:"value"`
 	}
-	if err := p.ref.process.doJSON("POST", "/webpage/FrameContent", map[string]interface{}{"ref": p.ref.id}, &resp); err != nil {
+	if err := p.doJSON("POST", "/webpage/FrameContent", map[string]interface{}{"ref": p.ref.id}, &resp); err != nil {
 		return "", err
 	}
 	return resp.Value, nil
@@ -438,7 +671,7 @@ func (p *WebPage) FrameContent() (string, error) {
 
 // SetFrameContent sets the content of the current frame.
 func (p *WebPage) SetFrameContent(content string) error {
-	return p.ref.process.doJSON("POST", "/webpage/SetFrameContent", map[string]interface{}{"ref": p.ref.id, "content": content}, nil)
+	return p.doJSON("POST", "/webpage/SetFrameContent", map[string]interface{}{"ref": p.ref.id, "content": content}, nil)
 }
 
 // FrameName returns the name of the current frame.
@@ -446,7 +679,7 @@ func (p *WebPage) FrameName() (string, error) {
 	var resp struct {
 		Value string `json:"value"`
 	}
-	if err := p.ref.process.doJSON("POST", "/webpage/FrameName", map[string]interface{}{"ref": p.ref.id}, &resp); err != nil {
+	if err := p.doJSON("POST", "/webpage/FrameName", map[string]interface{}{"ref": p.ref.id}, &resp); err != nil {
 		return "", err
 	}
 	return resp.Value, nil
@@ -457,7 +690,7 @@ func (p *WebPage) FramePlainText() (string, error) {
 	var resp struct {
 		Value string `json:"value"`
 	}
-	if err := p.ref.process.doJSON("POST", "/webpage/FramePlainText", map[string]interface{}{"ref": p.ref.id}, &resp); err != nil {
+	if err := p.doJSON("POST", "/webpage/FramePlainText", map[string]interface{}{"ref": p.ref.id}, &resp); err != nil {
 		return "", err
 	}
 	return resp.Value, nil
@@ -468,7 +701,7 @@ func (p *WebPage) FrameTitle() (string, error) {
 	var resp struct {
 		Value string `json:"value"`
 	}
-	if err := p.ref.process.doJSON("POST", "/webpage/FrameTitle", map[string]interface{}{"ref": p.ref.id}, &resp); err != nil {
+	if err := p.doJSON("POST", "/webpage/FrameTitle", map[string]interface{}{"ref": p.ref.id}, &resp); err != nil {
 		return "", err
 	}
 	return resp.Value, nil
@@ -479,7 +712,7 @@ func (p *WebPage) FrameURL() (string, error) {
 	var resp struct {
 		Value string `json:"value"`
 	}
-	if err := p.ref.process.doJSON("POST", "/webpage/FrameURL", map[string]interface{}{"ref": p.ref.id}, &resp); err != nil {
+	if err := p.doJSON("POST", "/webpage/FrameURL", map[string]interface{}{"ref": p.ref.id}, &resp); err != nil {
 		return "", err
 	}
 	return resp.Value, nil
@@ -490,7 +723,7 @@ func (p *WebPage) FrameCount() (int, error) {
 	var resp struct {
 		Value int `json:"value"`
 	}
-	if err := p.ref.process.doJSON("POST", "/webpage/FrameCount", map[string]interface{}{"ref": p.ref.id}, &resp); err != nil {
+	if err := p.doJSON("POST", "/webpage/FrameCount", map[string]interface{}{"ref": p.ref.id}, &resp); err != nil {
 		return 0, err
 	}
 	return resp.Value, nil
@@ -501,7 +734,7 @@ func (p *WebPage) FrameNames() ([]string, error) {
 	var resp struct {
 		Value []string `json:"value"`
 	}
-	if err := p.ref.process.doJSON("POST", "/webpage/FrameNames", map[string]interface{}{"ref": p.ref.id}, &resp); err != nil {
+	if err := p.doJSON("POST", "/webpage/FrameNames", map[string]interface{}{"ref": p.ref.id}, &resp); err != nil {
 		return nil, err
 	}
 	return resp.Value, nil
@@ -513,7 +746,7 @@ func (p *WebPage) LibraryPath() (string, error) {
 	var resp struct {
 		Value string `json:"value"`
 	}
-	if err := p.ref.process.doJSON("POST", "/webpage/LibraryPath", map[string]interface{}{"ref": p.ref.id}, &resp); err != nil {
+	if err := p.doJSON("POST", "/webpage/LibraryPath", map[string]interface{}{"ref": p.ref.id}, &resp); err != nil {
 		return "", err
 	}
 	return resp.Value, nil
@@ -521,7 +754,7 @@ func (p *WebPage) LibraryPath() (string, error) {
 
 // SetLibraryPath sets the library path used by InjectJS().
 func (p *WebPage) SetLibraryPath(path string) error {
-	return p.ref.process.doJSON("POST", "/webpage/SetLibraryPath", map[string]interface{}{"ref": p.ref.id, "path": path}, nil)
+	return p.doJSON("POST", "/webpage/SetLibraryPath", map[string]interface{}{"ref": p.ref.id, "path": path}, nil)
 }
 
 // NavigationLocked returns true if the navigation away from the page is disabled.
@@ -529,7 +762,7 @@ func (p *WebPage) NavigationLocked() (bool, error) {
 	var resp struct {
 		Value bool `json:"value"`
 	}
-	if err := p.ref.process.doJSON("POST", "/webpage/NavigationLocked", map[string]interface{}{"ref": p.ref.id}, &resp); err != nil {
+	if err := p.doJSON("POST", "/webpage/NavigationLocked", map[string]interface{}{"ref": p.ref.id}, &resp); err != nil {
 		return false, err
 	}
 	return resp.Value, nil
@@ -537,7 +770,7 @@ func (p *WebPage) NavigationLocked() (bool, error) {
 
 // SetNavigationLocked sets whether navigation away from the page should be disabled.
 func (p *WebPage) SetNavigationLocked(value bool) error {
-	return p.ref.process.doJSON("POST", "/webpage/SetNavigationLocked", map[string]interface{}{"ref": p.ref.id, "value": value}, nil)
+	return p.doJSON("POST", "/webpage/SetNavigationLocked", map[string]interface{}{"ref": p.ref.id, "value": value}, nil)
 }
 
 // OfflineStoragePath returns the path used by offline storage.
@@ -545,7 +778,7 @@ func (p *WebPage) OfflineStoragePath() (string, error) {
 	var resp struct {
 		Value string `json:"value"`
 	}
-	if err := p.ref.process.doJSON("POST", "/webpage/OfflineStoragePath", map[string]interface{}{"ref": p.ref.id}, &resp); err != nil {
+	if err := p.doJSON("POST", "/webpage/OfflineStoragePath", map[string]interface{}{"ref": p.ref.id}, &resp); err != nil {
 		return "", err
 	}
 	return resp.Value, nil
@@ -556,7 +789,7 @@ func (p *WebPage) OfflineStorageQuota() (int, error) {
 	var resp struct {
 		Value int `json:"value"`
 	}
-	if err := p.ref.process.doJSON("POST", "/webpage/OfflineStorageQuota", map[string]interface{}{"ref": p.ref.id}, &resp); err != nil {
+	if err := p.doJSON("POST", "/webpage/OfflineStorageQuota", map[string]interface{}{"ref": p.ref.id}, &resp); err != nil {
 		return 0, err
 	}
 	return resp.Value, nil
@@ -567,7 +800,7 @@ func (p *WebPage) OwnsPages() (bool, error) {
 	var resp struct {
 		Value bool `json:"value"`
 	}
-	if err := p.ref.process.doJSON("POST", "/webpage/OwnsPages", map[string]interface{}{"ref": p.ref.id}, &resp); err != nil {
+	if err := p.doJSON("POST", "/webpage/OwnsPages", map[string]interface{}{"ref": p.ref.id}, &resp); err != nil {
 		return false, err
 	}
 	return resp.Value, nil
@@ -575,7 +808,7 @@ func (p *WebPage) OwnsPages() (bool, error) {
 
 // SetOwnsPages sets whether this page owns pages opened in other windows.
 func (p *WebPage) SetOwnsPages(v bool) error {
-	return p.ref.process.doJSON("POST", "/webpage/SetOwnsPages", map[string]interface{}{"ref": p.ref.id, "value": v}, nil)
+	return p.doJSON("POST", "/webpage/SetOwnsPages", map[string]interface{}{"ref": p.ref.id, "value": v}, nil)
 }
 
 // PageWindowNames returns an list of owned window names.
@@ -583,7 +816,7 @@ func (p *WebPage) PageWindowNames() ([]string, error) {
 	var resp struct {
 		Value []string `json:"value"`
 	}
-	if err := p.ref.process.doJSON("POST", "/webpage/PageWindowNames", map[string]interface{}{"ref": p.ref.id}, &resp); err != nil {
+	if err := p.doJSON("POST", "/webpage/PageWindowNames", map[string]interface{}{"ref": p.ref.id}, &resp); err != nil {
 		return nil, err
 	}
 	return resp.Value, nil
@@ -594,7 +827,7 @@ func (p *WebPage) Pages() ([]*WebPage, error) {
 	var resp struct {
 		Refs []refJSON `json:"refs"`
 	}
-	if err := p.ref.process.doJSON("POST", "/webpage/Pages", map[string]interface{}{"ref": p.ref.id}, &resp); err != nil {
+	if err := p.doJSON("POST", "/webpage/Pages", map[string]interface{}{"ref": p.ref.id}, &resp); err != nil {
 		return nil, err
 	}
 
@@ -611,7 +844,7 @@ func (p *WebPage) PaperSize() (PaperSize, error) {
 	var resp struct {
 		Value paperSizeJSON `json:"value"`
 	}
-	if err := p.ref.process.doJSON("POST", "/webpage/PaperSize", map[string]interface{}{"ref": p.ref.id}, &resp); err != nil {
+	if err := p.doJSON("POST", "/webpage/PaperSize", map[string]interface{}{"ref": p.ref.id}, &resp); err != nil {
 		return PaperSize{}, err
 	}
 	return decodePaperSizeJSON(resp.Value), nil
@@ -620,7 +853,7 @@ func (p *WebPage) PaperSize() (PaperSize, error) {
 // SetPaperSize sets the size of the web page when rendered as a PDF.
 func (p *WebPage) SetPaperSize(size PaperSize) error {
 	req := map[string]interface{}{"ref": p.ref.id, "size": encodePaperSizeJSON(size)}
-	return p.ref.process.doJSON("POST", "/webpage/SetPaperSize", req, nil)
+	return p.doJSON("POST", "/webpage/SetPaperSize", req, nil)
 }
 
 // PlainText returns the plain text representation of the page.
@@ -628,7 +861,7 @@ func (p *WebPage) PlainText() (string, error) {
 	var resp struct {
 		Value string `json:"value"`
 	}
-	if err := p.ref.process.doJSON("POST", "/webpage/PlainText", map[string]interface{}{"ref": p.ref.id}, &resp); err != nil {
+	if err := p.doJSON("POST", "/webpage/PlainText", map[string]interface{}{"ref": p.ref.id}, &resp); err != nil {
 		return "", err
 	}
 	return resp.Value, nil
@@ -640,7 +873,7 @@ func (p *WebPage) ScrollPosition() (Position, error) {
 		Top  int `json:"top"`
 		Left int `json:"left"`
 	}
-	if err := p.ref.process.doJSON("POST", "/webpage/ScrollPosition", map[string]interface{}{"ref": p.ref.id}, &resp); err != nil {
+	if err := p.doJSON("POST", "/webpage/ScrollPosition", map[string]interface{}{"ref": p.ref.id}, &resp); err != nil {
 		return Position{}, err
 	}
 	return Position{Top: resp.Top, Left: resp.Left}, nil
@@ -648,7 +881,7 @@ func (p *WebPage) ScrollPosition() (Position, error) {
 
 // SetScrollPosition sets the current scroll position of the page.
 func (p *WebPage) SetScrollPosition(pos Position) error {
-	return p.ref.process.doJSON("POST", "/webpage/SetScrollPosition", map[string]interface{}{"ref": p.ref.id, "top": pos.Top, "left": pos.Left}, nil)
+	return p.doJSON("POST", "/webpage/SetScrollPosition", map[string]interface{}{"ref": p.ref.id, "top": pos.Top, "left": pos.Left}, nil)
 }
 
 // Settings returns the settings used on the web page.
@@ -656,7 +889,7 @@ func (p *WebPage) Settings() (WebPageSettings, error) {
 	var resp struct {
 		Settings webPageSettingsJSON `json:"settings"`
 	}
-	if err := p.ref.process.doJSON("POST", "/webpage/Settings", map[string]interface{}{"ref": p.ref.id}, &resp); err != nil {
+	if err := p.doJSON("POST", "/webpage/Settings", map[string]interface{}{"ref": p.ref.id}, &resp); err != nil {
 		return WebPageSettings{}, err
 	}
 	return WebPageSettings{
@@ -691,7 +924,7 @@ func (p *WebPage) SetSettings(settings WebPageSettings) error {
 			ResourceTimeout:               int(settings.ResourceTimeout / time.Millisecond),
 		},
 	}
-	return p.ref.process.doJSON("POST", "/webpage/SetSettings", req, nil)
+	return p.doJSON("POST", "/webpage/SetSettings", req, nil)
 }
 
 // Title returns the title of the web page.
@@ -699,7 +932,7 @@ func (p *WebPage) Title() (string, error) {
 	var resp struct {
 		Value string `json:"value"`
 	}
-	if err := p.ref.process.doJSON("POST", "/webpage/Title", map[string]interface{}{"ref": p.ref.id}, &resp); err != nil {
+	if err := p.doJSON("POST", "/webpage/Title", map[string]interface{}{"ref": p.ref.id}, &resp); err != nil {
 		return "", err
 	}
 	return resp.Value, nil
@@ -710,7 +943,7 @@ func (p *WebPage) URL() (string, error) {
 	var resp struct {
 		Value string `json:"value"`
 	}
-	if err := p.ref.process.doJSON("POST", "/webpage/URL", map[string]interface{}{"ref": p.ref.id}, &resp); err != nil {
+	if err := p.doJSON("POST", "/webpage/URL", map[string]interface{}{"ref": p.ref.id}, &resp); err != nil {
 		return "", err
 	}
 	return resp.Value, nil
@@ -722,7 +955,7 @@ func (p *WebPage) ViewportSize() (width, height int, err error) {
 		Width  int `json:"width"`
 		Height int `json:"height"`
 	}
-	if err := p.ref.process.doJSON("POST", "/webpage/ViewportSize", map[string]interface{}{"ref": p.ref.id}, &resp); err != nil {
+	if err := p.doJSON("POST", "/webpage/ViewportSize", map[string]interface{}{"ref": p.ref.id}, &resp); err != nil {
 		return 0, 0, err
 	}
 	return resp.Width, resp.Height, nil
@@ -730,7 +963,7 @@ func (p *WebPage) ViewportSize() (width, height int, err error) {
 
 // SetViewportSize sets the size of the viewport.
 func (p *WebPage) SetViewportSize(width, height int) error {
-	return p.ref.process.doJSON("POST", "/webpage/SetViewportSize", map[string]interface{}{"ref": p.ref.id, "width": width, "height": height}, nil)
+	return p.doJSON("POST", "/webpage/SetViewportSize", map[string]interface{}{"ref": p.ref.id, "width": width, "height": height}, nil)
 }
 
 // WindowName returns the window name of the web page.
@@ -738,7 +971,7 @@ func (p *WebPage) WindowName() (string, error) {
 	var resp struct {
 		Value string `json:"value"`
 	}
-	if err := p.ref.process.doJSON("POST", "/webpage/WindowName", map[string]interface{}{"ref": p.ref.id}, &resp); err != nil {
+	if err := p.doJSON("POST", "/webpage/WindowName", map[string]interface{}{"ref": p.ref.id}, &resp); err != nil {
 		return "", err
 	}
 	return resp.Value, nil
@@ -749,7 +982,7 @@ func (p *WebPage) ZoomFactor() (float64, error) {
 	var resp struct {
 		Value float64 `json:"value"`
 	}
-	if err := p.ref.process.doJSON("POST", "/webpage/ZoomFactor", map[string]interface{}{"ref": p.ref.id}, &resp); err != nil {
+	if err := p.doJSON("POST", "/webpage/ZoomFactor", map[string]interface{}{"ref": p.ref.id}, &resp); err != nil {
 		return 0, err
 	}
 	return resp.Value, nil
@@ -757,7 +990,7 @@ func (p *WebPage) ZoomFactor() (float64, error) {
 
 // SetZoomFactor sets the zoom factor when rendering the page.
 func (p *WebPage) SetZoomFactor(factor float64) error {
-	return p.ref.process.doJSON("POST", "/webpage/SetZoomFactor", map[string]interface{}{"ref": p.ref.id, "value": factor}, nil)
+	return p.doJSON("POST", "/webpage/SetZoomFactor", map[string]interface{}{"ref": p.ref.id, "value": factor}, nil)
 }
 
 // AddCookie adds a cookie to the page.
@@ -767,7 +1000,7 @@ func (p *WebPage) AddCookie(cookie *http.Cookie) (bool, error) {
 		ReturnValue bool `json:"returnValue"`
 	}
 	req := map[string]interface{}{"ref": p.ref.id, "cookie": encodeCookieJSON(cookie)}
-	if err := p.ref.process.doJSON("POST", "/webpage/AddCookie", req, &resp); err != nil {
+	if err := p.doJSON("POST", "/webpage/AddCookie", req, &resp); err != nil {
 		return false, err
 	}
 	return resp.ReturnValue, nil
@@ -775,12 +1008,16 @@ func (p *WebPage) AddCookie(cookie *http.Cookie) (bool, error) {
 
 // ClearCookies deletes all cookies visible to the current URL.
 func (p *WebPage) ClearCookies() error {
-	return p.ref.process.doJSON("POST", "/webpage/ClearCookies", map[string]interface{}{"ref": p.ref.id}, nil)
+	return p.doJSON("POST", "/webpage/ClearCookies", map[string]interface{}{"ref": p.ref.id}, nil)
 }
 
 // Close releases the web page and its resources.
 func (p *WebPage) Close() error {
-	return p.ref.process.doJSON("POST", "/webpage/Close", map[string]interface{}{"ref": p.ref.id}, nil)
+	if err := p.doJSON("POST", "/webpage/Close", map[string]interface{}{"ref": p.ref.id}, nil); err != nil {
+		return err
+	}
+	p.ref.process.deletePageLock(p.ref.id)
+	return nil
 }
 
 // DeleteCookie removes a cookie with a matching name.
@@ -790,7 +1027,7 @@ func (p *WebPage) DeleteCookie(name string) (bool, error) {
 		ReturnValue bool `json:"returnValue"`
 	}
 	req := map[string]interface{}{"ref": p.ref.id, "name": name}
-	if err := p.ref.process.doJSON("POST", "/webpage/DeleteCookie", req, &resp); err != nil {
+	if err := p.doJSON("POST", "/webpage/DeleteCookie", req, &resp); err != nil {
 		return false, err
 	}
 	return resp.ReturnValue, nil
@@ -799,7 +1036,7 @@ func (p *WebPage) DeleteCookie(name string) (bool, error) {
 // EvaluateAsync executes a JavaScript function and returns immediately.
 // Execution is delayed by delay. No value is returned.
 func (p *WebPage) EvaluateAsync(script string, delay time.Duration) error {
-	return p.ref.process.doJSON("POST", "/webpage/EvaluateAsync", map[string]interface{}{"ref": p.ref.id, "script": script, "delay": int(delay / time.Millisecond)}, nil)
+	return p.doJSON("POST", "/webpage/EvaluateAsync", map[string]interface{}{"ref": p.ref.id, "script": script, "delay": int(delay / time.Millisecond)}, nil)
 }
 
 // EvaluateJavaScript executes a JavaScript function.
@@ -808,7 +1045,7 @@ func (p *WebPage) EvaluateJavaScript(script string) (interface{}, error) {
 	var resp struct {
 		ReturnValue interface{} `json:"returnValue"`
 	}
-	if err := p.ref.process.doJSON("POST", "/webpage/EvaluateJavaScript", map[string]interface{}{"ref": p.ref.id, "script": script}, &resp); err != nil {
+	if err := p.doJSON("POST", "/webpage/EvaluateJavaScript", map[string]interface{}{"ref": p.ref.id, "script": script}, &resp); err != nil {
 		return nil, err
 	}
 	return resp.ReturnValue, nil
@@ -820,19 +1057,67 @@ func (p *WebPage) Evaluate(script string) (interface{}, error) {
 	var resp struct {
 		ReturnValue interface{} `json:"returnValue"`
 	}
-	if err := p.ref.process.doJSON("POST", "/webpage/Evaluate", map[string]interface{}{"ref": p.ref.id, "script": script}, &resp); err != nil {
+	if err := p.doJSON("POST", "/webpage/Evaluate", map[string]interface{}{"ref": p.ref.id, "script": script}, &resp); err != nil {
 		return nil, err
 	}
 	return resp.ReturnValue, nil
 }
 
+// evaluate executes the JavaScript function fn in the context of the web page.
+// Each argument is encoded as a JSON literal and passed to fn in order. The
+// value returned by fn is decoded into v, if v is not nil.
+func (p *WebPage) evaluate(v interface{}, fn string, args ...interface{}) error {
+	a := make([]string, len(args))
+	for i, arg := range args {
+		buf, err := json.Marshal(arg)
+		if err != nil {
+			return err
+		}
+		a[i] = string(buf)
+	}
+	script := fmt.Sprintf("function() { return (%s)(%s); }", fn, strings.Join(a, ", "))
+
+	var resp struct {
+		ReturnValue json.RawMessage `json:"returnValue"`
+	}
+	if err := p.doJSON("POST", "/webpage/Evaluate", map[string]interface{}{"ref": p.ref.id, "script": script}, &resp); err != nil {
+		return err
+	}
+	if v == nil || len(resp.ReturnValue) == 0 {
+		return nil
+	}
+	return json.Unmarshal(resp.ReturnValue, v)
+}
+
+// WaitForSelector blocks until an element in the page matches selector or
+// until ctx is done. The page is polled every LoadPollInterval.
+func (p *WebPage) WaitForSelector(ctx context.Context, selector string) error {
+	ticker := time.NewTicker(LoadPollInterval)
+	defer ticker.Stop()
+
+	for {
+		var found bool
+		if err := p.evaluate(&found, `function(selector) { return document.querySelector(selector) !== null; }`, selector); err != nil {
+			return err
+		} else if found {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
 // Page returns an owned page by window name.
 // Returns nil if the page cannot be found.
 func (p *WebPage) Page(name string) (*WebPage, error) {
 	var resp struct {
 		Ref refJSON `json:"ref"`
 	}
-	if err := p.ref.process.doJSON("POST", "/webpage/Page", map[string]interface{}{"ref": p.ref.id, "name": name}, &resp); err != nil {
+	if err := p.doJSON("POST", "/webpage/Page", map[string]interface{}{"ref": p.ref.id, "name": name}, &resp); err != nil {
 		return nil, err
 	}
 	if resp.Ref.ID == "" {
@@ -843,24 +1128,24 @@ func (p *WebPage) Page(name string) (*WebPage, error) {
 
 // GoBack navigates back to the previous page.
 func (p *WebPage) GoBack() error {
-	return p.ref.process.doJSON("POST", "/webpage/GoBack", map[string]interface{}{"ref": p.ref.id}, nil)
+	return p.doJSON("POST", "/webpage/GoBack", map[string]interface{}{"ref": p.ref.id}, nil)
 }
 
 // GoForward navigates to the next page.
 func (p *WebPage) GoForward() error {
-	return p.ref.process.doJSON("POST", "/webpage/GoForward", map[string]interface{}{"ref": p.ref.id}, nil)
+	return p.doJSON("POST", "/webpage/GoForward", map[string]interface{}{"ref": p.ref.id}, nil)
 }
 
 // Go navigates to the page in history by relative offset.
 // A positive index moves forward, a negative index moves backwards.
 func (p *WebPage) Go(index int) error {
-	return p.ref.process.doJSON("POST", "/webpage/Go", map[string]interface{}{"ref": p.ref.id, "index": index}, nil)
+	return p.doJSON("POST", "/webpage/Go", map[string]interface{}{"ref": p.ref.id, "index": index}, nil)
 }
 
 // IncludeJS includes an external script from url.
 // Returns after the script has been loaded.
 func (p *WebPage) IncludeJS(url string) error {
-	return p.ref.process.doJSON("POST", "/webpage/IncludeJS", map[string]interface{}{"ref": p.ref.id, "url": url}, nil)
+	return p.doJSON("POST", "/webpage/IncludeJS", map[string]interface{}{"ref": p.ref.id, "url": url}, nil)
 }
 
 // InjectJS injects an external script from the local filesystem.
@@ -871,7 +1156,7 @@ func (p *WebPage) InjectJS(filename string) error {
 	var resp struct {
 		ReturnValue bool `json:"returnValue"`
 	}
-	if err := p.ref.process.doJSON("POST", "/webpage/InjectJS", map[string]interface{}{"ref": p.ref.id, "filename": filename}, &resp); err != nil {
+	if err := p.doJSON("POST", "/webpage/InjectJS", map[string]interface{}{"ref": p.ref.id, "filename": filename}, &resp); err != nil {
 		return err
 	}
 	if !resp.ReturnValue {
@@ -882,7 +1167,7 @@ func (p *WebPage) InjectJS(filename string) error {
 
 // Reload reloads the current web page.
 func (p *WebPage) Reload() error {
-	return p.ref.process.doJSON("POST", "/webpage/Reload", map[string]interface{}{"ref": p.ref.id}, nil)
+	return p.doJSON("POST", "/webpage/Reload", map[string]interface{}{"ref": p.ref.id}, nil)
 }
 
 // RenderBase64 renders the web page to a base64 encoded string.
@@ -890,7 +1175,7 @@ func (p *WebPage) RenderBase64(format string) (string, error) {
 	var resp struct {
 		ReturnValue string `json:"returnValue"`
 	}
-	if err := p.ref.process.doJSON("POST", "/webpage/RenderBase64", map[string]interface{}{"ref": p.ref.id, "format": format}, &resp); err != nil {
+	if err := p.doJSON("POST", "/webpage/RenderBase64", map[string]interface{}{"ref": p.ref.id, "format": format}, &resp); err != nil {
 		return "", err
 	}
 	return resp.ReturnValue, nil
@@ -900,7 +1185,7 @@ func (p *WebPage) RenderBase64(format string) (string, error) {
 // This supports the "PDF", "PNG", "JPEG", "BMP", "PPM", and "GIF" formats.
 func (p *WebPage) Render(filename, format string, quality int) error {
 	req := map[string]interface{}{"ref": p.ref.id, "filename": filename, "format": format, "quality": quality}
-	return p.ref.process.doJSON("POST", "/webpage/Render", req, nil)
+	return p.doJSON("POST", "/webpage/Render", req, nil)
 }
 
 // SendMouseEvent sends a mouse event as if it came from the user.
@@ -910,7 +1195,7 @@ func (p *WebPage) Render(filename, format string, quality int) error {
 // or "click". The mouseX and mouseY specify the position of the mouse on the
 // screen. The button argument specifies the mouse button clicked (e.g. "left").
 func (p *WebPage) SendMouseEvent(eventType string, mouseX, mouseY int, button string) error {
-	return p.ref.process.doJSON("POST", "/webpage/SendMouseEvent", map[string]interface{}{"ref": p.ref.id, "eventType": eventType, "mouseX": mouseX, "mouseY": mouseY, "button": button}, nil)
+	return p.doJSON("POST", "/webpage/SendMouseEvent", map[string]interface{}{"ref": p.ref.id, "eventType": eventType, "mouseX": mouseX, "mouseY": mouseY, "button": button}, nil)
 }
 
 // SendKeyboardEvent sends a keyboard event as if it came from the user.
@@ -923,47 +1208,47 @@ func (p *WebPage) SendMouseEvent(eventType string, mouseX, mouseY int, button st
 //
 // Keyboard modifiers can be joined together using the bitwise OR operator.
 func (p *WebPage) SendKeyboardEvent(eventType string, key string, modifier int) error {
-	return p.ref.process.doJSON("POST", "/webpage/SendKeyboardEvent", map[string]interface{}{"ref": p.ref.id, "eventType": eventType, "key": key, "modifier": modifier}, nil)
+	return p.doJSON("POST", "/webpage/SendKeyboardEvent", map[string]interface{}{"ref": p.ref.id, "eventType": eventType, "key": key, "modifier": modifier}, nil)
 }
 
 // SetContentAndURL sets the content and URL of the page.
 func (p *WebPage) SetContentAndURL(content, url string) error {
-	return p.ref.process.doJSON("POST", "/webpage/SetContentAndURL", map[string]interface{}{"ref": p.ref.id, "content": content, "url": url}, nil)
+	return p.doJSON("POST", "/webpage/SetContentAndURL", map[string]interface{}{"ref": p.ref.id, "content": content, "url": url}, nil)
 }
 
 // Stop stops the web page.
 func (p *WebPage) Stop() error {
-	return p.ref.process.doJSON("POST", "/webpage/Stop", map[string]interface{}{"ref": p.ref.id}, nil)
+	return p.doJSON("POST", "/webpage/Stop", map[string]interface{}{"ref": p.ref.id}, nil)
 }
 
 // SwitchToFocusedFrame changes the current frame to the frame that is in focus.
 func (p *WebPage) SwitchToFocusedFrame() error {
-	return p.ref.process.doJSON("POST", "/webpage/SwitchToFocusedFrame", map[string]interface{}{"ref": p.ref.id}, nil)
+	return p.doJSON("POST", "/webpage/SwitchToFocusedFrame", map[string]interface{}{"ref": p.ref.id}, nil)
 }
 
 // SwitchToFrameName changes the current frame to a frame with a given name.
 func (p *WebPage) SwitchToFrameName(name string) error {
-	return p.ref.process.doJSON("POST", "/webpage/SwitchToFrameName", map[string]interface{}{"ref": p.ref.id, "name": name}, nil)
+	return p.doJSON("POST", "/webpage/SwitchToFrameName", map[string]interface{}{"ref": p.ref.id, "name": name}, nil)
 }
 
 // SwitchToFramePosition changes the current frame to the frame at the given position.
 func (p *WebPage) SwitchToFramePosition(pos int) error {
-	return p.ref.process.doJSON("POST", "/webpage/SwitchToFramePosition", map[string]interface{}{"ref": p.ref.id, "position": pos}, nil)
+	return p.doJSON("POST", "/webpage/SwitchToFramePosition", map[string]interface{}{"ref": p.ref.id, "position": pos}, nil)
 }
 
 // SwitchToMainFrame switches the current frame to the main frame.
 func (p *WebPage) SwitchToMainFrame() error {
-	return p.ref.process.doJSON("POST", "/webpage/SwitchToMainFrame", map[string]interface{}{"ref": p.ref.id}, nil)
+	return p.doJSON("POST", "/webpage/SwitchToMainFrame", map[string]interface{}{"ref": p.ref.id}, nil)
 }
 
 // SwitchToParentFrame switches the current frame to the parent of the current frame.
 func (p *WebPage) SwitchToParentFrame() error {
-	return p.ref.process.doJSON("POST", "/webpage/SwitchToParentFrame", map[string]interface{}{"ref": p.ref.id}, nil)
+	return p.doJSON("POST", "/webpage/SwitchToParentFrame", map[string]interface{}{"ref": p.ref.id}, nil)
 }
 
 // UploadFile uploads a file to a form element specified by selector.
 func (p *WebPage) UploadFile(selector, filename string) error {
-	return p.ref.process.doJSON("POST", "/webpage/UploadFile", map[string]interface{}{"ref": p.ref.id, "selector": selector, "filename": filename}, nil)
+	return p.doJSON("POST", "/webpage/UploadFile", map[string]interface{}{"ref": p.ref.id, "selector": selector, "filename": filename}, nil)
 }
 
 // OpenWebPageSettings represents the settings object passed to WebPage.Open().
@@ -1011,8 +1296,8 @@ type rectJSON struct {
 // cookieJSON is a struct for encoding http.Cookie objects as JSON.
 type cookieJSON struct {
 	Domain   string `json:"domain"`
-	Expires  string `json:"expires"`
-	Expiry   int    `json:"expiry"`
+	Expires  string `json:"expires,omitempty"`
+	Expiry   int64  `json:"expiry,omitempty"`
 	HTTPOnly bool   `json:"httponly"`
 	Name     string `json:"name"`
 	Path     string `json:"path"`
@@ -1030,8 +1315,9 @@ func encodeCookieJSON(v *http.Cookie) cookieJSON {
 		Value:    v.Value,
 	}
 
-	if !v.Expires.IsZero() {
-		out.Expires = v.Expires.UTC().Format(http.TimeFormat)
+	if expires := cookieExpires(v); !expires.IsZero() {
+		out.Expires = expires.UTC().Format(http.TimeFormat)
+		out.Expiry = expires.Unix()
 	}
 	return out
 }
@@ -1053,9 +1339,25 @@ func decodeCookieJSON(v cookieJSON) *http.Cookie {
 		out.RawExpires = v.Expires
 	}
 
+	// Fall back to the numeric expiry if the date is missing or unparseable.
+	if out.Expires.IsZero() && v.Expiry != 0 {
+		out.Expires = time.Unix(v.Expiry, 0).UTC()
+	}
+
 	return out
 }
 
+// cookieExpires returns the absolute expiration time of a cookie.
+// MaxAge takes precedence over Expires. Returns the zero time for session cookies.
+func cookieExpires(v *http.Cookie) time.Time {
+	if v.MaxAge > 0 {
+		return time.Now().Add(time.Duration(v.MaxAge) * time.Second).Truncate(time.Second)
+	} else if v.MaxAge < 0 {
+		return time.Unix(1, 0)
+	}
+	return v.Expires
+}
+
 // PaperSize represents the size of a webpage when rendered as a PDF.
 //
 // Units can be specified in "mm", "cm", "in", or "px".
@@ -1063,33 +1365,49 @@ func decodeCookieJSON(v cookieJSON) *http.Cookie {
 type PaperSize struct {
 	// Dimensions of the paper.
 	// This can also be specified via Format.
-	Width  string
-	Height string
+	Width  string `json:"width,omitempty"`
+	Height string `json:"height,omitempty"`
 
 	// Supported formats: "A3", "A4", "A5", "Legal", "Letter", "Tabloid".
-	Format string
+	Format string `json:"format,omitempty"`
 
 	// Margins around the paper.
-	Margin *PaperSizeMargin
+	Margin *PaperSizeMargin `json:"margin,omitempty"`
 
 	// Supported orientations: "portrait", "landscape".
-	Orientation string
+	Orientation string `json:"orientation,omitempty"`
+
+	// Header and footer printed on every page.
+	Header *PaperSizeSection `json:"header,omitempty"`
+	Footer *PaperSizeSection `json:"footer,omitempty"`
 }
 
 // PaperSizeMargin represents the margins around the paper.
 type PaperSizeMargin struct {
-	Top    string
-	Bottom string
-	Left   string
-	Right  string
+	Top    string `json:"top,omitempty"`
+	Bottom string `json:"bottom,omitempty"`
+	Left   string `json:"left,omitempty"`
+	Right  string `json:"right,omitempty"`
+}
+
+// PaperSizeSection represents a header or footer printed on each page.
+//
+// Contents is an HTML template. The "{{.PageNum}}" and "{{.NumPages}}"
+// placeholders are replaced with the current page number and the total number
+// of pages when each page is printed.
+type PaperSizeSection struct {
+	Height   string `json:"height,omitempty"`
+	Contents string `json:"contents,omitempty"`
 }
 
 type paperSizeJSON struct {
-	Width       string               `json:"width,omitempty"`
-	Height      string               `json:"height,omitempty"`
-	Format      string               `json:"format,omitempty"`
-	Margin      *paperSizeMarginJSON `json:"margin,omitempty"`
-	Orientation string               `json:"orientation,omitempty"`
+	Width       string                `json:"width,omitempty"`
+	Height      string                `json:"height,omitempty"`
+	Format      string                `json:"format,omitempty"`
+	Margin      *paperSizeMarginJSON  `json:"margin,omitempty"`
+	Orientation string                `json:"orientation,omitempty"`
+	Header      *paperSizeSectionJSON `json:"header,omitempty"`
+	Footer      *paperSizeSectionJSON `json:"footer,omitempty"`
 }
 
 type paperSizeMarginJSON struct {
@@ -1099,6 +1417,11 @@ type paperSizeMarginJSON struct {
 	Right  string `json:"right,omitempty"`
 }
 
+type paperSizeSectionJSON struct {
+	Height   string `json:"height,omitempty"`
+	Contents string `json:"contents"`
+}
+
 func encodePaperSizeJSON(v PaperSize) paperSizeJSON {
 	out := paperSizeJSON{
 		Width:       v.Width,
@@ -1114,6 +1437,12 @@ func encodePaperSizeJSON(v PaperSize) paperSizeJSON {
 			Right:  v.Margin.Right,
 		}
 	}
+	if v.Header != nil {
+		out.Header = &paperSizeSectionJSON{Height: v.Header.Height, Contents: v.Header.Contents}
+	}
+	if v.Footer != nil {
+		out.Footer = &paperSizeSectionJSON{Height: v.Footer.Height, Contents: v.Footer.Contents}
+	}
 	return out
 }
 
@@ -1132,6 +1461,12 @@ func decodePaperSizeJSON(v paperSizeJSON) PaperSize {
 			Right:  v.Margin.Right,
 		}
 	}
+	if v.Header != nil {
+		out.Header = &PaperSizeSection{Height: v.Header.Height, Contents: v.Header.Contents}
+	}
+	if v.Footer != nil {
+		out.Footer = &PaperSizeSection{Height: v.Footer.Height, Contents: v.Footer.Contents}
+	}
 	return out
 }
 
@@ -1141,17 +1476,19 @@ type Position struct {
 	Left int
 }
 
-// WebPageSettings represents various settings on a web page.
+// WebPageSettings represents various settings on a web page. JSON names match
+// the PhantomJS page.settings properties, except ResourceTimeout which is
+// encoded in nanoseconds like any time.Duration.
 type WebPageSettings struct {
-	JavascriptEnabled             bool
-	LoadImages                    bool
-	LocalToRemoteURLAccessEnabled bool
-	UserAgent                     string
-	Username                      string
-	Password                      string
-	XSSAuditingEnabled            bool
-	WebSecurityEnabled            bool
-	ResourceTimeout               time.Duration
+	JavascriptEnabled             bool          `json:"javascriptEnabled"`
+	LoadImages                    bool          `json:"loadImages"`
+	LocalToRemoteURLAccessEnabled bool          `json:"localToRemoteUrlAccessEnabled"`
+	UserAgent                     string        `json:"userAgent"`
+	Username                      string        `json:"username"`
+	Password                      string        `json:"password"`
+	XSSAuditingEnabled            bool          `json:"XSSAuditingEnabled"`
+	WebSecurityEnabled            bool          `json:"webSecurityEnabled"`
+	ResourceTimeout               time.Duration `json:"resourceTimeout"`
 }
 
 type webPageSettingsJSON struct {
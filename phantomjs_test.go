@@ -2,14 +2,19 @@ package phantomjs_test
 
 import (
 	"bytes"
+	"context"
 	"encoding/base64"
+	"encoding/json"
 	"fmt"
 	"image/png"
 	"io/ioutil"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"path/filepath"
 	"reflect"
+	"strconv"
+	"sync"
 	"testing"
 	"time"
 
@@ -715,6 +720,39 @@ func TestWebPage_PaperSize(t *testing.T) {
 			t.Fatalf("unexpected size: %#v", other)
 		}
 	})
+
+	// Ensure header & footer templates can be set and rendered.
+	t.Run("HeaderFooter", func(t *testing.T) {
+		page := p.MustCreateWebPage()
+		defer MustClosePage(page)
+
+		sz := phantomjs.PaperSize{
+			Format: "A4",
+			Header: &phantomjs.PaperSizeSection{Height: "1cm", Contents: `<h1>INVOICE</h1>`},
+			Footer: &phantomjs.PaperSizeSection{Height: "1cm", Contents: `<span>Page {{.PageNum}} of {{.NumPages}}</span>`},
+		}
+		if err := page.SetPaperSize(sz); err != nil {
+			t.Fatal(err)
+		}
+		if other, err := page.PaperSize(); err != nil {
+			t.Fatal(err)
+		} else if !reflect.DeepEqual(other, sz) {
+			t.Fatalf("unexpected size: %#v", other)
+		}
+
+		// Rendering should invoke the header & footer callbacks.
+		if err := page.SetContent(`<html><body>TEST</body></html>`); err != nil {
+			t.Fatal(err)
+		}
+		path := filepath.Join(p.Path(), "header_footer.pdf")
+		if err := page.Render(path, "pdf", 100); err != nil {
+			t.Fatal(err)
+		} else if buf, err := ioutil.ReadFile(path); err != nil {
+			t.Fatal(err)
+		} else if !bytes.HasPrefix(buf, []byte("%PDF")) {
+			t.Fatalf("unexpected file header: %q", buf[:4])
+		}
+	})
 }
 
 // Ensure process can retrieve the plain text representation of a page.
@@ -756,6 +794,25 @@ func TestWebPage_ScrollPosition(t *testing.T) {
 	}
 }
 
+// Ensure paper sizes and page settings encode with PhantomJS property names.
+func TestWebPageSettings_JSON(t *testing.T) {
+	if buf, err := json.Marshal(phantomjs.PaperSize{
+		Format: "A4",
+		Margin: &phantomjs.PaperSizeMargin{Top: "1cm"},
+		Footer: &phantomjs.PaperSizeSection{Height: "1cm", Contents: "{{.PageNum}}"},
+	}); err != nil {
+		t.Fatal(err)
+	} else if string(buf) != `{"format":"A4","margin":{"top":"1cm"},"footer":{"height":"1cm","contents":"{{.PageNum}}"}}` {
+		t.Fatalf("unexpected paper size: %s", buf)
+	}
+
+	if buf, err := json.Marshal(phantomjs.WebPageSettings{UserAgent: "Mozilla/5.0", XSSAuditingEnabled: true}); err != nil {
+		t.Fatal(err)
+	} else if string(buf) != `{"javascriptEnabled":false,"loadImages":false,"localToRemoteUrlAccessEnabled":false,"userAgent":"Mozilla/5.0","username":"","password":"","XSSAuditingEnabled":true,"webSecurityEnabled":false,"resourceTimeout":0}` {
+		t.Fatalf("unexpected settings: %s", buf)
+	}
+}
+
 // Ensure process can set and retrieve page settings.
 func TestWebPage_Settings(t *testing.T) {
 	p := MustOpenNewProcess()
@@ -999,6 +1056,33 @@ func TestWebPage_Evaluate(t *testing.T) {
 	}
 }
 
+// Ensure web page can wait for an element to be added to the document.
+func TestWebPage_WaitForSelector(t *testing.T) {
+	p := MustOpenNewProcess()
+	defer p.MustClose()
+
+	page := p.MustCreateWebPage()
+	defer MustClosePage(page)
+	if err := page.SetContent(`<html><body></body></html>`); err != nil {
+		t.Fatal(err)
+	} else if err := page.EvaluateAsync(`function() { document.body.innerHTML = '<p title="a \'b\'">OK</p>'; }`, 100*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := page.WaitForSelector(ctx, `p[title="a 'b'"]`); err != nil {
+		t.Fatal(err)
+	}
+
+	// Ensure waiting stops when the context is done.
+	ctx, cancel = context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := page.WaitForSelector(ctx, "#missing"); err != context.DeadlineExceeded {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
 // Ensure process can retrieve a page by window name.
 func TestWebPage_Page(t *testing.T) {
 	p := MustOpenNewProcess()
@@ -1247,6 +1331,50 @@ func TestWebPage_Open(t *testing.T) {
 	}
 }
 
+// Ensure web page loads stylesheets and images only when opened with OpenAll.
+func TestWebPage_OpenAll(t *testing.T) {
+	// Serve web page and count stylesheet requests.
+	var mu sync.Mutex
+	var n int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/style.css" {
+			mu.Lock()
+			n++
+			mu.Unlock()
+			w.Header().Set("Content-Type", "text/css")
+			w.Write([]byte("body { color: red; }"))
+			return
+		}
+		w.Write([]byte(`<html><head><link rel="stylesheet" href="/style.css"></head><body>OK</body></html>`))
+	}))
+	defer srv.Close()
+	count := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return n
+	}
+
+	// Start process.
+	p := MustOpenNewProcess()
+	defer p.MustClose()
+
+	// Ensure Open blocks the stylesheet.
+	page := p.MustCreateWebPage()
+	defer MustClosePage(page)
+	if err := page.Open(srv.URL); err != nil {
+		t.Fatal(err)
+	} else if n := count(); n != 0 {
+		t.Fatalf("unexpected stylesheet requests: %d", n)
+	}
+
+	// Ensure OpenAll loads it.
+	if err := page.OpenAll(srv.URL); err != nil {
+		t.Fatal(err)
+	} else if n := count(); n != 1 {
+		t.Fatalf("unexpected stylesheet requests: %d", n)
+	}
+}
+
 // Ensure web page can reload a web page.
 func TestWebPage_Reload(t *testing.T) {
 	// Serve web page.
@@ -1590,6 +1718,228 @@ func TestWebPage_UploadFile(t *testing.T) {
 	}
 }
 
+// Ensure process can add, retrieve and delete cookies before any page exists.
+func TestProcess_Cookies(t *testing.T) {
+	p := MustOpenNewProcess()
+	defer p.MustClose()
+
+	// Add cookies to the global jar.
+	if ok, err := p.AddCookie(&http.Cookie{Name: "NAME1", Value: "VALUE1", Domain: ".example1.com", Path: "/"}); err != nil {
+		t.Fatal(err)
+	} else if !ok {
+		t.Fatal("expected cookie to be added")
+	}
+	if ok, err := p.AddCookie(&http.Cookie{Name: "NAME2", Value: "VALUE2", Domain: ".example2.com", Path: "/"}); err != nil {
+		t.Fatal(err)
+	} else if !ok {
+		t.Fatal("expected cookie to be added")
+	}
+
+	// Verify cookies exist.
+	if a, err := p.Cookies(); err != nil {
+		t.Fatal(err)
+	} else if len(a) != 2 {
+		t.Fatalf("unexpected cookie count: %d", len(a))
+	}
+
+	// Delete one cookie.
+	if ok, err := p.DeleteCookie("NAME1"); err != nil {
+		t.Fatal(err)
+	} else if !ok {
+		t.Fatal("expected cookie to be deleted")
+	}
+	if a, err := p.Cookies(); err != nil {
+		t.Fatal(err)
+	} else if len(a) != 1 || a[0].Name != "NAME2" {
+		t.Fatalf("unexpected cookies: %#v", a)
+	}
+
+	// Clear all cookies.
+	if err := p.ClearCookies(); err != nil {
+		t.Fatal(err)
+	} else if a, err := p.Cookies(); err != nil {
+		t.Fatal(err)
+	} else if len(a) != 0 {
+		t.Fatalf("unexpected cookie count: %d", len(a))
+	}
+}
+
+// Ensure process can enable and disable cookies.
+func TestProcess_CookiesEnabled(t *testing.T) {
+	p := MustOpenNewProcess()
+	defer p.MustClose()
+
+	if v, err := p.CookiesEnabled(); err != nil {
+		t.Fatal(err)
+	} else if !v {
+		t.Fatal("expected cookies enabled")
+	}
+
+	if err := p.SetCookiesEnabled(false); err != nil {
+		t.Fatal(err)
+	} else if v, err := p.CookiesEnabled(); err != nil {
+		t.Fatal(err)
+	} else if v {
+		t.Fatal("expected cookies disabled")
+	}
+}
+
+// Ensure concurrent calls to a page are serialized and frame-scoped calls are atomic.
+func TestWebPage_Concurrent(t *testing.T) {
+	// Mock shim which records the order of calls and detects overlapping calls.
+	var mu sync.Mutex
+	var calls []string
+	var inflight int
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &httptest.Server{Listener: ln, Config: &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/webpage/Create" {
+			w.Write([]byte(`{"ref":{"id":"1"}}`))
+			return
+		}
+
+		mu.Lock()
+		calls = append(calls, r.URL.Path)
+		inflight++
+		if inflight > 1 {
+			t.Errorf("overlapping call: %s", r.URL.Path)
+		}
+		mu.Unlock()
+
+		time.Sleep(time.Millisecond)
+
+		mu.Lock()
+		inflight--
+		mu.Unlock()
+		w.Write([]byte(`{}`))
+	})}}
+	srv.Start()
+	defer srv.Close()
+
+	p := phantomjs.NewProcess()
+	p.Port = ln.Addr().(*net.TCPAddr).Port
+	page, err := p.CreateWebPage()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			if err := page.InFrame("child", func(page *phantomjs.WebPage) error {
+				_, err := page.Title()
+				return err
+			}); err != nil {
+				t.Error(err)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			if _, err := page.URL(); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Each frame switch must be followed by its call and the switch back.
+	for i, path := range calls {
+		if path != "/webpage/SwitchToFrameName" {
+			continue
+		} else if i+2 >= len(calls) || calls[i+1] != "/webpage/Title" || calls[i+2] != "/webpage/SwitchToParentFrame" {
+			t.Fatalf("interleaved frame calls at %d: %v", i, calls)
+		}
+	}
+}
+
+// Ensure nested Do() and InFrame() calls on the page passed to fn do not
+// lock the page again.
+func TestWebPage_Do_Nested(t *testing.T) {
+	var mu sync.Mutex
+	var calls []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		calls = append(calls, r.URL.Path)
+		mu.Unlock()
+		w.Write([]byte(`{"ref":{"id":"1"}}`))
+	}))
+	defer srv.Close()
+
+	p := phantomjs.NewProcess()
+	p.BaseURL = srv.URL
+	page, err := p.CreateWebPage()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- page.Do(func(page *phantomjs.WebPage) error {
+			return page.Do(func(page *phantomjs.WebPage) error {
+				return page.InFrame("child", func(page *phantomjs.WebPage) error {
+					_, err := page.Title()
+					return err
+				})
+			})
+		})
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("deadlock")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if exp := []string{"/webpage/Create", "/webpage/SwitchToFrameName", "/webpage/Title", "/webpage/SwitchToParentFrame"}; !reflect.DeepEqual(calls, exp) {
+		t.Fatalf("unexpected calls: %v", calls)
+	}
+}
+
+// Ensure element screenshots on the same page do not share a clip rect.
+func TestWebPage_Concurrent_ScreenshotElement(t *testing.T) {
+	p := MustOpenNewProcess()
+	defer p.MustClose()
+
+	page := p.MustCreateWebPage()
+	defer MustClosePage(page)
+	if err := page.SetContent(`<html><body style="margin:0"><div id="a" style="width:40px;height:30px"></div><div id="b" style="width:20px;height:10px"></div></body></html>`); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		for _, tt := range []struct {
+			selector string
+			w, h     int
+		}{{"#a", 40, 30}, {"#b", 20, 10}} {
+			wg.Add(1)
+			go func(selector string, w, h int) {
+				defer wg.Done()
+				buf, err := page.ScreenshotElement(selector, phantomjs.RenderOptions{})
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				img, err := png.Decode(bytes.NewReader(buf))
+				if err != nil {
+					t.Error(err)
+				} else if b := img.Bounds(); b.Dx() != w || b.Dy() != h {
+					t.Errorf("unexpected %s dimensions: %dx%d", selector, b.Dx(), b.Dy())
+				}
+			}(tt.selector, tt.w, tt.h)
+		}
+	}
+	wg.Wait()
+}
+
 // Process is a test wrapper for phantomjs.Process.
 type Process struct {
 	*phantomjs.Process
@@ -1625,6 +1975,45 @@ func (p *Process) MustCreateWebPage() *phantomjs.WebPage {
 	return page
 }
 
+// MustFreePort returns a local TCP port which is not in use. Panic on error.
+func MustFreePort() int {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(err)
+	}
+	defer ln.Close()
+	return ln.Addr().(*net.TCPAddr).Port
+}
+
+// MustFreePorts returns the first of n consecutive local TCP ports which are
+// not in use, such as for a pool's BasePort. Panic if none are found.
+func MustFreePorts(n int) int {
+	for i := 0; i < 100; i++ {
+		base, ok := MustFreePort(), true
+		for port := base; port < base+n && ok; port++ {
+			ln, err := net.Listen("tcp", "127.0.0.1:"+strconv.Itoa(port))
+			if err != nil {
+				ok = false
+				continue
+			}
+			ln.Close()
+		}
+		if ok {
+			return base
+		}
+	}
+	panic("no consecutive free ports")
+}
+
+// MustTempDir returns a new temporary directory. Panic on error.
+func MustTempDir() string {
+	path, err := ioutil.TempDir("", "phantomjs-")
+	if err != nil {
+		panic(err)
+	}
+	return path
+}
+
 // MustClosePage closes page. Panic on error.
 func MustClosePage(page *phantomjs.WebPage) {
 	if err := page.Close(); err != nil {
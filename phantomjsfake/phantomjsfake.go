@@ -0,0 +1,366 @@
+// Package phantomjsfake implements an in-memory fake of the PhantomJS shim so
+// code using phantomjs can be unit tested without the phantomjs binary.
+//
+// The fake is an http.Handler. Point a process at it using BaseURL instead of
+// calling Open():
+//
+//	fake := phantomjsfake.NewHandler()
+//	fake.HandleOpen("http://example.com/", phantomjsfake.Document{
+//		Content: "<html><head><title>Example</title></head></html>",
+//	})
+//	srv := httptest.NewServer(fake)
+//	defer srv.Close()
+//
+//	p := phantomjs.NewProcess()
+//	p.BaseURL = srv.URL
+//
+// Pages hold their URL, content and simple properties such as the viewport
+// size. Results for Open, Evaluate and RenderBase64 are programmable and every
+// call is recorded for assertions. Routes without specific behavior store the
+// values passed to setters and otherwise return empty results.
+package phantomjsfake
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Document represents the result of opening a URL.
+type Document struct {
+	// HTML content of the page. The title is parsed from the content unless
+	// Title is set.
+	Content string
+	Title   string
+
+	// If true, opening the URL fails.
+	Fail bool
+}
+
+// Page represents the state of a fake web page.
+type Page struct {
+	ID      string
+	URL     string
+	Content string
+	Title   string
+
+	// Values passed to setters without specific behavior, keyed by the
+	// property name (e.g. "ZoomFactor").
+	Props map[string]json.RawMessage
+}
+
+// Call represents a request made to the fake.
+type Call struct {
+	// Request path, such as "/webpage/Open".
+	Path string
+
+	// Page reference ID, if any.
+	Ref string
+
+	// Decoded request body.
+	Body map[string]interface{}
+}
+
+// Handler is an http.Handler which implements the shim's API in memory.
+type Handler struct {
+	// If set, called for each evaluated script before results registered
+	// with HandleEvaluate(). It is passed a copy of the page and is called
+	// without holding the handler's lock so it may call other methods.
+	EvaluateFunc func(page *Page, script string) (interface{}, error)
+
+	mu        sync.Mutex
+	nextID    int
+	pages     map[string]*Page
+	documents map[string]Document
+	evaluates []evaluateResult
+	images    map[string]string
+	calls     []Call
+}
+
+// evaluateResult is a result returned for scripts containing a substring.
+type evaluateResult struct {
+	substr string
+	value  interface{}
+	err    error
+}
+
+// NewHandler returns a new instance of Handler.
+func NewHandler() *Handler {
+	return &Handler{
+		pages:     make(map[string]*Page),
+		documents: make(map[string]Document),
+		images:    make(map[string]string),
+	}
+}
+
+// HandleOpen sets the document loaded when url is opened.
+// Opening a URL without a document fails.
+func (h *Handler) HandleOpen(url string, doc Document) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.documents[url] = doc
+}
+
+// HandleEvaluate sets the value returned by scripts containing substr.
+// Results are checked in the order they are added.
+func (h *Handler) HandleEvaluate(substr string, value interface{}) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.evaluates = append(h.evaluates, evaluateResult{substr: substr, value: value})
+}
+
+// HandleEvaluateError sets the error returned by scripts containing substr.
+func (h *Handler) HandleEvaluateError(substr string, err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.evaluates = append(h.evaluates, evaluateResult{substr: substr, err: err})
+}
+
+// HandleRender sets the base64 encoded image returned by RenderBase64()
+// for a format.
+func (h *Handler) HandleRender(format, data string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.images[format] = data
+}
+
+// Calls returns all requests made to the fake, in order.
+func (h *Handler) Calls() []Call {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]Call{}, h.calls...)
+}
+
+// CallsTo returns the requests made to a path, such as "/webpage/Open".
+func (h *Handler) CallsTo(path string) []Call {
+	var a []Call
+	for _, call := range h.Calls() {
+		if call.Path == path {
+			a = append(a, call)
+		}
+	}
+	return a
+}
+
+// Pages returns a copy of all open pages.
+func (h *Handler) Pages() []Page {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	a := make([]Page, 0, len(h.pages))
+	for i := 1; i <= h.nextID; i++ {
+		if page := h.pages[strconv.Itoa(i)]; page != nil {
+			a = append(a, *page)
+		}
+	}
+	return a
+}
+
+// ServeHTTP implements the shim's HTTP API.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/ping" {
+		w.Write([]byte("ok"))
+		return
+	}
+
+	buf, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var body map[string]interface{}
+	if len(buf) > 0 {
+		if err := json.Unmarshal(buf, &body); err != nil {
+			writeError(w, r, err)
+			return
+		}
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	call := Call{Path: r.URL.Path, Body: body}
+	call.Ref, _ = body["ref"].(string)
+	h.calls = append(h.calls, call)
+
+	resp, err := h.handle(call, buf)
+	if err == errNotFound {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"error":"not found"}`))
+		return
+	} else if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if resp == nil {
+		resp = map[string]interface{}{}
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+// errNotFound is returned by handle() for unknown routes.
+var errNotFound = fmt.Errorf("not found")
+
+// handle returns the response for a call. The handler's lock must be held.
+// It is released while calling EvaluateFunc.
+func (h *Handler) handle(call Call, buf []byte) (interface{}, error) {
+	if !strings.HasPrefix(call.Path, "/webpage/") {
+		return nil, errNotFound
+	}
+	name := strings.TrimPrefix(call.Path, "/webpage/")
+
+	if name == "Create" {
+		h.nextID++
+		id := strconv.Itoa(h.nextID)
+		h.pages[id] = &Page{ID: id, URL: "about:blank", Props: make(map[string]json.RawMessage)}
+		return map[string]interface{}{"ref": map[string]string{"id": id}}, nil
+	}
+
+	page := h.pages[call.Ref]
+	if page == nil {
+		return nil, fmt.Errorf("page not found: %q", call.Ref)
+	}
+
+	switch name {
+	case "Close":
+		delete(h.pages, page.ID)
+		return nil, nil
+
+	case "Open":
+		url, _ := call.Body["url"].(string)
+		doc, ok := h.documents[url]
+		if !ok || doc.Fail {
+			return map[string]string{"status": "fail"}, nil
+		}
+		page.URL = url
+		page.setContent(doc.Content, doc.Title)
+		return map[string]string{"status": "success"}, nil
+
+	case "SetContent":
+		content, _ := call.Body["content"].(string)
+		page.setContent(content, "")
+		return nil, nil
+
+	case "SetContentAndURL":
+		content, _ := call.Body["content"].(string)
+		page.URL, _ = call.Body["url"].(string)
+		page.setContent(content, "")
+		return nil, nil
+
+	case "Content", "FrameContent":
+		return map[string]string{"value": page.Content}, nil
+	case "PlainText", "FramePlainText":
+		return map[string]string{"value": plainText(page.Content)}, nil
+	case "Title", "FrameTitle":
+		return map[string]string{"value": page.Title}, nil
+	case "URL", "FrameURL":
+		return map[string]string{"value": page.URL}, nil
+
+	case "Evaluate", "EvaluateJavaScript":
+		script, _ := call.Body["script"].(string)
+		value, err := h.evaluate(page, script)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"returnValue": value}, nil
+
+	case "RenderBase64":
+		format, _ := call.Body["format"].(string)
+		return map[string]string{"returnValue": h.images[format]}, nil
+
+	case "ViewportSize":
+		var v struct {
+			Width  int `json:"width"`
+			Height int `json:"height"`
+		}
+		json.Unmarshal(page.Props["ViewportSize"], &v)
+		return v, nil
+
+	case "Settings":
+		return map[string]json.RawMessage{"settings": page.prop("Settings", "settings")}, nil
+	}
+
+	// Store setter values and return them from their getters.
+	if strings.HasPrefix(name, "Set") {
+		page.Props[strings.TrimPrefix(name, "Set")] = json.RawMessage(buf)
+		return nil, nil
+	}
+	for _, key := range []string{"value", "rect", "headers", "position", "size"} {
+		if v := page.prop(name, key); v != nil {
+			return map[string]json.RawMessage{"value": v}, nil
+		}
+	}
+	return nil, nil
+}
+
+// evaluate returns the programmed result for a script. The handler's lock
+// must be held.
+func (h *Handler) evaluate(page *Page, script string) (interface{}, error) {
+	if fn := h.EvaluateFunc; fn != nil {
+		other := page.clone()
+		h.mu.Unlock()
+		defer h.mu.Lock()
+		return fn(other, script)
+	}
+	for _, r := range h.evaluates {
+		if strings.Contains(script, r.substr) {
+			return r.value, r.err
+		}
+	}
+	return nil, nil
+}
+
+// clone returns a copy of the page which does not share its props.
+func (p *Page) clone() *Page {
+	other := *p
+	other.Props = make(map[string]json.RawMessage, len(p.Props))
+	for k, v := range p.Props {
+		other.Props[k] = v
+	}
+	return &other
+}
+
+// setContent sets the page content and its title. The title is parsed from
+// the content if blank.
+func (p *Page) setContent(content, title string) {
+	p.Content = content
+	if title == "" {
+		if m := titleRegex.FindStringSubmatch(content); m != nil {
+			title = strings.TrimSpace(html.UnescapeString(m[1]))
+		}
+	}
+	p.Title = title
+}
+
+// prop returns a field from the request stored for a setter.
+// Returns nil if the property was never set or has no such field.
+func (p *Page) prop(name, key string) json.RawMessage {
+	var m map[string]json.RawMessage
+	if err := json.Unmarshal(p.Props[name], &m); err != nil {
+		return nil
+	}
+	return m[key]
+}
+
+var (
+	titleRegex = regexp.MustCompile(`(?is)<title[^>]*>(.*?)</title>`)
+	tagRegex   = regexp.MustCompile(`(?is)<(script|style)[^>]*>.*?</(script|style)>|<[^>]*>`)
+	spaceRegex = regexp.MustCompile(`\s+`)
+)
+
+// plainText returns the content with tags removed and whitespace collapsed.
+func plainText(content string) string {
+	s := tagRegex.ReplaceAllString(content, " ")
+	return strings.TrimSpace(spaceRegex.ReplaceAllString(html.UnescapeString(s), " "))
+}
+
+// writeError writes an error response in the same form as the shim.
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	w.WriteHeader(http.StatusInternalServerError)
+	json.NewEncoder(w).Encode(map[string]string{"url": r.URL.Path, "error": err.Error()})
+}
@@ -0,0 +1,153 @@
+package phantomjsfake_test
+
+import (
+	"errors"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/kere/phantomjs"
+	"github.com/kere/phantomjs/phantomjsfake"
+)
+
+// Ensure a process can open pages served by the fake.
+func TestHandler_Open(t *testing.T) {
+	fake := phantomjsfake.NewHandler()
+	fake.HandleOpen("http://example.com/", phantomjsfake.Document{
+		Content: `<html><head><title>Example</title></head><body><p>Hello &amp; bye</p></body></html>`,
+	})
+	fake.HandleOpen("http://example.com/down", phantomjsfake.Document{Fail: true})
+	p := NewProcess(t, fake)
+
+	page, err := p.CreateWebPage()
+	if err != nil {
+		t.Fatal(err)
+	} else if err := page.Open("http://example.com/"); err != nil {
+		t.Fatal(err)
+	}
+
+	if title, err := page.Title(); err != nil {
+		t.Fatal(err)
+	} else if title != "Example" {
+		t.Fatalf("unexpected title: %q", title)
+	} else if u, err := page.URL(); err != nil {
+		t.Fatal(err)
+	} else if u != "http://example.com/" {
+		t.Fatalf("unexpected url: %q", u)
+	} else if text, err := page.PlainText(); err != nil {
+		t.Fatal(err)
+	} else if text != "Example Hello & bye" {
+		t.Fatalf("unexpected plain text: %q", text)
+	}
+
+	// Failed and unknown documents should return an error.
+	if err := page.Open("http://example.com/down"); err == nil {
+		t.Fatal("expected error")
+	} else if err := page.Open("http://example.com/missing"); err == nil {
+		t.Fatal("expected error")
+	}
+
+	// Verify call log.
+	if calls := fake.CallsTo("/webpage/Open"); len(calls) != 3 {
+		t.Fatalf("unexpected open calls: %d", len(calls))
+	} else if calls[1].Body["url"] != "http://example.com/down" {
+		t.Fatalf("unexpected url: %v", calls[1].Body["url"])
+	}
+}
+
+// Ensure evaluated scripts return programmed results.
+func TestHandler_Evaluate(t *testing.T) {
+	fake := phantomjsfake.NewHandler()
+	fake.HandleEvaluate("document.title", "TITLE")
+	fake.HandleEvaluateError("throw", errors.New("boom"))
+	p := NewProcess(t, fake)
+
+	page, err := p.CreateWebPage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, err := page.Evaluate(`function() { return document.title; }`); err != nil {
+		t.Fatal(err)
+	} else if v != "TITLE" {
+		t.Fatalf("unexpected value: %#v", v)
+	}
+	if _, err := page.Evaluate(`function() { throw 'x'; }`); err == nil || err.Error() != "boom" {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if v, err := page.Evaluate(`function() { return 1; }`); err != nil {
+		t.Fatal(err)
+	} else if v != nil {
+		t.Fatalf("unexpected value: %#v", v)
+	}
+}
+
+// Ensure EvaluateFunc may call the handler without deadlocking.
+func TestHandler_EvaluateFunc(t *testing.T) {
+	fake := phantomjsfake.NewHandler()
+	fake.EvaluateFunc = func(page *phantomjsfake.Page, script string) (interface{}, error) {
+		fake.HandleEvaluate("never", nil)
+		return float64(len(fake.Calls()) + len(fake.Pages())), nil
+	}
+	p := NewProcess(t, fake)
+
+	page, err := p.CreateWebPage()
+	if err != nil {
+		t.Fatal(err)
+	} else if v, err := page.Evaluate(`function() { return 1; }`); err != nil {
+		t.Fatal(err)
+	} else if v != float64(3) {
+		t.Fatalf("unexpected value: %#v", v)
+	}
+}
+
+// Ensure setters are stored and returned by getters.
+func TestHandler_Props(t *testing.T) {
+	fake := phantomjsfake.NewHandler()
+	p := NewProcess(t, fake)
+
+	page, err := p.CreateWebPage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := page.SetViewportSize(300, 200); err != nil {
+		t.Fatal(err)
+	} else if w, h, err := page.ViewportSize(); err != nil {
+		t.Fatal(err)
+	} else if w != 300 || h != 200 {
+		t.Fatalf("unexpected viewport: %dx%d", w, h)
+	}
+
+	if err := page.SetZoomFactor(2); err != nil {
+		t.Fatal(err)
+	} else if v, err := page.ZoomFactor(); err != nil {
+		t.Fatal(err)
+	} else if v != 2 {
+		t.Fatalf("unexpected zoom: %v", v)
+	}
+
+	rect := phantomjs.Rect{Top: 1, Left: 2, Width: 3, Height: 4}
+	if err := page.SetClipRect(rect); err != nil {
+		t.Fatal(err)
+	} else if v, err := page.ClipRect(); err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(v, rect) {
+		t.Fatalf("unexpected clip rect: %#v", v)
+	}
+
+	if err := page.Close(); err != nil {
+		t.Fatal(err)
+	} else if a := fake.Pages(); len(a) != 0 {
+		t.Fatalf("unexpected pages: %d", len(a))
+	}
+}
+
+// NewProcess returns a process backed by fake. The server is closed when
+// the test ends.
+func NewProcess(tb testing.TB, fake *phantomjsfake.Handler) *phantomjs.Process {
+	srv := httptest.NewServer(fake)
+	tb.Cleanup(srv.Close)
+
+	p := phantomjs.NewProcess()
+	p.BaseURL = srv.URL
+	return p
+}
@@ -0,0 +1,10 @@
+package phantomjstest
+
+import "flag"
+
+// Update is set by the "-update" flag, which is registered by this package.
+// If true, phantomjs.CompareScreenshot() rewrites golden files instead of
+// comparing against them:
+//
+//	go test ./... -update
+var Update = flag.Bool("update", false, "rewrite golden files")
@@ -0,0 +1,188 @@
+// Package phantomjstest provides utilities for testing code which uses
+// PhantomJS, including a shared process, page helpers and a fixture server.
+//
+// Tests using the shared process should call Main from TestMain so the
+// process is stopped once all tests have run:
+//
+//	func TestMain(m *testing.M) {
+//		phantomjstest.Main(m)
+//	}
+//
+// Helpers skip the calling test when the phantomjs binary is not installed.
+package phantomjstest
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/kere/phantomjs"
+)
+
+// BinPath is the path to the phantomjs binary used by helpers. It defaults to
+// the PHANTOMJS environment variable, if set.
+var BinPath = phantomjs.DefaultBinPath
+
+func init() {
+	if s := os.Getenv("PHANTOMJS"); s != "" {
+		BinPath = s
+	}
+}
+
+// Available returns true if the phantomjs binary can be found.
+func Available() bool {
+	_, err := exec.LookPath(BinPath)
+	return err == nil
+}
+
+// SkipIfUnavailable skips the test if the phantomjs binary cannot be found.
+func SkipIfUnavailable(tb testing.TB) {
+	tb.Helper()
+	if !Available() {
+		tb.Skipf("phantomjs binary not found: %s", BinPath)
+	}
+}
+
+// shared holds the process shared by all tests in the test binary.
+var shared struct {
+	once    sync.Once
+	process *phantomjs.Process
+	err     error
+}
+
+// Process returns the process shared by all tests in the test binary. The
+// process is started on first use and stopped by Main.
+func Process(tb testing.TB) *phantomjs.Process {
+	tb.Helper()
+	SkipIfUnavailable(tb)
+
+	shared.once.Do(func() {
+		shared.process, shared.err = openProcess()
+	})
+	if shared.err != nil {
+		tb.Fatalf("cannot open shared process: %s", shared.err)
+	}
+	return shared.process
+}
+
+// NewProcess returns a new, open process which is closed when the test ends.
+func NewProcess(tb testing.TB) *phantomjs.Process {
+	tb.Helper()
+	SkipIfUnavailable(tb)
+
+	p, err := openProcess()
+	if err != nil {
+		tb.Fatalf("cannot open process: %s", err)
+	}
+	tb.Cleanup(func() { p.Close() })
+	return p
+}
+
+// openProcess starts a process on a free port.
+func openProcess() (*phantomjs.Process, error) {
+	port, err := freePort()
+	if err != nil {
+		return nil, err
+	}
+
+	p := phantomjs.NewProcess()
+	p.BinPath = BinPath
+	p.Port = port
+	if err := p.Open(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// freePort returns a local TCP port which is not in use.
+func freePort() (int, error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, err
+	}
+	defer ln.Close()
+	return ln.Addr().(*net.TCPAddr).Port, nil
+}
+
+// Main runs the tests and then stops the shared process, if started.
+// It exits with the result of m.Run().
+func Main(m *testing.M) {
+	code := m.Run()
+	if shared.process != nil {
+		shared.process.Close()
+	}
+	os.Exit(code)
+}
+
+// Page returns a new page on the shared process which is closed when the
+// test ends.
+func Page(tb testing.TB) *phantomjs.WebPage {
+	tb.Helper()
+	return CreateWebPage(tb, Process(tb))
+}
+
+// CreateWebPage returns a new page on p which is closed when the test ends.
+func CreateWebPage(tb testing.TB, p *phantomjs.Process) *phantomjs.WebPage {
+	tb.Helper()
+	page, err := p.CreateWebPage()
+	if err != nil {
+		tb.Fatalf("cannot create page: %s", err)
+	}
+	tb.Cleanup(func() { page.Close() })
+	return page
+}
+
+// OpenPage returns a new page on the shared process with url opened.
+func OpenPage(tb testing.TB, url string) *phantomjs.WebPage {
+	tb.Helper()
+	page := Page(tb)
+	if err := page.Open(url); err != nil {
+		tb.Fatalf("cannot open %s: %s", url, err)
+	}
+	return page
+}
+
+// Server is a test HTTP server which serves files from a directory. Routes
+// can be added to serve specific paths, which take precedence over files.
+type Server struct {
+	*httptest.Server
+
+	mux *http.ServeMux
+}
+
+// NewServer returns a running server serving files from dir, relative to the
+// package directory. Uses "testdata" if dir is blank. The server is closed
+// when the test ends.
+func NewServer(tb testing.TB, dir string) *Server {
+	tb.Helper()
+	if dir == "" {
+		dir = "testdata"
+	}
+
+	s := &Server{mux: http.NewServeMux()}
+	s.mux.Handle("/", http.FileServer(http.Dir(filepath.FromSlash(dir))))
+	s.Server = httptest.NewServer(s.mux)
+	tb.Cleanup(s.Close)
+	return s
+}
+
+// Handle registers a handler for a route, using http.ServeMux patterns.
+// The "/" pattern is reserved for serving files.
+func (s *Server) Handle(pattern string, h http.Handler) {
+	s.mux.Handle(pattern, h)
+}
+
+// HandleFunc registers a handler function for a route.
+func (s *Server) HandleFunc(pattern string, fn func(http.ResponseWriter, *http.Request)) {
+	s.mux.HandleFunc(pattern, fn)
+}
+
+// URLFor returns the absolute URL for path on the server.
+func (s *Server) URLFor(path string) string {
+	return s.URL + path
+}
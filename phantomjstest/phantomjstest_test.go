@@ -0,0 +1,60 @@
+package phantomjstest_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/kere/phantomjs/phantomjstest"
+)
+
+func TestMain(m *testing.M) {
+	phantomjstest.Main(m)
+}
+
+// Ensure the server serves testdata files and registered routes.
+func TestServer(t *testing.T) {
+	s := phantomjstest.NewServer(t, "")
+	s.HandleFunc("/api", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("route"))
+	})
+
+	for path, exp := range map[string]string{
+		"/index.html": "<html><head><title>Fixture</title></head><body><h1>Hello</h1></body></html>\n",
+		"/api":        "route",
+	} {
+		resp, err := http.Get(s.URLFor(path))
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if string(body) != exp {
+			t.Fatalf("unexpected body for %s: %q", path, body)
+		}
+	}
+}
+
+// Ensure a fixture can be opened in a page on the shared process.
+func TestOpenPage(t *testing.T) {
+	s := phantomjstest.NewServer(t, "")
+
+	page := phantomjstest.OpenPage(t, s.URLFor("/index.html"))
+	if title, err := page.Title(); err != nil {
+		t.Fatal(err)
+	} else if title != "Fixture" {
+		t.Fatalf("unexpected title: %s", title)
+	}
+}
+
+// Ensure pages on the shared process are independent.
+func TestPage(t *testing.T) {
+	page0, page1 := phantomjstest.Page(t), phantomjstest.Page(t)
+	if err := page0.SetContent(`<html><head><title>A</title></head></html>`); err != nil {
+		t.Fatal(err)
+	} else if title, err := page1.Title(); err != nil {
+		t.Fatal(err)
+	} else if title != "" {
+		t.Fatalf("unexpected title: %s", title)
+	}
+}
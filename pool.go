@@ -0,0 +1,108 @@
+package phantomjs
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// DefaultPagePoolSize is the number of pages used by a process' shared pool.
+const DefaultPagePoolSize = 4
+
+// ErrPoolClosed is returned when retrieving a page from a closed pool.
+var ErrPoolClosed = errors.New("pool closed")
+
+// PagePool represents a fixed-size pool of reusable web pages on a process.
+// It is safe for concurrent use.
+type PagePool struct {
+	process *Process
+	sem     chan struct{}
+	idle    chan *WebPage
+
+	mu     sync.Mutex
+	closed bool
+}
+
+// NewPagePool returns a new pool of up to size pages created on p.
+// Pages are created lazily as they are needed.
+func NewPagePool(p *Process, size int) *PagePool {
+	if size <= 0 {
+		size = DefaultPagePoolSize
+	}
+	return &PagePool{
+		process: p,
+		sem:     make(chan struct{}, size),
+		idle:    make(chan *WebPage, size),
+	}
+}
+
+// Get returns an idle page from the pool. A new page is created if the pool
+// has not reached its size. Otherwise Get blocks until a page is returned to
+// the pool or ctx is done.
+func (pp *PagePool) Get(ctx context.Context) (*WebPage, error) {
+	select {
+	case pp.sem <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	pp.mu.Lock()
+	closed := pp.closed
+	pp.mu.Unlock()
+	if closed {
+		<-pp.sem
+		return nil, ErrPoolClosed
+	}
+
+	// Reuse an idle page, if available.
+	select {
+	case page := <-pp.idle:
+		return page, nil
+	default:
+	}
+
+	page, err := pp.process.CreateWebPage()
+	if err != nil {
+		<-pp.sem
+		return nil, err
+	}
+	return page, nil
+}
+
+// Put returns a page to the pool so it can be reused.
+func (pp *PagePool) Put(page *WebPage) {
+	pp.mu.Lock()
+	if pp.closed {
+		page.Close()
+	} else {
+		pp.idle <- page
+	}
+	pp.mu.Unlock()
+	<-pp.sem
+}
+
+// Discard closes a page retrieved from the pool instead of reusing it. This
+// should be used when a page may have been left in an unknown state.
+func (pp *PagePool) Discard(page *WebPage) error {
+	defer func() { <-pp.sem }()
+	return page.Close()
+}
+
+// Close closes all idle pages. Pages currently in use are closed when they
+// are returned to the pool.
+func (pp *PagePool) Close() (err error) {
+	pp.mu.Lock()
+	defer pp.mu.Unlock()
+	pp.closed = true
+
+	for {
+		select {
+		case page := <-pp.idle:
+			if e := page.Close(); e != nil && err == nil {
+				err = e
+			}
+		default:
+			return err
+		}
+	}
+}
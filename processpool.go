@@ -0,0 +1,146 @@
+package phantomjs
+
+import (
+	"errors"
+	"sync"
+)
+
+// DefaultProcessPoolSize is the number of processes in a new pool.
+const DefaultProcessPoolSize = 2
+
+// Process pool errors.
+var (
+	// ErrPoolNotOpen is returned when using a process pool before it is opened.
+	ErrPoolNotOpen = errors.New("pool not open")
+
+	// ErrPoolOpen is returned when opening a process pool which is already open.
+	ErrPoolOpen = errors.New("pool already open")
+)
+
+// ProcessPool represents a group of PhantomJS processes which share work.
+// Each process listens on its own port starting from BasePort.
+type ProcessPool struct {
+	// Number of processes to start.
+	Size int
+
+	// HTTP port of the first process. Each process uses the next port.
+	BasePort int
+
+	// Settings applied to each process.
+	BinPath string
+	Options []string
+	TimeOut int
+
+	// If set, assigns a proxy to each process when the pool is opened and
+	// when RotateProxies() is called.
+	Proxies ProxyRotator
+
+	mu        sync.Mutex
+	processes []*Process
+	next      int
+}
+
+// NewProcessPool returns a new instance of ProcessPool with default settings.
+func NewProcessPool(size int) *ProcessPool {
+	return &ProcessPool{
+		Size:     size,
+		BasePort: DefaultPort,
+		BinPath:  DefaultBinPath,
+		TimeOut:  DefaultTimeOut,
+	}
+}
+
+// Open starts all processes in the pool. Returns ErrPoolOpen if the pool is
+// already open.
+func (pp *ProcessPool) Open() error {
+	pp.mu.Lock()
+	defer pp.mu.Unlock()
+	if len(pp.processes) > 0 {
+		return ErrPoolOpen
+	}
+
+	size := pp.Size
+	if size <= 0 {
+		size = DefaultProcessPoolSize
+	}
+
+	for i := 0; i < size; i++ {
+		p := NewProcess()
+		p.Port = pp.BasePort + i
+		p.BinPath = pp.BinPath
+		p.Options = append([]string{}, pp.Options...)
+		p.TimeOut = pp.TimeOut
+		if err := p.Open(); err != nil {
+			pp.close()
+			return err
+		}
+		pp.processes = append(pp.processes, p)
+
+		if pp.Proxies != nil {
+			if err := p.SetProxy(pp.Proxies.NextProxy()); err != nil {
+				pp.close()
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Close stops all processes in the pool.
+func (pp *ProcessPool) Close() error {
+	pp.mu.Lock()
+	defer pp.mu.Unlock()
+	return pp.close()
+}
+
+func (pp *ProcessPool) close() (err error) {
+	for _, p := range pp.processes {
+		if e := p.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	pp.processes = nil
+	return err
+}
+
+// Processes returns all open processes in the pool.
+func (pp *ProcessPool) Processes() []*Process {
+	pp.mu.Lock()
+	defer pp.mu.Unlock()
+	return append([]*Process{}, pp.processes...)
+}
+
+// Next returns the next process in round-robin order.
+// Returns nil if the pool is not open.
+func (pp *ProcessPool) Next() *Process {
+	pp.mu.Lock()
+	defer pp.mu.Unlock()
+	if len(pp.processes) == 0 {
+		return nil
+	}
+	p := pp.processes[pp.next%len(pp.processes)]
+	pp.next++
+	return p
+}
+
+// CreateWebPage returns a new web page on the next process in the pool.
+func (pp *ProcessPool) CreateWebPage() (*WebPage, error) {
+	p := pp.Next()
+	if p == nil {
+		return nil, ErrPoolNotOpen
+	}
+	return p.CreateWebPage()
+}
+
+// RotateProxies assigns the next proxy from Proxies to every process.
+func (pp *ProcessPool) RotateProxies() error {
+	if pp.Proxies == nil {
+		return nil
+	}
+	for _, p := range pp.Processes() {
+		if err := p.SetProxy(pp.Proxies.NextProxy()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package phantomjs
+
+import (
+	"strings"
+	"sync"
+)
+
+// ProxyConfig represents a proxy server used by a process.
+type ProxyConfig struct {
+	Host string
+	Port int
+
+	// Proxy type: "http" or "socks5". Defaults to "http".
+	Type string
+
+	// Credentials used to authenticate with the proxy, if required.
+	User string
+	Pass string
+}
+
+// SetProxy changes the proxy used by all pages in the process. The change
+// applies to subsequent requests. A config with a blank Host removes the proxy.
+// Returns ErrProxyInUse if the process' traffic is routed through Intercept or
+// throttled by WebPage.EmulateNetwork().
+func (p *Process) SetProxy(config ProxyConfig) error {
+	if p.Intercept != nil {
+		return ErrProxyInUse
+	}
+
+	p.proxyMu.Lock()
+	defer p.proxyMu.Unlock()
+
+	p.mu.Lock()
+	relay := p.relay
+	p.mu.Unlock()
+	if relay != nil {
+		return ErrProxyInUse
+	}
+
+	if err := p.setProxy(config); err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	p.proxy = config.Host != ""
+	p.mu.Unlock()
+	return nil
+}
+
+// hasProxy returns true if a proxy was set with SetProxy() or the process
+// options. The caller must hold p.mu.
+func (p *Process) hasProxy() bool {
+	if p.proxy {
+		return true
+	}
+	for _, opt := range p.Options {
+		if strings.HasPrefix(opt, "--proxy=") {
+			return true
+		}
+	}
+	return false
+}
+
+// setProxy sends the proxy config to the process.
+func (p *Process) setProxy(config ProxyConfig) error {
+	typ := config.Type
+	if typ == "" {
+		typ = "http"
+	}
+	req := map[string]interface{}{
+		"host": config.Host,
+		"port": config.Port,
+		"type": typ,
+		"user": config.User,
+		"pass": config.Pass,
+	}
+	return p.doJSON("POST", "/phantom/SetProxy", req, nil)
+}
+
+// ProxyRotator represents a strategy for assigning proxies to processes.
+// Implementations must be safe for concurrent use.
+type ProxyRotator interface {
+	NextProxy() ProxyConfig
+}
+
+// RoundRobinProxies is a ProxyRotator which returns each proxy in turn.
+type RoundRobinProxies struct {
+	mu      sync.Mutex
+	proxies []ProxyConfig
+	i       int
+}
+
+// NewRoundRobinProxies returns a new rotator over proxies.
+func NewRoundRobinProxies(proxies ...ProxyConfig) *RoundRobinProxies {
+	return &RoundRobinProxies{proxies: proxies}
+}
+
+// NextProxy returns the next proxy. Returns a blank config if there are no proxies.
+func (r *RoundRobinProxies) NextProxy() ProxyConfig {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.proxies) == 0 {
+		return ProxyConfig{}
+	}
+	config := r.proxies[r.i%len(r.proxies)]
+	r.i++
+	return config
+}
@@ -0,0 +1,116 @@
+package phantomjs_test
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/benbjohnson/phantomjs"
+)
+
+// Ensure process can change its proxy at runtime.
+func TestProcess_SetProxy(t *testing.T) {
+	proxy := NewProxyServer("PROXY0")
+	defer proxy.Close()
+
+	p := MustOpenNewProcess()
+	defer p.MustClose()
+	if err := p.SetProxy(proxy.Config()); err != nil {
+		t.Fatal(err)
+	}
+
+	page := p.MustCreateWebPage()
+	defer MustClosePage(page)
+	if err := page.Open("http://example.invalid/"); err != nil {
+		t.Fatal(err)
+	} else if title, err := page.Title(); err != nil {
+		t.Fatal(err)
+	} else if title != "PROXY0 example.invalid" {
+		t.Fatalf("unexpected title: %s", title)
+	}
+}
+
+// Ensure a proxy cannot replace the intercepting proxy of a process.
+func TestProcess_SetProxy_Intercept(t *testing.T) {
+	p := phantomjs.NewProcess()
+	p.Intercept = phantomjs.NewInterceptProxy()
+	if err := p.SetProxy(phantomjs.ProxyConfig{Host: "127.0.0.1", Port: 3128}); err != phantomjs.ErrProxyInUse {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+// Ensure a process pool assigns a different proxy to each process.
+func TestProcessPool_Proxies(t *testing.T) {
+	proxy0, proxy1 := NewProxyServer("PROXY0"), NewProxyServer("PROXY1")
+	defer proxy0.Close()
+	defer proxy1.Close()
+
+	pool := phantomjs.NewProcessPool(2)
+	pool.BasePort = MustFreePorts(2)
+	pool.Proxies = phantomjs.NewRoundRobinProxies(proxy0.Config(), proxy1.Config())
+	if err := pool.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+
+	// Reopening an open pool should not start more processes.
+	if err := pool.Open(); err != phantomjs.ErrPoolOpen {
+		t.Fatalf("unexpected error: %v", err)
+	} else if n := len(pool.Processes()); n != 2 {
+		t.Fatalf("unexpected process count: %d", n)
+	}
+
+	// Verify each page is routed through its process' proxy.
+	titles := func() (a []string) {
+		for i := 0; i < 2; i++ {
+			page, err := pool.CreateWebPage()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer MustClosePage(page)
+
+			if err := page.Open("http://example.invalid/"); err != nil {
+				t.Fatal(err)
+			}
+			title, err := page.Title()
+			if err != nil {
+				t.Fatal(err)
+			}
+			a = append(a, title)
+		}
+		return a
+	}
+	if a := titles(); a[0] != "PROXY0 example.invalid" || a[1] != "PROXY1 example.invalid" {
+		t.Fatalf("unexpected titles: %v", a)
+	}
+
+	// Rotate so each process uses the other proxy.
+	if err := pool.RotateProxies(); err != nil {
+		t.Fatal(err)
+	} else if a := titles(); a[0] != "PROXY1 example.invalid" || a[1] != "PROXY0 example.invalid" {
+		t.Fatalf("unexpected titles after rotation: %v", a)
+	}
+}
+
+// ProxyServer is a test HTTP forward proxy which answers every request itself.
+type ProxyServer struct {
+	*httptest.Server
+}
+
+// NewProxyServer returns a proxy which responds with a page titled with name
+// and the requested host.
+func NewProxyServer(name string) *ProxyServer {
+	return &ProxyServer{Server: httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `<html><head><title>%s %s</title></head></html>`, name, r.URL.Host)
+	}))}
+}
+
+// Config returns the proxy configuration for the server.
+func (s *ProxyServer) Config() phantomjs.ProxyConfig {
+	host, port, _ := net.SplitHostPort(s.Listener.Addr().String())
+	n, _ := strconv.Atoi(port)
+	return phantomjs.ProxyConfig{Host: host, Port: n}
+}
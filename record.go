@@ -0,0 +1,134 @@
+package phantomjs
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"image"
+	"image/color/palette"
+	"image/draw"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ErrInvalidFrameRate is returned when recording with a non-positive frame rate.
+var ErrInvalidFrameRate = errors.New("invalid frame rate")
+
+// Record renders the web page fps times per second for the given duration and
+// returns the captured frames in order.
+//
+// Frames are captured at a steady interval. If rendering a frame takes longer
+// than the interval then the following frame is captured immediately after.
+func (p *WebPage) Record(ctx context.Context, fps int, duration time.Duration) ([]image.Image, error) {
+	var frames []image.Image
+	if err := p.record(ctx, fps, duration, func(img image.Image) error {
+		frames = append(frames, img)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return frames, nil
+}
+
+// RecordGIF records the web page and encodes the frames to w as an animated
+// GIF. Each frame is converted to a paletted image and written to w as it is
+// captured so memory use does not grow with the duration. If recording fails
+// then the data already written to w is not a valid GIF.
+func (p *WebPage) RecordGIF(ctx context.Context, w io.Writer, fps int, duration time.Duration) error {
+	gw := &gifStreamWriter{w: w}
+	if err := p.record(ctx, fps, duration, func(img image.Image) error {
+		frame := image.NewPaletted(img.Bounds(), palette.Plan9)
+		draw.FloydSteinberg.Draw(frame, img.Bounds(), img, img.Bounds().Min)
+		return gw.writeFrame(frame, gifDelay(fps))
+	}); err != nil {
+		return err
+	}
+	return gw.close()
+}
+
+// gifDelay returns the delay between GIF frames, in hundredths of a second.
+// Viewers ignore a zero delay so frame rates above 100 use the minimum delay.
+func gifDelay(fps int) int {
+	if d := 100 / fps; d > 0 {
+		return d
+	}
+	return 1
+}
+
+// RecordPNGs records the web page and writes each frame to dir as a numbered
+// PNG file (e.g. "frame-00001.png") for use with an external encoder. Returns
+// the paths of the files written.
+func (p *WebPage) RecordPNGs(ctx context.Context, dir string, fps int, duration time.Duration) ([]string, error) {
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return nil, err
+	}
+
+	var paths []string
+	if err := p.record(ctx, fps, duration, func(img image.Image) error {
+		path := filepath.Join(dir, fmt.Sprintf("frame-%05d.png", len(paths)+1))
+		f, err := os.Create(path)
+		if err != nil {
+			return err
+		}
+
+		if err := png.Encode(f, img); err != nil {
+			f.Close()
+			return err
+		} else if err := f.Close(); err != nil {
+			return err
+		}
+		paths = append(paths, path)
+		return nil
+	}); err != nil {
+		return paths, err
+	}
+	return paths, nil
+}
+
+// record captures frames at a steady interval and passes each to fn.
+func (p *WebPage) record(ctx context.Context, fps int, duration time.Duration, fn func(image.Image) error) error {
+	if fps <= 0 {
+		return ErrInvalidFrameRate
+	}
+
+	n := int(duration.Seconds() * float64(fps))
+	if n < 1 {
+		n = 1
+	}
+
+	ticker := time.NewTicker(time.Second / time.Duration(fps))
+	defer ticker.Stop()
+
+	for i := 0; i < n; i++ {
+		// Wait for the next tick after the first frame.
+		if i == 0 {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+		} else {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-ticker.C:
+			}
+		}
+
+		data, err := p.RenderBase64("png")
+		if err != nil {
+			return err
+		}
+		img, err := png.Decode(base64.NewDecoder(base64.StdEncoding, bytes.NewReader([]byte(data))))
+		if err != nil {
+			return err
+		}
+		if err := fn(img); err != nil {
+			return err
+		}
+	}
+	return nil
+}
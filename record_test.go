@@ -0,0 +1,89 @@
+package phantomjs_test
+
+import (
+	"bytes"
+	"context"
+	"image/gif"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Ensure web page can be recorded as a sequence of frames.
+func TestWebPage_Record(t *testing.T) {
+	p := MustOpenNewProcess()
+	defer p.MustClose()
+
+	page := p.MustCreateWebPage()
+	defer MustClosePage(page)
+	if err := page.SetContent(`<html><body>FRAMES</body></html>`); err != nil {
+		t.Fatal(err)
+	} else if err := page.SetViewportSize(50, 40); err != nil {
+		t.Fatal(err)
+	}
+
+	// Ensure frames are returned as images.
+	t.Run("Images", func(t *testing.T) {
+		frames, err := page.Record(context.Background(), 10, 500*time.Millisecond)
+		if err != nil {
+			t.Fatal(err)
+		} else if len(frames) != 5 {
+			t.Fatalf("unexpected frame count: %d", len(frames))
+		} else if bounds := frames[0].Bounds(); bounds.Dx() != 50 || bounds.Dy() != 40 {
+			t.Fatalf("unexpected frame dimensions: %dx%d", bounds.Dx(), bounds.Dy())
+		}
+	})
+
+	// Ensure frames can be encoded as an animated GIF.
+	t.Run("GIF", func(t *testing.T) {
+		var buf bytes.Buffer
+		if err := page.RecordGIF(context.Background(), &buf, 10, 300*time.Millisecond); err != nil {
+			t.Fatal(err)
+		}
+		if g, err := gif.DecodeAll(&buf); err != nil {
+			t.Fatal(err)
+		} else if len(g.Image) != 3 {
+			t.Fatalf("unexpected frame count: %d", len(g.Image))
+		} else if g.Delay[0] != 10 {
+			t.Fatalf("unexpected delay: %d", g.Delay[0])
+		}
+	})
+
+	// Ensure high frame rates use the minimum GIF delay.
+	t.Run("GIFHighFrameRate", func(t *testing.T) {
+		var buf bytes.Buffer
+		if err := page.RecordGIF(context.Background(), &buf, 200, 10*time.Millisecond); err != nil {
+			t.Fatal(err)
+		}
+		if g, err := gif.DecodeAll(&buf); err != nil {
+			t.Fatal(err)
+		} else if g.Delay[0] != 1 {
+			t.Fatalf("unexpected delay: %d", g.Delay[0])
+		}
+	})
+
+	// Ensure no frames are rendered once the context is done.
+	t.Run("Canceled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		if _, err := page.Record(ctx, 10, time.Second); err != context.Canceled {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+
+	// Ensure frames can be written as numbered PNG files.
+	t.Run("PNGs", func(t *testing.T) {
+		dir := MustTempDir()
+		defer os.RemoveAll(dir)
+
+		paths, err := page.RecordPNGs(context.Background(), dir, 10, 200*time.Millisecond)
+		if err != nil {
+			t.Fatal(err)
+		} else if len(paths) != 2 {
+			t.Fatalf("unexpected file count: %d", len(paths))
+		} else if paths[1] != filepath.Join(dir, "frame-00002.png") {
+			t.Fatalf("unexpected path: %s", paths[1])
+		}
+	})
+}
@@ -0,0 +1,154 @@
+package phantomjs
+
+import (
+	"encoding/base64"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+)
+
+// DefaultRenderFormat is the image format used when none is specified.
+const DefaultRenderFormat = "png"
+
+// RenderOptions represents options used when rendering part of a web page.
+type RenderOptions struct {
+	// Image format passed to RenderBase64(). Defaults to "png".
+	Format string `json:"format,omitempty"`
+
+	// Additional space, in pixels, added around the rendered area.
+	Padding int `json:"padding,omitempty"`
+}
+
+// format returns the image format, or the default format if none is set.
+func (opt RenderOptions) format() string {
+	if opt.Format == "" {
+		return DefaultRenderFormat
+	}
+	return opt.Format
+}
+
+// ScreenshotElement renders the first element matching selector and returns
+// the encoded image.
+//
+// The element's bounding rectangle, including the current scroll offset and
+// padding, is used as the clipping rectangle while rendering. The previous
+// clipping rectangle is restored afterward. Returns ErrElementNotFound if the
+// selector does not match an element and ErrElementZeroSize if the element
+// has no width or height. The page is locked while rendering.
+func (p *WebPage) ScreenshotElement(selector string, opt RenderOptions) (buf []byte, err error) {
+	err = p.Do(func(page *WebPage) error {
+		buf, err = page.screenshotElement(selector, opt)
+		return err
+	})
+	return buf, err
+}
+
+// screenshotElement renders an element. The caller must hold the page lock.
+func (p *WebPage) screenshotElement(selector string, opt RenderOptions) (_ []byte, err error) {
+	rect, err := p.elementRect(selector)
+	if err != nil {
+		return nil, err
+	}
+
+	// Scale to the rendered size and expand by padding.
+	zoom, err := p.ZoomFactor()
+	if err != nil {
+		return nil, err
+	} else if zoom <= 0 {
+		zoom = 1
+	}
+	clip := scaleRect(rect, zoom, opt.Padding)
+
+	// Save the current clipping rectangle and restore it once rendered.
+	prev, err := p.ClipRect()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.SetClipRect(clip); err != nil {
+		return nil, err
+	}
+	defer func() {
+		if e := p.SetClipRect(prev); e != nil && err == nil {
+			err = e
+		}
+	}()
+
+	data, err := p.RenderBase64(opt.format())
+	if err != nil {
+		return nil, err
+	}
+	return base64.StdEncoding.DecodeString(data)
+}
+
+// elementRect returns the document position and size of the first element
+// matching selector, in CSS pixels.
+func (p *WebPage) elementRect(selector string) (elementRectJSON, error) {
+	var v *elementRectJSON
+	if err := p.evaluate(&v, `function(selector) {
+		var el = document.querySelector(selector);
+		if (!el) {
+			return null;
+		}
+		var r = el.getBoundingClientRect();
+		var x = window.pageXOffset || document.documentElement.scrollLeft || 0;
+		var y = window.pageYOffset || document.documentElement.scrollTop || 0;
+		return {top: r.top + y, left: r.left + x, width: r.width, height: r.height};
+	}`, selector); err != nil {
+		return elementRectJSON{}, err
+	} else if v == nil {
+		return elementRectJSON{}, ErrElementNotFound
+	} else if v.Width <= 0 || v.Height <= 0 {
+		return elementRectJSON{}, ErrElementZeroSize
+	}
+	return *v, nil
+}
+
+// elementRectJSON is a struct for decoding element bounding rects.
+// Values are floating point since layout can produce fractional pixels.
+type elementRectJSON struct {
+	Top    float64 `json:"top"`
+	Left   float64 `json:"left"`
+	Width  float64 `json:"width"`
+	Height float64 `json:"height"`
+}
+
+// scaleRect converts r to a pixel-aligned Rect scaled by zoom and expanded by
+// padding on every side. The result never extends above or left of the page.
+func scaleRect(r elementRectJSON, zoom float64, padding int) Rect {
+	top := int(math.Floor(r.Top*zoom)) - padding
+	left := int(math.Floor(r.Left*zoom)) - padding
+	bottom := int(math.Ceil((r.Top+r.Height)*zoom)) + padding
+	right := int(math.Ceil((r.Left+r.Width)*zoom)) + padding
+
+	if top < 0 {
+		top = 0
+	}
+	if left < 0 {
+		left = 0
+	}
+	return Rect{Top: top, Left: left, Width: right - left, Height: bottom - top}
+}
+
+// RenderBytes renders the web page with the given format and quality settings
+// and returns the contents of the rendered file. Unlike RenderBase64() this
+// supports every format supported by Render(), including "PDF".
+func (p *WebPage) RenderBytes(format string, quality int) ([]byte, error) {
+	// Render to a temporary file within the process path.
+	f, err := ioutil.TempFile(p.ref.process.Path(), "render-")
+	if err != nil {
+		return nil, err
+	} else if err := f.Close(); err != nil {
+		return nil, err
+	}
+	defer os.Remove(f.Name())
+
+	filename, err := filepath.Abs(f.Name())
+	if err != nil {
+		return nil, err
+	}
+	if err := p.Render(filename, format, quality); err != nil {
+		return nil, err
+	}
+	return ioutil.ReadFile(filename)
+}
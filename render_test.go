@@ -0,0 +1,91 @@
+package phantomjs_test
+
+import (
+	"bytes"
+	"image/color"
+	"image/png"
+	"reflect"
+	"testing"
+
+	"github.com/benbjohnson/phantomjs"
+)
+
+// Ensure web page can render a single element by selector.
+func TestWebPage_ScreenshotElement(t *testing.T) {
+	p := MustOpenNewProcess()
+	defer p.MustClose()
+
+	page := p.MustCreateWebPage()
+	defer MustClosePage(page)
+	if err := page.SetContent(`<html><body style="margin:0"><div style="height:300px"></div><div id="chart" style="width:40px;height:30px;background:red"></div><div id="empty"></div></body></html>`); err != nil {
+		t.Fatal(err)
+	}
+	if err := page.SetViewportSize(200, 100); err != nil {
+		t.Fatal(err)
+	}
+
+	// Ensure the element is clipped, including padding.
+	t.Run("OK", func(t *testing.T) {
+		buf, err := page.ScreenshotElement("#chart", phantomjs.RenderOptions{Padding: 5})
+		if err != nil {
+			t.Fatal(err)
+		}
+		img, err := png.Decode(bytes.NewReader(buf))
+		if err != nil {
+			t.Fatal(err)
+		} else if bounds := img.Bounds(); bounds.Dx() != 50 || bounds.Dy() != 40 {
+			t.Fatalf("unexpected image dimensions: %dx%d", bounds.Dx(), bounds.Dy())
+		}
+
+		// Clipping rectangle should be restored.
+		if v, err := page.ClipRect(); err != nil {
+			t.Fatal(err)
+		} else if !reflect.DeepEqual(v, phantomjs.Rect{}) {
+			t.Fatalf("unexpected clip rect: %#v", v)
+		}
+	})
+
+	// Ensure an error is returned when no element matches.
+	t.Run("ErrElementNotFound", func(t *testing.T) {
+		if _, err := page.ScreenshotElement("#missing", phantomjs.RenderOptions{}); err != phantomjs.ErrElementNotFound {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+
+	// Ensure an error is returned when the element has no size.
+	t.Run("ErrElementZeroSize", func(t *testing.T) {
+		if _, err := page.ScreenshotElement("#empty", phantomjs.RenderOptions{}); err != phantomjs.ErrElementZeroSize {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+}
+
+// Ensure web page can render a tall page in tiles.
+func TestWebPage_RenderFullPageTiled(t *testing.T) {
+	p := MustOpenNewProcess()
+	defer p.MustClose()
+
+	page := p.MustCreateWebPage()
+	defer MustClosePage(page)
+	if err := page.SetContent(`<html><body style="margin:0"><div style="width:100px;height:2900px;background:white"></div><div style="width:100px;height:100px;background:red"></div></body></html>`); err != nil {
+		t.Fatal(err)
+	}
+	if err := page.SetViewportSize(100, 100); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := page.RenderFullPageTiled(&buf, 700); err != nil {
+		t.Fatal(err)
+	}
+
+	// Verify dimensions and content of the last tile.
+	img, err := png.Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	} else if bounds := img.Bounds(); bounds.Dx() != 100 || bounds.Dy() != 3000 {
+		t.Fatalf("unexpected image dimensions: %dx%d", bounds.Dx(), bounds.Dy())
+	} else if c := color.NRGBAModel.Convert(img.At(50, 2950)).(color.NRGBA); c.R != 255 || c.G != 0 || c.B != 0 {
+		t.Fatalf("unexpected color: %#v", c)
+	}
+}
@@ -0,0 +1,202 @@
+package phantomjs
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"sync"
+)
+
+// ErrNoRecording is returned by a replayed process when a request does not
+// match any remaining recording.
+var ErrNoRecording = errors.New("no recording for request")
+
+// recording represents a single API call. Recordings are written as JSON
+// Lines so they can be reviewed and edited by hand.
+type recording struct {
+	Method   string          `json:"method"`
+	Path     string          `json:"path"`
+	Request  json.RawMessage `json:"request,omitempty"`
+	Status   int             `json:"status"`
+	Response json.RawMessage `json:"response"`
+
+	// True if the response was not JSON and is stored as a JSON string.
+	Text bool `json:"text,omitempty"`
+}
+
+// body returns the response body as it was received.
+func (r *recording) body() []byte {
+	if r.Text {
+		var s string
+		json.Unmarshal(r.Response, &s)
+		return []byte(s)
+	}
+	return r.Response
+}
+
+// String returns the method, path and request body of the recording.
+func (r *recording) String() string {
+	return fmt.Sprintf("%s %s %s", r.Method, r.Path, r.Request)
+}
+
+// Recorder writes each API call made by a process to a writer as JSON Lines.
+type Recorder struct {
+	mu  sync.Mutex
+	p   *Process
+	enc *json.Encoder
+	err error
+}
+
+// Recorder attaches a new recorder which writes subsequent API calls to w,
+// replacing any attached recorder. Recordings can be replayed with Replay().
+func (p *Process) Recorder(w io.Writer) *Recorder {
+	rec := &Recorder{p: p, enc: json.NewEncoder(w)}
+
+	p.recMu.Lock()
+	defer p.recMu.Unlock()
+	p.recorder = rec
+	return rec
+}
+
+// currentRecorder returns the attached recorder, if any.
+func (p *Process) currentRecorder() *Recorder {
+	p.recMu.Lock()
+	defer p.recMu.Unlock()
+	return p.recorder
+}
+
+// Stop detaches the recorder from its process and returns the first error
+// which occurred while writing.
+func (r *Recorder) Stop() error {
+	r.p.recMu.Lock()
+	if r.p.recorder == r {
+		r.p.recorder = nil
+	}
+	r.p.recMu.Unlock()
+	return r.Err()
+}
+
+// Err returns the first error which occurred while writing.
+func (r *Recorder) Err() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.err
+}
+
+// record writes a single API call.
+func (r *Recorder) record(method, path string, req []byte, status int, body []byte) {
+	entry := recording{Method: method, Path: path, Request: req, Status: status, Response: body}
+	if !json.Valid(body) {
+		entry.Response, _ = json.Marshal(string(body))
+		entry.Text = true
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err == nil {
+		r.err = r.enc.Encode(entry)
+	}
+}
+
+// Replay returns a process which serves API calls from recordings written by
+// a Recorder instead of running PhantomJS. The returned process must not be
+// opened.
+//
+// Each request is matched against the remaining recordings by method, path
+// and request body. Matched recordings are consumed so repeated requests are
+// served in the order they were recorded. A request without a matching
+// recording returns an error wrapping ErrNoRecording. Requests containing
+// values which change between runs, such as temporary file paths used by
+// RenderBytes(), cannot be replayed.
+func Replay(r io.Reader) (*Process, error) {
+	var entries []*recording
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 64*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var entry recording
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("invalid recording on line %d: %s", line, err)
+		}
+		entries = append(entries, &entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	p := NewProcess()
+	p.BaseURL = "http://replay"
+	p.client = &http.Client{Transport: &replayTransport{entries: entries}}
+	return p, nil
+}
+
+// replayTransport is an http.RoundTripper which serves recorded responses.
+type replayTransport struct {
+	mu      sync.Mutex
+	entries []*recording // remaining recordings
+}
+
+// RoundTrip returns the response of the first remaining matching recording.
+func (t *replayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		if body, err = ioutil.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+		req.Body.Close()
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for i, entry := range t.entries {
+		if entry.Method != req.Method || entry.Path != req.URL.Path || !jsonEqual(entry.Request, body) {
+			continue
+		}
+		t.entries = append(t.entries[:i:i], t.entries[i+1:]...)
+
+		return &http.Response{
+			StatusCode:    entry.Status,
+			Status:        http.StatusText(entry.Status),
+			Header:        http.Header{"Content-Type": []string{"application/json"}},
+			Body:          ioutil.NopCloser(bytes.NewReader(entry.body())),
+			ContentLength: int64(len(entry.body())),
+			Request:       req,
+		}, nil
+	}
+
+	// Report the closest recording to help diagnose the mismatch.
+	got := &recording{Method: req.Method, Path: req.URL.Path, Request: body}
+	if len(t.entries) == 0 {
+		return nil, fmt.Errorf("%w: %s (all recordings used)", ErrNoRecording, got)
+	}
+	next := t.entries[0]
+	for _, entry := range t.entries {
+		if entry.Path == req.URL.Path {
+			next = entry
+			break
+		}
+	}
+	return nil, fmt.Errorf("%w: %s (closest recording: %s)", ErrNoRecording, got, next)
+}
+
+// jsonEqual returns true if a and b are equivalent JSON values or both empty.
+func jsonEqual(a, b []byte) bool {
+	if len(a) == 0 || len(b) == 0 {
+		return len(a) == len(b)
+	}
+	var x, y interface{}
+	if json.Unmarshal(a, &x) != nil || json.Unmarshal(b, &y) != nil {
+		return bytes.Equal(a, b)
+	}
+	return reflect.DeepEqual(x, y)
+}
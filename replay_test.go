@@ -0,0 +1,94 @@
+package phantomjs_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/benbjohnson/phantomjs"
+)
+
+// Ensure API calls can be recorded and replayed without a running process.
+func TestReplay(t *testing.T) {
+	// Mock shim which serves a single page.
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var msg struct {
+			URL string `json:"url"`
+		}
+		json.NewDecoder(r.Body).Decode(&msg)
+
+		switch r.URL.Path {
+		case "/webpage/Create":
+			w.Write([]byte(`{"ref":{"id":"1"}}`))
+		case "/webpage/Open":
+			if msg.URL == "http://example.com/" {
+				w.Write([]byte(`{"status":"success"}`))
+			} else {
+				w.Write([]byte(`{"status":"fail"}`))
+			}
+		case "/webpage/Title":
+			w.Write([]byte(`{"value":"Example"}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	// Record a session against the mock shim.
+	var buf bytes.Buffer
+	p := phantomjs.NewProcess()
+	p.BaseURL = srv.URL
+	rec := p.Recorder(&buf)
+	if err := runReplaySession(p); err != nil {
+		t.Fatal(err)
+	} else if err := rec.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(buf.String(), "\n"); n != 4 {
+		t.Fatalf("unexpected recording count: %d\n%s", n, buf.String())
+	}
+
+	// Replay the session without the mock shim.
+	replay, err := phantomjs.Replay(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	} else if err := runReplaySession(replay); err != nil {
+		t.Fatal(err)
+	}
+
+	// Ensure unmatched requests return an error.
+	replay, err = phantomjs.Replay(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	page, err := replay.CreateWebPage()
+	if err != nil {
+		t.Fatal(err)
+	} else if err := page.Open("http://other.com/"); !errors.Is(err, phantomjs.ErrNoRecording) {
+		t.Fatalf("unexpected error: %v", err)
+	} else if !strings.Contains(err.Error(), `closest recording: POST /webpage/Open {"ref":"1","url":"http://example.com/"}`) {
+		t.Fatalf("unexpected error message: %s", err)
+	}
+}
+
+// runReplaySession creates a page, opens a URL, fails to open another URL and
+// reads the title.
+func runReplaySession(p *phantomjs.Process) error {
+	page, err := p.CreateWebPage()
+	if err != nil {
+		return err
+	} else if err := page.Open("http://example.com/"); err != nil {
+		return err
+	} else if err := page.Open("http://example.com/down"); err == nil {
+		return errors.New("expected open error")
+	} else if title, err := page.Title(); err != nil {
+		return err
+	} else if title != "Example" {
+		return errors.New("unexpected title: " + title)
+	}
+	return nil
+}
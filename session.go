@@ -0,0 +1,188 @@
+package phantomjs
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// Session represents a snapshot of a browser session which can be restored on
+// another web page, including a page in a different process. A session can be
+// serialized as JSON so it can be shared between workers.
+type Session struct {
+	// URL of the page when the session was saved.
+	URL string `json:"url"`
+
+	// Cookies in the process' cookie jar.
+	Cookies []*http.Cookie `json:"cookies,omitempty"`
+
+	// Local & session storage, by origin (e.g. "https://example.com"). The
+	// storage of the current document is read when the session is saved and
+	// the storage of other origins is captured as the page navigates away.
+	Storage map[string]*OriginStorage `json:"storage,omitempty"`
+
+	// Additional headers sent with each request.
+	CustomHeaders http.Header `json:"customHeaders,omitempty"`
+
+	// Viewport size, in pixels.
+	ViewportWidth  int `json:"viewportWidth"`
+	ViewportHeight int `json:"viewportHeight"`
+
+	// Web page settings, such as the user agent. Username & Password are
+	// never saved.
+	Settings WebPageSettings `json:"settings"`
+}
+
+// OriginStorage represents the web storage of a single origin.
+type OriginStorage struct {
+	Local   map[string]string `json:"local,omitempty"`
+	Session map[string]string `json:"session,omitempty"`
+}
+
+// SaveSession returns a snapshot of the web page's session.
+//
+// Storage is saved for each http(s) origin the page has visited. The storage
+// of the current origin is read when saved while the storage of previously
+// visited origins is as it was when the page navigated away. Documents which
+// do not allow storage, such as "about:blank", are saved without storage.
+// HTTP authentication credentials in the page settings are not saved.
+func (p *WebPage) SaveSession() (s *Session, err error) {
+	err = p.Do(func(page *WebPage) error {
+		s, err = page.saveSession()
+		return err
+	})
+	return s, err
+}
+
+// saveSession captures the session. The caller must hold the page lock.
+func (p *WebPage) saveSession() (*Session, error) {
+	var s Session
+	var err error
+
+	if s.URL, err = p.URL(); err != nil {
+		return nil, err
+	} else if s.Cookies, err = p.ref.process.Cookies(); err != nil {
+		return nil, err
+	} else if s.CustomHeaders, err = p.CustomHeaders(); err != nil {
+		return nil, err
+	} else if s.ViewportWidth, s.ViewportHeight, err = p.ViewportSize(); err != nil {
+		return nil, err
+	} else if s.Settings, err = p.Settings(); err != nil {
+		return nil, err
+	}
+	s.Settings.Username, s.Settings.Password = "", ""
+
+	// Capture storage of previously visited origins and the current origin.
+	var visited struct {
+		Value map[string]*OriginStorage `json:"value"`
+	}
+	if err := p.doJSON("POST", "/webpage/VisitedStorage", map[string]interface{}{"ref": p.ref.id}, &visited); err != nil {
+		return nil, err
+	}
+	s.Storage = visited.Value
+
+	var origin string
+	if err := p.evaluate(&origin, `function() { return window.location.protocol + '//' + window.location.host; }`); err != nil {
+		return nil, err
+	}
+	local, err := p.LocalStorage().All()
+	if errors.Is(err, ErrStorageUnavailable) {
+		return &s, nil
+	} else if err != nil {
+		return nil, err
+	}
+	session, err := p.SessionStorage().All()
+	if err != nil {
+		return nil, err
+	}
+	if s.Storage == nil {
+		s.Storage = make(map[string]*OriginStorage)
+	}
+	s.Storage[origin] = &OriginStorage{Local: local, Session: session}
+
+	return &s, nil
+}
+
+// RestoreSession applies a saved session to the web page and opens the
+// session's URL.
+//
+// Cookies are added to the page's process. Storage is restored by loading an
+// empty document for each of the session's origins so no request is made to
+// them.
+// Expired cookies are ignored. The page's HTTP authentication credentials
+// are kept.
+func (p *WebPage) RestoreSession(s *Session) error {
+	return p.Do(func(page *WebPage) error {
+		return page.restoreSession(s)
+	})
+}
+
+// restoreSession applies a session. The caller must hold the page lock.
+func (p *WebPage) restoreSession(s *Session) error {
+	// Keep the page's own credentials as sessions do not include them.
+	current, err := p.Settings()
+	if err != nil {
+		return err
+	}
+	settings := s.Settings
+	settings.Username, settings.Password = current.Username, current.Password
+	if err := p.SetSettings(settings); err != nil {
+		return err
+	}
+	if s.ViewportWidth > 0 && s.ViewportHeight > 0 {
+		if err := p.SetViewportSize(s.ViewportWidth, s.ViewportHeight); err != nil {
+			return err
+		}
+	}
+	if err := p.SetCustomHeaders(s.CustomHeaders); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, c := range s.Cookies {
+		if !c.Expires.IsZero() && !c.Expires.After(now) {
+			continue
+		}
+		if _, err := p.ref.process.AddCookie(c); err != nil {
+			return err
+		}
+	}
+
+	origins := make([]string, 0, len(s.Storage))
+	for origin := range s.Storage {
+		origins = append(origins, origin)
+	}
+	sort.Strings(origins)
+	for _, origin := range origins {
+		if err := p.restoreStorage(origin, s.Storage[origin]); err != nil {
+			return err
+		}
+	}
+
+	if s.URL == "" || s.URL == "about:blank" {
+		return nil
+	}
+	return p.Open(s.URL)
+}
+
+// restoreStorage sets the storage of an origin. The caller must hold the page
+// lock.
+func (p *WebPage) restoreStorage(origin string, storage *OriginStorage) error {
+	if storage == nil {
+		return nil
+	} else if err := p.SetContentAndURL("<html></html>", origin+"/"); err != nil {
+		return err
+	}
+	for key, value := range storage.Local {
+		if err := p.LocalStorage().Set(key, value); err != nil {
+			return err
+		}
+	}
+	for key, value := range storage.Session {
+		if err := p.SessionStorage().Set(key, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,159 @@
+package phantomjs_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/benbjohnson/phantomjs"
+)
+
+// Ensure a session can be saved on one process and restored on another.
+func TestWebPage_SaveSession(t *testing.T) {
+	// Mock external HTTP server which reports the session state.
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/login" {
+			http.SetCookie(w, &http.Cookie{Name: "SESSION", Value: "ABC", Path: "/"})
+		}
+		w.Write([]byte(`<html><body></body></html>`))
+	}))
+	defer srv.Close()
+
+	// Log in on the first process.
+	p0 := MustOpenNewProcess()
+	defer p0.MustClose()
+
+	page0 := p0.MustCreateWebPage()
+	defer MustClosePage(page0)
+	if err := page0.Open(srv.URL + "/login"); err != nil {
+		t.Fatal(err)
+	} else if err := page0.LocalStorage().Set("token", "XYZ"); err != nil {
+		t.Fatal(err)
+	} else if err := page0.SetViewportSize(300, 200); err != nil {
+		t.Fatal(err)
+	} else if err := page0.SetSettings(phantomjs.WebPageSettings{JavascriptEnabled: true, Username: "user", Password: "secret"}); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := page0.SaveSession()
+	if err != nil {
+		t.Fatal(err)
+	} else if s.Settings.Username != "" || s.Settings.Password != "" {
+		t.Fatalf("unexpected credentials: %q %q", s.Settings.Username, s.Settings.Password)
+	} else if st := s.Storage[srv.URL]; st == nil || st.Local["token"] != "XYZ" {
+		t.Fatalf("unexpected storage: %#v", s.Storage)
+	}
+
+	// Serialize the session between processes.
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(s); err != nil {
+		t.Fatal(err)
+	} else if err := json.NewDecoder(&buf).Decode(&s); err != nil {
+		t.Fatal(err)
+	}
+
+	// Restore on a second process.
+	p1 := NewProcess()
+	p1.Port = MustFreePort()
+	if err := p1.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer p1.MustClose()
+
+	page1 := p1.MustCreateWebPage()
+	defer MustClosePage(page1)
+	if err := page1.RestoreSession(s); err != nil {
+		t.Fatal(err)
+	}
+
+	// Verify restored state.
+	if u, err := page1.URL(); err != nil {
+		t.Fatal(err)
+	} else if u != srv.URL+"/login" {
+		t.Fatalf("unexpected url: %s", u)
+	}
+	if v, err := page1.Evaluate(`function() { return document.cookie; }`); err != nil {
+		t.Fatal(err)
+	} else if v != "SESSION=ABC" {
+		t.Fatalf("unexpected cookie: %#v", v)
+	}
+	if v, _, err := page1.LocalStorage().Get("token"); err != nil {
+		t.Fatal(err)
+	} else if v != "XYZ" {
+		t.Fatalf("unexpected token: %q", v)
+	}
+	if w, h, err := page1.ViewportSize(); err != nil {
+		t.Fatal(err)
+	} else if w != 300 || h != 200 {
+		t.Fatalf("unexpected viewport: %dx%d", w, h)
+	}
+}
+
+// Ensure storage is saved and restored for each origin visited by the page.
+func TestWebPage_SaveSession_Origins(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<html><body></body></html>`))
+	})
+	srv0, srv1 := httptest.NewServer(handler), httptest.NewServer(handler)
+	defer srv0.Close()
+	defer srv1.Close()
+
+	p0 := MustOpenNewProcess()
+	defer p0.MustClose()
+
+	// Set storage on the first origin and then navigate to the second.
+	page0 := p0.MustCreateWebPage()
+	defer MustClosePage(page0)
+	if err := page0.Open(srv0.URL); err != nil {
+		t.Fatal(err)
+	} else if err := page0.LocalStorage().Set("a", "1"); err != nil {
+		t.Fatal(err)
+	} else if err := page0.SessionStorage().Set("tab", "A"); err != nil {
+		t.Fatal(err)
+	} else if err := page0.Open(srv1.URL); err != nil {
+		t.Fatal(err)
+	} else if err := page0.LocalStorage().Set("b", "2"); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := page0.SaveSession()
+	if err != nil {
+		t.Fatal(err)
+	} else if st := s.Storage[srv0.URL]; st == nil || st.Local["a"] != "1" || st.Session["tab"] != "A" {
+		t.Fatalf("unexpected storage for first origin: %#v", st)
+	} else if st := s.Storage[srv1.URL]; st == nil || st.Local["b"] != "2" {
+		t.Fatalf("unexpected storage for second origin: %#v", st)
+	}
+
+	// Restore on a second process and verify both origins.
+	p1 := NewProcess()
+	p1.Port = MustFreePort()
+	if err := p1.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer p1.MustClose()
+
+	page1 := p1.MustCreateWebPage()
+	defer MustClosePage(page1)
+	if err := page1.RestoreSession(s); err != nil {
+		t.Fatal(err)
+	} else if v, _, err := page1.LocalStorage().Get("b"); err != nil {
+		t.Fatal(err)
+	} else if v != "2" {
+		t.Fatalf("unexpected value: %q", v)
+	}
+
+	if err := page1.Open(srv0.URL); err != nil {
+		t.Fatal(err)
+	} else if v, _, err := page1.LocalStorage().Get("a"); err != nil {
+		t.Fatal(err)
+	} else if v != "1" {
+		t.Fatalf("unexpected value: %q", v)
+	} else if v, _, err := page1.SessionStorage().Get("tab"); err != nil {
+		t.Fatal(err)
+	} else if v != "A" {
+		t.Fatalf("unexpected session value: %q", v)
+	}
+}
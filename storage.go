@@ -0,0 +1,135 @@
+package phantomjs
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrStorageUnavailable is returned when web storage cannot be accessed by the
+// current document, such as on "about:blank".
+var ErrStorageUnavailable = errors.New("storage unavailable")
+
+// Storage represents the web storage of the current document's origin.
+// Operations apply to the current frame of the web page.
+type Storage struct {
+	page *WebPage
+	name string // "localStorage" or "sessionStorage"
+}
+
+// LocalStorage returns the persistent storage of the current origin.
+func (p *WebPage) LocalStorage() *Storage {
+	return &Storage{page: p, name: "localStorage"}
+}
+
+// SessionStorage returns the session storage of the current origin.
+func (p *WebPage) SessionStorage() *Storage {
+	return &Storage{page: p, name: "sessionStorage"}
+}
+
+// Get returns the value for key. Returns false if the key does not exist.
+func (s *Storage) Get(key string) (string, bool, error) {
+	var resp storageResultJSON
+	if err := s.do(&resp, "get", key, ""); err != nil {
+		return "", false, err
+	} else if resp.Value == nil {
+		return "", false, nil
+	}
+	return *resp.Value, true, nil
+}
+
+// Set sets the value for key.
+func (s *Storage) Set(key, value string) error {
+	return s.do(nil, "set", key, value)
+}
+
+// Remove deletes key from storage.
+func (s *Storage) Remove(key string) error {
+	return s.do(nil, "remove", key, "")
+}
+
+// Clear deletes all keys from storage.
+func (s *Storage) Clear() error {
+	return s.do(nil, "clear", "", "")
+}
+
+// Keys returns all keys in storage.
+func (s *Storage) Keys() ([]string, error) {
+	var resp storageResultJSON
+	if err := s.do(&resp, "keys", "", ""); err != nil {
+		return nil, err
+	}
+	return resp.Keys, nil
+}
+
+// All returns all keys & values in storage.
+func (s *Storage) All() (map[string]string, error) {
+	var resp storageResultJSON
+	if err := s.do(&resp, "all", "", ""); err != nil {
+		return nil, err
+	}
+	if resp.Items == nil {
+		resp.Items = make(map[string]string)
+	}
+	return resp.Items, nil
+}
+
+// do executes a storage operation within the page and decodes the result.
+func (s *Storage) do(v *storageResultJSON, op, key, value string) error {
+	var resp storageResultJSON
+	if err := s.page.evaluate(&resp, `function(name, op, key, value) {
+		var protocol = window.location.protocol;
+		if (protocol !== 'http:' && protocol !== 'https:' && protocol !== 'file:') {
+			return {unavailable: window.location.href};
+		}
+
+		var storage;
+		try {
+			storage = window[name];
+		} catch(e) {
+			return {unavailable: window.location.href};
+		}
+		if (!storage) {
+			return {unavailable: window.location.href};
+		}
+
+		try {
+			switch (op) {
+				case 'get': return {value: storage.getItem(key)};
+				case 'set': storage.setItem(key, value); return {};
+				case 'remove': storage.removeItem(key); return {};
+				case 'clear': storage.clear(); return {};
+			}
+
+			var keys = [], items = {};
+			for (var i = 0; i < storage.length; i++) {
+				keys.push(storage.key(i));
+				items[storage.key(i)] = storage.getItem(storage.key(i));
+			}
+			return op === 'keys' ? {keys: keys} : {items: items};
+		} catch(e) {
+			return {error: e.message};
+		}
+	}`, s.name, op, key, value); err != nil {
+		return err
+	}
+
+	if resp.Unavailable != "" {
+		return fmt.Errorf("%w: %s at %s", ErrStorageUnavailable, s.name, resp.Unavailable)
+	} else if resp.Error != "" {
+		return errors.New(resp.Error)
+	}
+
+	if v != nil {
+		*v = resp
+	}
+	return nil
+}
+
+// storageResultJSON is a struct for decoding the result of a storage operation.
+type storageResultJSON struct {
+	Unavailable string            `json:"unavailable"`
+	Error       string            `json:"error"`
+	Value       *string           `json:"value"`
+	Keys        []string          `json:"keys"`
+	Items       map[string]string `json:"items"`
+}
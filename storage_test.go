@@ -0,0 +1,91 @@
+package phantomjs_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/benbjohnson/phantomjs"
+)
+
+// Ensure web page can read and write local & session storage.
+func TestWebPage_Storage(t *testing.T) {
+	// Mock external HTTP server.
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<html><body></body></html>`))
+	}))
+	defer srv.Close()
+
+	p := MustOpenNewProcess()
+	defer p.MustClose()
+
+	page := p.MustCreateWebPage()
+	defer MustClosePage(page)
+	if err := page.Open(srv.URL); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, storage := range []*phantomjs.Storage{page.LocalStorage(), page.SessionStorage()} {
+		if err := storage.Set("token", "ABC"); err != nil {
+			t.Fatal(err)
+		} else if err := storage.Set("flag", "1"); err != nil {
+			t.Fatal(err)
+		}
+
+		// Retrieve individual keys.
+		if v, ok, err := storage.Get("token"); err != nil {
+			t.Fatal(err)
+		} else if !ok || v != "ABC" {
+			t.Fatalf("unexpected value: %q (%v)", v, ok)
+		}
+		if _, ok, err := storage.Get("missing"); err != nil {
+			t.Fatal(err)
+		} else if ok {
+			t.Fatal("expected missing key")
+		}
+
+		// Retrieve keys & values.
+		if keys, err := storage.Keys(); err != nil {
+			t.Fatal(err)
+		} else if sort.Strings(keys); !reflect.DeepEqual(keys, []string{"flag", "token"}) {
+			t.Fatalf("unexpected keys: %#v", keys)
+		}
+		if m, err := storage.All(); err != nil {
+			t.Fatal(err)
+		} else if !reflect.DeepEqual(m, map[string]string{"flag": "1", "token": "ABC"}) {
+			t.Fatalf("unexpected items: %#v", m)
+		}
+
+		// Remove a key and then clear.
+		if err := storage.Remove("flag"); err != nil {
+			t.Fatal(err)
+		} else if m, err := storage.All(); err != nil {
+			t.Fatal(err)
+		} else if !reflect.DeepEqual(m, map[string]string{"token": "ABC"}) {
+			t.Fatalf("unexpected items: %#v", m)
+		}
+		if err := storage.Clear(); err != nil {
+			t.Fatal(err)
+		} else if m, err := storage.All(); err != nil {
+			t.Fatal(err)
+		} else if len(m) != 0 {
+			t.Fatalf("unexpected items: %#v", m)
+		}
+	}
+}
+
+// Ensure storage returns an error when the origin does not allow storage.
+func TestWebPage_Storage_ErrStorageUnavailable(t *testing.T) {
+	p := MustOpenNewProcess()
+	defer p.MustClose()
+
+	page := p.MustCreateWebPage()
+	defer MustClosePage(page)
+
+	if _, _, err := page.LocalStorage().Get("token"); !errors.Is(err, phantomjs.ErrStorageUnavailable) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,211 @@
+package phantomjs
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Table represents the contents of an HTML table.
+type Table struct {
+	// Column names. When a table has several header rows, the distinct
+	// values in each column are joined by a space.
+	Headers []string
+
+	// Cell text of each body row. Every row has one value per column.
+	Rows [][]string
+}
+
+// Records returns each row as a map of header to cell text.
+// Columns without a header are keyed by their cell index (e.g. "2").
+func (t *Table) Records() []map[string]string {
+	a := make([]map[string]string, len(t.Rows))
+	for i, row := range t.Rows {
+		m := make(map[string]string, len(row))
+		for j, value := range row {
+			m[t.header(j)] = value
+		}
+		a[i] = m
+	}
+	return a
+}
+
+// header returns the name of column i.
+func (t *Table) header(i int) string {
+	if i < len(t.Headers) && t.Headers[i] != "" {
+		return t.Headers[i]
+	}
+	return strconv.Itoa(i)
+}
+
+// WriteCSV writes the headers, if any, and rows to w as CSV.
+func (t *Table) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	if len(t.Headers) > 0 {
+		if err := cw.Write(t.Headers); err != nil {
+			return err
+		}
+	}
+	if err := cw.WriteAll(t.Rows); err != nil {
+		return err
+	}
+	return cw.Error()
+}
+
+// ExtractTables returns the contents of all tables matching selector in the
+// current frame. Use SwitchToFrameName() or InFrame() to extract tables from
+// a child frame.
+//
+// Cells spanning several columns or rows via colspan and rowspan have their
+// text repeated in each position they cover. Rows within <thead> are used as
+// headers. Tables without a <thead> use their leading rows consisting only of
+// <th> cells as headers.
+func (p *WebPage) ExtractTables(selector string) ([]Table, error) {
+	var a []tableJSON
+	if err := p.evaluate(&a, `function(selector) {
+		var tables = document.querySelectorAll(selector), a = [];
+		for (var i = 0; i < tables.length; i++) {
+			if (tables[i].tagName !== 'TABLE') continue;
+			var rows = tables[i].rows, t = [];
+			for (var j = 0; j < rows.length; j++) {
+				var row = {head: rows[j].parentNode.tagName === 'THEAD', cells: []};
+				for (var k = 0; k < rows[j].cells.length; k++) {
+					var cell = rows[j].cells[k];
+					row.cells.push({
+						text: (cell.textContent || '').replace(/\s+/g, ' ').trim(),
+						th: cell.tagName === 'TH',
+						colspan: cell.colSpan || 1,
+						rowspan: cell.rowSpan || 1
+					});
+				}
+				t.push(row);
+			}
+			a.push(t);
+		}
+		return a;
+	}`, selector); err != nil {
+		return nil, err
+	}
+
+	tables := make([]Table, len(a))
+	for i := range a {
+		tables[i] = a[i].table()
+	}
+	return tables, nil
+}
+
+// tableJSON is the raw row & cell structure of a table.
+type tableJSON []struct {
+	Head  bool `json:"head"`
+	Cells []struct {
+		Text    string `json:"text"`
+		TH      bool   `json:"th"`
+		Colspan int    `json:"colspan"`
+		Rowspan int    `json:"rowspan"`
+	} `json:"cells"`
+}
+
+// tableSpan tracks a cell which spans into the rows below it.
+type tableSpan struct {
+	text string
+	n    int // remaining rows
+}
+
+// table expands spanned cells into a grid and separates header rows.
+func (t tableJSON) table() Table {
+	// Lay cells out on a grid, tracking cells which span into later rows.
+	grid := make([][]string, len(t))
+	var spans []tableSpan
+	width := 0
+	for i, row := range t {
+		var cells []string
+
+		// fill adds cells spanned from previous rows until it reaches a free
+		// column or column end.
+		fill := func(end int) {
+			for len(cells) < end && spans[len(cells)].n > 0 {
+				spans[len(cells)].n--
+				cells = append(cells, spans[len(cells)].text)
+			}
+		}
+
+		for _, cell := range row.Cells {
+			fill(len(spans))
+			colspan, rowspan := cell.Colspan, cell.Rowspan
+			if colspan < 1 {
+				colspan = 1
+			}
+			if rowspan < 1 {
+				rowspan = 1
+			}
+			for k := 0; k < colspan; k++ {
+				col := len(cells)
+				if col == len(spans) {
+					spans = append(spans, tableSpan{})
+				}
+				spans[col] = tableSpan{text: cell.Text, n: rowspan - 1}
+				cells = append(cells, cell.Text)
+			}
+		}
+
+		// Add remaining spanned cells, leaving gaps empty.
+		last := 0
+		for col := range spans {
+			if spans[col].n > 0 {
+				last = col + 1
+			}
+		}
+		for len(cells) < last {
+			if spans[len(cells)].n > 0 {
+				fill(last)
+			} else {
+				cells = append(cells, "")
+			}
+		}
+
+		grid[i] = cells
+		if len(cells) > width {
+			width = len(cells)
+		}
+	}
+
+	// Pad rows to the full width.
+	for i := range grid {
+		for len(grid[i]) < width {
+			grid[i] = append(grid[i], "")
+		}
+	}
+
+	// Determine header rows.
+	n := 0
+	for n < len(t) && t[n].Head {
+		n++
+	}
+	if n == 0 {
+	rows:
+		for ; n < len(t) && len(t[n].Cells) > 0; n++ {
+			for _, cell := range t[n].Cells {
+				if !cell.TH {
+					break rows
+				}
+			}
+		}
+	}
+
+	var tbl Table
+	if n > 0 {
+		tbl.Headers = make([]string, width)
+		for j := 0; j < width; j++ {
+			var parts []string
+			for i := 0; i < n; i++ {
+				if s := grid[i][j]; s != "" && (len(parts) == 0 || parts[len(parts)-1] != s) {
+					parts = append(parts, s)
+				}
+			}
+			tbl.Headers[j] = strings.Join(parts, " ")
+		}
+	}
+	tbl.Rows = grid[n:]
+	return tbl
+}
@@ -0,0 +1,98 @@
+package phantomjs_test
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/benbjohnson/phantomjs"
+)
+
+// Ensure web page can extract tables with spanned cells, including tables
+// within a child frame.
+func TestWebPage_ExtractTables(t *testing.T) {
+	// Mock external HTTP server with a table in the main page and a frame.
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/frame":
+			w.Write([]byte(`<html><body><table id="inner"><tr><th>X</th></tr><tr><td>1</td></tr></table></body></html>`))
+		default:
+			w.Write([]byte(`<html><body>
+				<table id="sales">
+					<thead>
+						<tr><th rowspan="2">Name</th><th colspan="2">Q1</th></tr>
+						<tr><th>Rev</th><th>Cost</th></tr>
+					</thead>
+					<tbody>
+						<tr><td rowspan="2">A</td><td>1</td><td>2</td></tr>
+						<tr><td>3</td><td>4</td></tr>
+						<tr><td>B</td><td colspan="2">n/a</td></tr>
+					</tbody>
+				</table>
+				<iframe name="data" src="/frame"></iframe>
+			</body></html>`))
+		}
+	}))
+	defer srv.Close()
+
+	p := MustOpenNewProcess()
+	defer p.MustClose()
+
+	page := p.MustCreateWebPage()
+	defer MustClosePage(page)
+	if err := page.Open(srv.URL); err != nil {
+		t.Fatal(err)
+	}
+
+	tables, err := page.ExtractTables("table")
+	if err != nil {
+		t.Fatal(err)
+	} else if len(tables) != 1 {
+		t.Fatalf("unexpected table count: %d", len(tables))
+	} else if exp := []string{"Name", "Q1 Rev", "Q1 Cost"}; !reflect.DeepEqual(tables[0].Headers, exp) {
+		t.Fatalf("unexpected headers: %q", tables[0].Headers)
+	} else if exp := [][]string{{"A", "1", "2"}, {"A", "3", "4"}, {"B", "n/a", "n/a"}}; !reflect.DeepEqual(tables[0].Rows, exp) {
+		t.Fatalf("unexpected rows: %q", tables[0].Rows)
+	}
+
+	// Extract from the child frame.
+	if err := page.InFrame("data", func(page *phantomjs.WebPage) error {
+		tables, err := page.ExtractTables("#inner")
+		if err != nil {
+			return err
+		} else if len(tables) != 1 || !reflect.DeepEqual(tables[0].Headers, []string{"X"}) || !reflect.DeepEqual(tables[0].Rows, [][]string{{"1"}}) {
+			t.Fatalf("unexpected frame tables: %#v", tables)
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Ensure a table can be written as CSV.
+func TestTable_WriteCSV(t *testing.T) {
+	tbl := phantomjs.Table{
+		Headers: []string{"Name", "Note"},
+		Rows:    [][]string{{"A", "x, y"}, {"B", ""}},
+	}
+
+	var buf bytes.Buffer
+	if err := tbl.WriteCSV(&buf); err != nil {
+		t.Fatal(err)
+	} else if buf.String() != "Name,Note\nA,\"x, y\"\nB,\n" {
+		t.Fatalf("unexpected csv: %q", buf.String())
+	}
+}
+
+// Ensure table rows can be returned as records keyed by header.
+func TestTable_Records(t *testing.T) {
+	tbl := phantomjs.Table{
+		Headers: []string{"Name", ""},
+		Rows:    [][]string{{"A", "1"}},
+	}
+	if a := tbl.Records(); !reflect.DeepEqual(a, []map[string]string{{"Name": "A", "1": "1"}}) {
+		t.Fatalf("unexpected records: %#v", a)
+	}
+}
@@ -0,0 +1,237 @@
+package phantomjs
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/base64"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"math"
+)
+
+// DefaultTileHeight is the tile height, in pixels, used by
+// RenderFullPageTiled() when none is specified.
+const DefaultTileHeight = 4096
+
+// RenderFullPageTiled renders the entire document as a PNG image to w.
+//
+// Very tall pages can exhaust memory when rendered in a single call so the
+// document is rendered in tiles of tileHeight pixels by moving the clipping
+// rectangle down the page. Each tile is encoded to w before the next tile is
+// rendered so only a single tile is held in memory at a time. The previous
+// clipping rectangle is restored afterward. The page is locked while rendering.
+// Returns ErrDocumentZeroSize if the document has no width or height.
+func (p *WebPage) RenderFullPageTiled(w io.Writer, tileHeight int) error {
+	return p.Do(func(page *WebPage) error {
+		return page.renderFullPageTiled(w, tileHeight)
+	})
+}
+
+// renderFullPageTiled renders the document in tiles. The caller must hold
+// the page lock.
+func (p *WebPage) renderFullPageTiled(w io.Writer, tileHeight int) (err error) {
+	if tileHeight <= 0 {
+		tileHeight = DefaultTileHeight
+	}
+
+	// Determine rendered size of the document.
+	var size struct {
+		Width  float64 `json:"width"`
+		Height float64 `json:"height"`
+	}
+	if err := p.evaluate(&size, `function() {
+		var body = document.body || {}, root = document.documentElement || {};
+		return {
+			width: Math.max(body.scrollWidth || 0, root.scrollWidth || 0),
+			height: Math.max(body.scrollHeight || 0, root.scrollHeight || 0)
+		};
+	}`); err != nil {
+		return err
+	}
+	zoom, err := p.ZoomFactor()
+	if err != nil {
+		return err
+	} else if zoom <= 0 {
+		zoom = 1
+	}
+	width, height := int(math.Ceil(size.Width*zoom)), int(math.Ceil(size.Height*zoom))
+	if width <= 0 || height <= 0 {
+		return ErrDocumentZeroSize
+	}
+
+	// Save the current clipping rectangle and restore it once rendered.
+	prev, err := p.ClipRect()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if e := p.SetClipRect(prev); e != nil && err == nil {
+			err = e
+		}
+	}()
+
+	enc, err := newPNGStreamEncoder(w, width, height)
+	if err != nil {
+		return err
+	}
+	for top := 0; top < height; top += tileHeight {
+		h := tileHeight
+		if top+h > height {
+			h = height - top
+		}
+
+		if err := p.SetClipRect(Rect{Top: top, Left: 0, Width: width, Height: h}); err != nil {
+			return err
+		}
+		data, err := p.RenderBase64("png")
+		if err != nil {
+			return err
+		}
+		tile, err := png.Decode(base64.NewDecoder(base64.StdEncoding, bytes.NewReader([]byte(data))))
+		if err != nil {
+			return err
+		}
+		if err := enc.writeRows(tile, h); err != nil {
+			return err
+		}
+	}
+	return enc.close()
+}
+
+// pngStreamEncoder encodes an RGBA PNG image incrementally, row by row, so
+// that the entire image does not need to be held in memory.
+type pngStreamEncoder struct {
+	w      io.Writer
+	width  int
+	height int
+	rows   int // rows written
+
+	idat *bufio.Writer // buffers IDAT chunks
+	zw   *zlib.Writer
+	cur  []byte // current filtered row
+}
+
+// newPNGStreamEncoder writes the PNG header for an image of the given size.
+func newPNGStreamEncoder(w io.Writer, width, height int) (*pngStreamEncoder, error) {
+	if _, err := io.WriteString(w, "\x89PNG\r\n\x1a\n"); err != nil {
+		return nil, err
+	}
+
+	// Write header: 8-bit depth, RGBA color type, no interlacing.
+	hdr := make([]byte, 13)
+	binary.BigEndian.PutUint32(hdr[0:4], uint32(width))
+	binary.BigEndian.PutUint32(hdr[4:8], uint32(height))
+	hdr[8], hdr[9] = 8, 6
+	if err := writePNGChunk(w, "IHDR", hdr); err != nil {
+		return nil, err
+	}
+
+	enc := &pngStreamEncoder{
+		w:      w,
+		width:  width,
+		height: height,
+		cur:    make([]byte, 1+4*width),
+	}
+	enc.idat = bufio.NewWriterSize(pngChunkWriter{w: w, typ: "IDAT"}, 1<<16)
+	enc.zw = zlib.NewWriter(enc.idat)
+	return enc, nil
+}
+
+// writeRows writes n rows from img. Rows beyond the bounds of img are written
+// as transparent pixels and rows beyond the image height are ignored.
+func (enc *pngStreamEncoder) writeRows(img image.Image, n int) error {
+	b := img.Bounds()
+	for y := 0; y < n && enc.rows < enc.height; y++ {
+		row := enc.cur[1:]
+		for i := range row {
+			row[i] = 0
+		}
+
+		if y < b.Dy() {
+			if src, ok := img.(*image.NRGBA); ok {
+				off := src.PixOffset(b.Min.X, b.Min.Y+y)
+				copy(row, src.Pix[off:off+4*minInt(b.Dx(), enc.width)])
+			} else {
+				for x := 0; x < b.Dx() && x < enc.width; x++ {
+					c := color.NRGBAModel.Convert(img.At(b.Min.X+x, b.Min.Y+y)).(color.NRGBA)
+					row[4*x], row[4*x+1], row[4*x+2], row[4*x+3] = c.R, c.G, c.B, c.A
+				}
+			}
+		}
+
+		// Apply the "sub" filter in place, from right to left.
+		enc.cur[0] = 1
+		for i := len(row) - 1; i >= 4; i-- {
+			row[i] -= row[i-4]
+		}
+
+		if _, err := enc.zw.Write(enc.cur); err != nil {
+			return err
+		}
+		enc.rows++
+	}
+	return nil
+}
+
+// close pads any missing rows and writes the PNG trailer.
+func (enc *pngStreamEncoder) close() error {
+	if enc.rows < enc.height {
+		if err := enc.writeRows(image.NewNRGBA(image.Rect(0, 0, 0, 0)), enc.height-enc.rows); err != nil {
+			return err
+		}
+	}
+
+	if err := enc.zw.Close(); err != nil {
+		return err
+	} else if err := enc.idat.Flush(); err != nil {
+		return err
+	}
+	return writePNGChunk(enc.w, "IEND", nil)
+}
+
+// pngChunkWriter writes each call to Write as a separate PNG chunk.
+type pngChunkWriter struct {
+	w   io.Writer
+	typ string
+}
+
+func (w pngChunkWriter) Write(p []byte) (int, error) {
+	if err := writePNGChunk(w.w, w.typ, p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// writePNGChunk writes a length-prefixed, checksummed PNG chunk to w.
+func writePNGChunk(w io.Writer, typ string, data []byte) error {
+	var hdr [8]byte
+	binary.BigEndian.PutUint32(hdr[:4], uint32(len(data)))
+	copy(hdr[4:], typ)
+
+	crc := crc32.NewIEEE()
+	crc.Write(hdr[4:])
+	crc.Write(data)
+
+	var sum [4]byte
+	binary.BigEndian.PutUint32(sum[:], crc.Sum32())
+
+	for _, b := range [][]byte{hdr[:], data, sum[:]} {
+		if _, err := w.Write(b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// minInt returns the smaller of a and b.
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
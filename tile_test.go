@@ -0,0 +1,118 @@
+package phantomjs
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+)
+
+// Ensure tiles streamed by the PNG encoder decode to the original image.
+func TestPNGStreamEncoder(t *testing.T) {
+	const width, height = 7, 11
+
+	// Build a source image with distinct, partially transparent pixels.
+	src := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			src.SetNRGBA(x, y, color.NRGBA{R: uint8(x * 30), G: uint8(y * 20), B: uint8(x*y + 7), A: uint8(255 - x*y)})
+		}
+	}
+
+	// Stream tiles of uneven height, including a non-NRGBA tile.
+	var buf bytes.Buffer
+	enc, err := newPNGStreamEncoder(&buf, width, height)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range []image.Rectangle{
+		image.Rect(0, 0, width, 4),
+		image.Rect(0, 4, width, 8),
+		image.Rect(0, 8, width, height),
+	} {
+		var tile image.Image = src.SubImage(r)
+		if r.Min.Y == 4 {
+			rgba := image.NewRGBA(r)
+			for y := r.Min.Y; y < r.Max.Y; y++ {
+				for x := r.Min.X; x < r.Max.X; x++ {
+					rgba.Set(x, y, src.At(x, y))
+				}
+			}
+			tile = rgba
+		}
+		if err := enc.writeRows(tile, r.Dy()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := enc.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	img, err := png.Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	} else if img.Bounds() != src.Bounds() {
+		t.Fatalf("unexpected bounds: %v", img.Bounds())
+	}
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			want := src.NRGBAAt(x, y)
+			if got := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA); !nrgbaClose(got, want) {
+				t.Fatalf("unexpected pixel at (%d,%d): %v, expected %v", x, y, got, want)
+			}
+		}
+	}
+}
+
+// Ensure rows missing from short tiles are written as transparent pixels.
+func TestPNGStreamEncoder_Padding(t *testing.T) {
+	var buf bytes.Buffer
+	enc, err := newPNGStreamEncoder(&buf, 3, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Write a two row tile for three rows and leave the last row to close().
+	tile := image.NewNRGBA(image.Rect(0, 0, 3, 2))
+	for i := range tile.Pix {
+		tile.Pix[i] = 0xFF
+	}
+	if err := enc.writeRows(tile, 3); err != nil {
+		t.Fatal(err)
+	} else if err := enc.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	img, err := png.Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for y := 0; y < 5; y++ {
+		want := color.NRGBA{}
+		if y < 2 {
+			want = color.NRGBA{R: 0xFF, G: 0xFF, B: 0xFF, A: 0xFF}
+		}
+		if got := color.NRGBAModel.Convert(img.At(0, y)).(color.NRGBA); got != want {
+			t.Fatalf("unexpected pixel in row %d: %v", y, got)
+		}
+	}
+}
+
+// nrgbaClose returns true if a and b match. Color channels of transparent
+// pixels are ignored as they may be lost when converting to premultiplied
+// colors.
+func nrgbaClose(a, b color.NRGBA) bool {
+	if a.A != b.A {
+		return false
+	} else if a.A == 0 {
+		return true
+	}
+	d := func(x, y uint8) int {
+		if x > y {
+			return int(x - y)
+		}
+		return int(y - x)
+	}
+	return d(a.R, b.R) <= 1 && d(a.G, b.G) <= 1 && d(a.B, b.B) <= 1
+}